@@ -0,0 +1,343 @@
+/*
+Copyright © 2021 Jose Ramon Mañes jr.mb47@gmail.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	// currentProfileKey key of the config file with the profile used by default
+	currentProfileKey = "current-profile"
+	// profilesKey key of the config file with the profiles
+	profilesKey = "profiles"
+	// profileEnv environment variable with the profile to use
+	profileEnv = "AXECTL_PROFILE"
+)
+
+// profile name of the profile in use, set by --profile
+var profile string
+
+// errUnknownProfile the selected profile is not in the config file
+var errUnknownProfile = errors.New("doesn't exist in the config file")
+
+// configCmd manages the config file
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Manage the settings and profiles in ~/.axectl/config.yml",
+	Long: `Manage the settings and profiles in ~/.axectl/config.yml
+
+A profile is a set of settings which replaces the ones at the top of the file,
+example: a local SonarQube and the one of the team.
+
+current-profile: team-vm
+sonar:
+  runtime: podman
+profiles:
+  team-vm:
+    sonar:
+      host: http://sonarqube.team-vm:9000
+      user: admin
+      password-env: TEAM_SONAR_PASSWORD
+      organization: acme
+      projects: [api, web]
+
+The profile is selected with --profile, ` + profileEnv + ` or current-profile, in that order.
+Every setting can be overridden with an AXECTL_ environment variable: AXECTL_SONAR_HOST
+replaces sonar.host. The flags have preference over all of them.`,
+}
+
+// configGetCmd prints a setting
+var configGetCmd = &cobra.Command{
+	Use:   "get <key>",
+	Short: "Show the value of a setting with the profile, the environment and the flags applied",
+	Long: `Show the value of a setting with the profile, the environment and the flags applied.
+
+USAGE Examples:
+
+axectl config get sonar.host
+axectl config get sonar.host --profile team-vm`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		value := viper.Get(args[0])
+		if value == nil {
+			return errors.New(args[0] + " is not set")
+		}
+		return printConfigValue(os.Stdout, value)
+	},
+}
+
+// configSetCmd writes a setting in the config file
+var configSetCmd = &cobra.Command{
+	Use:   "set <key> <value>",
+	Short: "Write a setting in the config file, in the profile when --profile is used",
+	Long: `Write a setting in the config file, in the profile when --profile is used.
+The profile is created when it doesn't exist.
+
+USAGE Examples:
+
+axectl config set sonar.runtime podman
+axectl config set sonar.host http://sonarqube.team-vm:9000 --profile team-vm
+axectl config set sonar.projects api,web --profile team-vm`,
+	Args:              cobra.ExactArgs(2),
+	PersistentPreRunE: allowUnknownProfile,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		key := args[0]
+		if cmd.Flags().Changed("profile") {
+			key = profilesKey + "." + profile + "." + key
+		}
+
+		file := configFile()
+		config, err := readConfigFile(file)
+		if err != nil {
+			return err
+		}
+		if err := setConfigKey(&config, strings.Split(key, "."), args[1]); err != nil {
+			return err
+		}
+		if err := writeConfigFile(file, config); err != nil {
+			return err
+		}
+
+		fmt.Println("✅ " + key + " = " + args[1])
+		return nil
+	},
+}
+
+// configViewCmd prints the config file
+var configViewCmd = &cobra.Command{
+	Use:   "view",
+	Short: "Show the config file and the profile in use",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		config, err := readConfigFile(configFile())
+		if err != nil {
+			return err
+		}
+
+		name, err := selectedProfile(config)
+		if err != nil {
+			return err
+		}
+		fmt.Println("# file: " + configFile())
+		fmt.Println("# profile: " + name)
+		return printConfigValue(os.Stdout, config)
+	},
+}
+
+// configUseProfileCmd selects the profile used by default
+var configUseProfileCmd = &cobra.Command{
+	Use:               "use-profile <profile>",
+	Short:             "Set the profile used by default",
+	Args:              cobra.ExactArgs(1),
+	PersistentPreRunE: allowUnknownProfile,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		file := configFile()
+		config, err := readConfigFile(file)
+		if err != nil {
+			return err
+		}
+
+		if _, ok := configKey(config, []string{profilesKey, args[0]}); !ok {
+			return fmt.Errorf("the profile %s doesn't exist, the profiles are: %s", args[0], strings.Join(profileNames(config), ", "))
+		}
+		if err := setConfigKey(&config, []string{currentProfileKey}, args[0]); err != nil {
+			return err
+		}
+		if err := writeConfigFile(file, config); err != nil {
+			return err
+		}
+
+		fmt.Println("✅ Using the profile " + args[0])
+		return nil
+	},
+}
+
+// init add the config command to the root command
+func init() {
+	rootCmd.AddCommand(configCmd)
+	configCmd.AddCommand(configGetCmd, configSetCmd, configViewCmd, configUseProfileCmd)
+}
+
+// configFile returns the path of the config file in use
+func configFile() string {
+	if cfgFile != "" {
+		return cfgFile
+	}
+	if f := viper.ConfigFileUsed(); f != "" {
+		return f
+	}
+	home, err := os.UserHomeDir()
+	cobra.CheckErr(err)
+	return home + "/.axectl/config.yml"
+}
+
+// readConfigFile returns the content of the config file, empty when it doesn't exist
+func readConfigFile(file string) (yaml.MapSlice, error) {
+	config := yaml.MapSlice{}
+	data, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return config, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("invalid config file %s: %w", file, err)
+	}
+	return config, nil
+}
+
+// writeConfigFile writes the config file, it's only readable by the user
+func writeConfigFile(file string, config yaml.MapSlice) error {
+	data, err := yaml.Marshal(config)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(file, data, 0600)
+}
+
+// configKey returns the value of a key of the config file, the path is the key split by .
+func configKey(config yaml.MapSlice, path []string) (interface{}, bool) {
+	for _, item := range config {
+		if fmt.Sprint(item.Key) != path[0] {
+			continue
+		}
+		if len(path) == 1 {
+			return item.Value, true
+		}
+		child, ok := item.Value.(yaml.MapSlice)
+		if !ok {
+			return nil, false
+		}
+		return configKey(child, path[1:])
+	}
+	return nil, false
+}
+
+// setConfigKey sets the value of a key of the config file, the path is the key
+// split by ., the missing sections are created
+func setConfigKey(config *yaml.MapSlice, path []string, value interface{}) error {
+	for i, item := range *config {
+		if fmt.Sprint(item.Key) != path[0] {
+			continue
+		}
+		if len(path) == 1 {
+			(*config)[i].Value = value
+			return nil
+		}
+		child, ok := item.Value.(yaml.MapSlice)
+		if !ok && item.Value != nil {
+			return fmt.Errorf("%s is not a section", path[0])
+		}
+		if err := setConfigKey(&child, path[1:], value); err != nil {
+			return err
+		}
+		(*config)[i].Value = child
+		return nil
+	}
+
+	// the key doesn't exist
+	if len(path) == 1 {
+		*config = append(*config, yaml.MapItem{Key: path[0], Value: value})
+		return nil
+	}
+	child := yaml.MapSlice{}
+	if err := setConfigKey(&child, path[1:], value); err != nil {
+		return err
+	}
+	*config = append(*config, yaml.MapItem{Key: path[0], Value: child})
+	return nil
+}
+
+// profileNames returns the names of the profiles of the config file
+func profileNames(config yaml.MapSlice) []string {
+	var names []string
+	profiles, _ := configKey(config, []string{profilesKey})
+	if p, ok := profiles.(yaml.MapSlice); ok {
+		for _, item := range p {
+			names = append(names, fmt.Sprint(item.Key))
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// selectedProfile returns the profile selected by --profile, the environment
+// or the config file, empty when there is none
+func selectedProfile(config yaml.MapSlice) (string, error) {
+	name := profile
+	if name == "" {
+		name = os.Getenv(profileEnv)
+	}
+	if name == "" {
+		current, _ := configKey(config, []string{currentProfileKey})
+		if current != nil {
+			name = fmt.Sprint(current)
+		}
+	}
+	if name == "" {
+		return "", nil
+	}
+
+	if _, ok := configKey(config, []string{profilesKey, name}); !ok {
+		return "", fmt.Errorf("the profile %s %w, the profiles are: %s", name, errUnknownProfile, strings.Join(profileNames(config), ", "))
+	}
+	return name, nil
+}
+
+// allowUnknownProfile fails when the config can't be loaded, except when the
+// selected profile doesn't exist: the command creates or selects a profile
+func allowUnknownProfile(cmd *cobra.Command, args []string) error {
+	if errors.Is(configErr, errUnknownProfile) {
+		return nil
+	}
+	return configErr
+}
+
+// applyProfile replaces the settings of the config with the ones of the profile
+func applyProfile(v *viper.Viper, name string) error {
+	if name == "" {
+		return nil
+	}
+	return v.MergeConfigMap(v.GetStringMap(profilesKey + "." + name))
+}
+
+// printConfigValue prints a setting, the sections as YAML
+func printConfigValue(out io.Writer, value interface{}) error {
+	switch value.(type) {
+	case string, bool, int, int64, float64:
+		_, err := fmt.Fprintln(out, value)
+		return err
+	}
+
+	data, err := yaml.Marshal(value)
+	if err != nil {
+		return err
+	}
+	_, err = out.Write(data)
+	return err
+}
@@ -0,0 +1,160 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v2"
+)
+
+// testConfig config file with a base setting and two profiles
+const testConfig = `current-profile: local
+sonar:
+  host: http://localhost:9000
+  runtime: docker
+profiles:
+  local:
+    sonar:
+      organization: me
+  team-vm:
+    sonar:
+      host: http://sonarqube.team-vm:9000
+      password-env: TEAM_SONAR_PASSWORD
+      projects: [api, web]
+`
+
+// TestSetConfigKey check the settings written in the config file keep the order and the sections
+func TestSetConfigKey(t *testing.T) {
+	var tests = []struct {
+		name  string
+		key   []string
+		value string
+		want  string
+		err   bool
+	}{
+		{"replace", []string{"sonar", "host"}, "http://sonar:9000", "sonar:\n  host: http://sonar:9000\n  runtime: docker\n", false},
+		{"add", []string{"sonar", "edition"}, "developer", "sonar:\n  host: http://localhost:9000\n  runtime: docker\n  edition: developer\n", false},
+		{"new section", []string{"profiles", "team-vm", "sonar", "user"}, "ci", "sonar:\n  host: http://localhost:9000\n  runtime: docker\nprofiles:\n  team-vm:\n    sonar:\n      user: ci\n", false},
+		{"not a section", []string{"sonar", "host", "port"}, "9000", "", true},
+	}
+
+	for _, tt := range tests {
+		config := yaml.MapSlice{}
+		if err := yaml.Unmarshal([]byte("sonar:\n  host: http://localhost:9000\n  runtime: docker\n"), &config); err != nil {
+			t.Fatal(err)
+		}
+		err := setConfigKey(&config, tt.key, tt.value)
+		if (err != nil) != tt.err {
+			t.Errorf("ERROR: %s: %v", tt.name, err)
+			continue
+		}
+		if tt.err {
+			continue
+		}
+		got, _ := yaml.Marshal(config)
+		if string(got) != tt.want {
+			t.Errorf("ERROR: %s:\n%s\nwant:\n%s", tt.name, got, tt.want)
+		}
+	}
+}
+
+// TestSelectedProfile check the profile of the flag, the environment and the config file
+func TestSelectedProfile(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "config.yml")
+	if err := os.WriteFile(file, []byte(testConfig), 0600); err != nil {
+		t.Fatal(err)
+	}
+	config, err := readConfigFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer func() { profile = "" }()
+	var tests = []struct {
+		name string
+		flag string
+		env  string
+		want string
+		err  bool
+	}{
+		{"config file", "", "", "local", false},
+		{"environment", "", "team-vm", "team-vm", false},
+		{"flag", "team-vm", "local", "team-vm", false},
+		{"unknown", "production", "", "", true},
+	}
+
+	for _, tt := range tests {
+		profile = tt.flag
+		t.Setenv(profileEnv, tt.env)
+		got, err := selectedProfile(config)
+		if got != tt.want || (err != nil) != tt.err || (err != nil && !errors.Is(err, errUnknownProfile)) {
+			t.Errorf("ERROR: %s: %s, %v", tt.name, got, err)
+		}
+	}
+
+	if names := profileNames(config); len(names) != 2 || names[0] != "local" || names[1] != "team-vm" {
+		t.Errorf("ERROR: profiles: %v", names)
+	}
+	if config, _ := readConfigFile(filepath.Join(t.TempDir(), "missing.yml")); len(config) != 0 {
+		t.Errorf("ERROR: a missing config file is empty: %v", config)
+	}
+}
+
+// TestConfigSetNewProfile check config set creates the profile, the other commands fail
+func TestConfigSetNewProfile(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "config.yml")
+	if err := os.WriteFile(file, []byte(testConfig), 0600); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		profile, cfgFile, configErr = "", "", nil
+		rootCmd.SetArgs(nil)
+	}()
+
+	rootCmd.SetArgs([]string{"config", "set", "sonar.host", "http://sonarqube.ci:9000", "--profile", "ci", "--config", file})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("ERROR: config set: %v", err)
+	}
+	config, err := readConfigFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if host, _ := configKey(config, []string{profilesKey, "ci", "sonar", "host"}); host != "http://sonarqube.ci:9000" {
+		t.Errorf("ERROR: host of the new profile: %v", host)
+	}
+
+	rootCmd.SetArgs([]string{"config", "view", "--profile", "production", "--config", file})
+	if err := rootCmd.Execute(); !errors.Is(err, errUnknownProfile) {
+		t.Errorf("ERROR: config view of an unknown profile: %v", err)
+	}
+}
+
+// TestApplyProfile check the settings of the profile replace the ones of the config file and
+// the environment replaces both
+func TestApplyProfile(t *testing.T) {
+	v := viper.New()
+	v.SetConfigType("yml")
+	if err := v.ReadConfig(bytes.NewBufferString(testConfig)); err != nil {
+		t.Fatal(err)
+	}
+	if err := applyProfile(v, "team-vm"); err != nil {
+		t.Fatal(err)
+	}
+
+	if v.GetString("sonar.host") != "http://sonarqube.team-vm:9000" || v.GetString("sonar.runtime") != "docker" ||
+		v.GetString("sonar.password-env") != "TEAM_SONAR_PASSWORD" || len(v.GetStringSlice("sonar.projects")) != 2 {
+		t.Errorf("ERROR: settings of the profile: %v", v.AllSettings())
+	}
+
+	t.Setenv("AXECTL_SONAR_HOST", "http://sonarqube.ci:9000")
+	v.SetEnvPrefix("axectl")
+	v.AutomaticEnv()
+	v.SetEnvKeyReplacer(newEnvKeyReplacer())
+	if v.GetString("sonar.host") != "http://sonarqube.ci:9000" {
+		t.Errorf("ERROR: environment: %s", v.GetString("sonar.host"))
+	}
+}
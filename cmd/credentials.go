@@ -0,0 +1,218 @@
+/*
+Copyright © 2021 Jose Ramon Mañes jr.mb47@gmail.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/jrmanes/axectl/pkg/credstore"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// credential stores, set in credentials.store
+const (
+	storeFile      = "file"
+	storeEncrypted = "encrypted"
+	storeKeyring   = "keyring"
+	// storeAuto uses the keyring when it's available, the files otherwise
+	storeAuto = "auto"
+)
+
+const (
+	// credentialsFolder folder inside the home of the secrets of the file store
+	credentialsFolder = "/.axectl/sonar"
+	// encryptedFile file inside the home of the encrypted store
+	encryptedFile = "/.axectl/sonar/secrets.json"
+	// passphraseEnv environment variable with the passphrase of the encrypted store
+	passphraseEnv = "AXECTL_CREDENTIALS_PASSPHRASE"
+	// keyringService service of the secrets in the keyring
+	keyringService = "axectl"
+	// keyringHint the packages of secret-tool, the keyring is used through it
+	keyringHint = "secret-tool (libsecret-tools in Debian and Ubuntu, libsecret in Fedora)"
+	// adminPasswordKey key of the admin password in the store
+	adminPasswordKey = "admin-password"
+	// tokensPrefix prefix of the keys of the tokens in the store
+	tokensPrefix = "tokens/"
+)
+
+var (
+	// stores the credential stores already opened, the encrypted one caches its key
+	stores   = map[string]credstore.Store{}
+	storesMu sync.Mutex
+)
+
+// configMigrateCredentialsCmd moves the secrets to another store
+var configMigrateCredentialsCmd = &cobra.Command{
+	Use:   "migrate-credentials <file|encrypted|keyring>",
+	Short: "Move the admin password and the tokens to another credential store and use it",
+	Long: `Move the admin password and the tokens to another credential store and use it.
+
+The stores are:
+- file: a file only readable by the user for every secret in ~/.axectl/sonar/, the default
+- encrypted: all the secrets in ~/.axectl/sonar/secrets.json encrypted with the passphrase of ` + passphraseEnv + `
+- keyring: the desktop keyring (GNOME Keyring, KWallet...), axectl doesn't talk to
+  the Secret Service over D-Bus itself, it runs the secret-tool command of libsecret
+  (libsecret-tools in Debian and Ubuntu, libsecret in Fedora) in a D-Bus session, most
+  servers and minimal installs have neither of them
+- auto: the keyring when it's available, the files otherwise
+
+USAGE Examples:
+
+` + passphraseEnv + `=... axectl config migrate-credentials encrypted
+axectl config migrate-credentials keyring`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		from, err := secretStore()
+		if err != nil {
+			return err
+		}
+		to, err := openStore(args[0])
+		if errors.Is(err, credstore.ErrKeyringUnavailable) {
+			return fmt.Errorf("%w, install %s or use the %s store", err, keyringHint, storeEncrypted)
+		}
+		if err != nil {
+			return err
+		}
+		if _, ok := to.(*credstore.File); ok && args[0] == storeAuto {
+			fmt.Println("ℹ️  The keyring is not available, it needs " + keyringHint + " and a D-Bus session, the secrets are kept in files")
+		}
+
+		moved, err := migrateSecrets(from, to)
+		if err != nil {
+			return err
+		}
+
+		file := configFile()
+		config, err := readConfigFile(file)
+		if err != nil {
+			return err
+		}
+		if err := setConfigKey(&config, []string{"credentials", "store"}, args[0]); err != nil {
+			return err
+		}
+		if err := writeConfigFile(file, config); err != nil {
+			return err
+		}
+
+		fmt.Printf("✅ %d secrets moved from the %s to the %s\n", moved, from.Name(), to.Name())
+		return nil
+	},
+}
+
+// init add the migrate-credentials command to the config command
+func init() {
+	viper.SetDefault("credentials.store", storeFile)
+	configCmd.AddCommand(configMigrateCredentialsCmd)
+}
+
+// secretStore returns the credential store of the config, in a dry run the changes are added to the plan
+func secretStore() (credstore.Store, error) {
+	store, err := openStore(viper.GetString("credentials.store"))
+	if err != nil || currentPlan == nil {
+		return store, err
+	}
+	return currentPlan.secrets(store), nil
+}
+
+// openStore returns a credential store, file, encrypted, keyring or auto
+func openStore(kind string) (credstore.Store, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil, err
+	}
+
+	storesMu.Lock()
+	defer storesMu.Unlock()
+
+	// the home changes in the tests
+	id := kind + ":" + home
+	if s, ok := stores[id]; ok {
+		return s, nil
+	}
+
+	var s credstore.Store
+	switch kind {
+	case storeFile, "":
+		s = credstore.NewFile(filepath.Join(home, credentialsFolder))
+	case storeEncrypted:
+		passphrase := os.Getenv(passphraseEnv)
+		if passphrase == "" {
+			return nil, errors.New("the encrypted credential store needs the passphrase in " + passphraseEnv)
+		}
+		s, err = credstore.NewEncrypted(filepath.Join(home, encryptedFile), passphrase)
+	case storeKeyring:
+		s, err = credstore.NewKeyring(keyringService)
+	case storeAuto:
+		if s, err = credstore.NewKeyring(keyringService); errors.Is(err, credstore.ErrKeyringUnavailable) {
+			s, err = credstore.NewFile(filepath.Join(home, credentialsFolder)), nil
+		}
+	default:
+		return nil, fmt.Errorf("unknown credential store %s, use: %s, %s, %s or %s", kind, storeFile, storeEncrypted, storeKeyring, storeAuto)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	stores[id] = s
+	return s, nil
+}
+
+// migrateSecrets copies the admin password and the tokens to another store and
+// removes them from the first one, it returns how many were moved
+func migrateSecrets(from, to credstore.Store) (int, error) {
+	if from.Name() == to.Name() {
+		return 0, nil
+	}
+
+	keys, err := from.List(tokensPrefix)
+	if err != nil {
+		return 0, err
+	}
+	keys = append([]string{adminPasswordKey}, keys...)
+
+	moved := 0
+	for _, k := range keys {
+		secret, err := from.Get(k)
+		if errors.Is(err, credstore.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return moved, err
+		}
+		if err := to.Set(k, secret); err != nil {
+			return moved, err
+		}
+		if err := from.Delete(k); err != nil {
+			return moved, err
+		}
+		moved++
+	}
+	return moved, nil
+}
+
+// maskSecret hides a secret, only its first and last characters are shown when it's long enough
+func maskSecret(secret string) string {
+	if len(secret) < 12 {
+		return strings.Repeat("*", len(secret))
+	}
+	return secret[:4] + strings.Repeat("*", len(secret)-8) + secret[len(secret)-4:]
+}
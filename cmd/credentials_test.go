@@ -0,0 +1,56 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestMigrateSecrets check the secrets are moved from the files to the encrypted store
+func TestMigrateSecrets(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv(passphraseEnv, "correct horse")
+
+	from, err := openStore(storeFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for k, v := range map[string]string{adminPasswordKey: "p4ss", tokensPrefix + "api": "squ_1", tokensPrefix + "web": "squ_2"} {
+		if err := from.Set(k, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	to, err := openStore(storeEncrypted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	moved, err := migrateSecrets(from, to)
+	if err != nil || moved != 3 {
+		t.Fatalf("ERROR: moved: %d, %v", moved, err)
+	}
+
+	if p, err := to.Get(adminPasswordKey); err != nil || p != "p4ss" {
+		t.Errorf("ERROR: admin password: %s, %v", p, err)
+	}
+	if keys, _ := to.List(tokensPrefix); strings.Join(keys, ",") != "tokens/api,tokens/web" {
+		t.Errorf("ERROR: tokens: %v", keys)
+	}
+	if keys, _ := from.List(tokensPrefix); len(keys) != 0 {
+		t.Errorf("ERROR: the tokens were not removed from the files: %v", keys)
+	}
+	if _, err := os.Stat(filepath.Join(home, adminPasswordFile)); !os.IsNotExist(err) {
+		t.Errorf("ERROR: the admin password file was not removed: %v", err)
+	}
+
+	if _, err := openStore("vault"); err == nil {
+		t.Errorf("ERROR: unknown store accepted")
+	}
+	t.Setenv(passphraseEnv, "")
+	t.Setenv("HOME", t.TempDir())
+	if _, err := openStore(storeEncrypted); err == nil {
+		t.Errorf("ERROR: encrypted store without passphrase")
+	}
+}
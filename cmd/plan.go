@@ -0,0 +1,462 @@
+/*
+Copyright © 2021 Jose Ramon Mañes jr.mb47@gmail.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+
+	"github.com/jrmanes/axectl/pkg/container"
+	"github.com/jrmanes/axectl/pkg/credstore"
+	"github.com/spf13/cobra"
+)
+
+// kinds of the steps of a plan
+const (
+	stepCommand   = "command"
+	stepHTTP      = "http"
+	stepFile      = "file"
+	stepSecret    = "secret"
+	stepContainer = "container"
+)
+
+// formats of the plan
+const (
+	planText = "text"
+	planJSON = "json"
+)
+
+// redacted replaces the secrets in the plan
+const redacted = "REDACTED"
+
+// currentPlan records what the command does instead of doing it, it's only set with --dry-run or --plan
+var currentPlan *plan
+
+// planStep is a shell command, an HTTP request, a file or a secret written or
+// removed, or a command of the container runtime, the fields depend on the kind
+type planStep struct {
+	Kind    string `json:"kind"`
+	Action  string `json:"action,omitempty"`
+	Command string `json:"command,omitempty"`
+	Method  string `json:"method,omitempty"`
+	URL     string `json:"url,omitempty"`
+	Body    string `json:"body,omitempty"`
+	Path    string `json:"path,omitempty"`
+	Store   string `json:"store,omitempty"`
+	Key     string `json:"key,omitempty"`
+	Runtime string `json:"runtime,omitempty"`
+}
+
+// String returns the description of the step shown in the text plan
+func (s planStep) String() string {
+	switch s.Kind {
+	case stepCommand:
+		return s.Command
+	case stepHTTP:
+		if s.Body != "" {
+			return s.Method + " " + s.URL + " " + s.Body
+		}
+		return s.Method + " " + s.URL
+	case stepFile:
+		return s.Action + " " + s.Path
+	case stepSecret:
+		return s.Action + " " + s.Key + " in the " + s.Store
+	case stepContainer:
+		return s.Command
+	}
+	return s.Action
+}
+
+// plan is the ordered list of what a command would do, it's the Runner and
+// the HTTP transport of the dry runs
+type plan struct {
+	mu    sync.Mutex
+	steps []planStep
+	// store keeps the secrets written by the plan, see planStore
+	store *planStore
+}
+
+// add appends a step to the plan
+func (p *plan) add(s planStep) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.steps = append(p.steps, s)
+}
+
+// Run adds the command to the plan, with its input in the body
+func (p *plan) Run(ctx context.Context, c Command) error {
+	p.add(planStep{Kind: stepCommand, Command: c.String(), Body: c.input})
+	return nil
+}
+
+// Output adds the command to the plan, its output is empty
+func (p *plan) Output(ctx context.Context, c Command) (string, error) {
+	return "", p.Run(ctx, c)
+}
+
+// RoundTrip adds the request to the plan, it's never sent: the answer is the
+// one of a new SonarQube
+func (p *plan) RoundTrip(req *http.Request) (*http.Response, error) {
+	step := planStep{Kind: stepHTTP, Method: req.Method}
+
+	u := *req.URL
+	u.RawQuery = redactValues(u.Query()).Encode()
+	step.URL = strings.TrimSuffix(u.String(), "?")
+
+	form := url.Values{}
+	if req.Body != nil {
+		body, err := ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		form, _ = url.ParseQuery(string(body))
+		step.Body = redactValues(form).Encode()
+	}
+	p.add(step)
+
+	return &http.Response{
+		Status:     "200 OK",
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": []string{"application/json"}},
+		Body:       ioutil.NopCloser(strings.NewReader(planAnswer(req, form))),
+		Request:    req,
+	}, nil
+}
+
+// planAnswer returns the answer of a new SonarQube to the request, it's
+// empty when it's not one of the requests made to start SonarQube or the tokens
+func planAnswer(req *http.Request, form url.Values) string {
+	switch path := req.URL.Path; {
+	case strings.HasSuffix(path, "/api/system/status"):
+		return `{"status":"UP"}`
+	case strings.HasSuffix(path, "/api/system/health"):
+		return `{"health":"GREEN","causes":[]}`
+	case strings.HasSuffix(path, "/api/authentication/validate"):
+		// only the default password is valid in a new SonarQube
+		_, password, _ := req.BasicAuth()
+		return `{"valid":` + strconv.FormatBool(password == defaultAdminPassword) + `}`
+	case strings.HasSuffix(path, "/api/user_tokens/generate"):
+		name, _ := json.Marshal(form.Get("name"))
+		return `{"name":` + string(name) + `}`
+	}
+	return "{}"
+}
+
+// redactValues returns the values with the passwords, tokens and secrets redacted
+func redactValues(values url.Values) url.Values {
+	out := url.Values{}
+	for k, v := range values {
+		name := strings.ToLower(k)
+		if strings.Contains(name, "password") || strings.Contains(name, "token") || strings.Contains(name, "secret") {
+			v = []string{redacted}
+		}
+		out[k] = v
+	}
+	return out
+}
+
+// httpClient returns the HTTP client which adds the requests to the plan
+func (p *plan) httpClient() *http.Client {
+	return &http.Client{Transport: p}
+}
+
+// runtime returns the container runtime which adds the changes to the plan
+// as the commands of the CLI of rt, or the docker or podman ones when rt is
+// the Engine API, rt can be nil when it's not installed yet
+func (p *plan) runtime(rt container.Runtime, name string) container.Runtime {
+	r := planContainers{plan: p, runtime: name}
+	cli, ok := rt.(*container.CLI)
+	if ok {
+		cli = cli.WithRunner(r)
+	} else {
+		docker := runtimeDocker
+		if strings.HasPrefix(name, runtimePodman) {
+			docker = runtimePodman
+		}
+		cli = container.NewCLI(r, docker, []string{docker, "compose"})
+	}
+	return planRuntime{plan: p, runtime: rt, name: name, cli: cli}
+}
+
+// secrets returns the credential store which adds the changes to the plan
+func (p *plan) secrets(store credstore.Store) credstore.Store {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.store == nil || p.store.store.Name() != store.Name() {
+		p.store = &planStore{plan: p, store: store, changes: map[string]*string{}}
+	}
+	return p.store
+}
+
+// print writes the plan in the format, text or json
+func (p *plan) print(out io.Writer, command, format string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if format == planJSON {
+		steps := p.steps
+		if steps == nil {
+			steps = []planStep{}
+		}
+		e := json.NewEncoder(out)
+		e.SetIndent("", "  ")
+		e.SetEscapeHTML(false)
+		return e.Encode(struct {
+			Command string     `json:"command"`
+			Steps   []planStep `json:"steps"`
+		}{command, steps})
+	}
+
+	if len(p.steps) == 0 {
+		fmt.Fprintln(out, "📋 "+command+" has nothing to do")
+		return nil
+	}
+	fmt.Fprintln(out, "📋 Plan of "+command+", nothing has been done:")
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	for i, s := range p.steps {
+		fmt.Fprintf(w, "%d\t%s\t%s\n", i+1, s.Kind, s)
+	}
+	return w.Flush()
+}
+
+// planContainers is the container.Runner of a dry run, it adds the commands
+// of the container runtime to the plan
+type planContainers struct {
+	plan    *plan
+	runtime string
+}
+
+func (r planContainers) Run(ctx context.Context, c container.Cmd, out io.Writer) error {
+	r.plan.add(planStep{Kind: stepContainer, Runtime: r.runtime, Command: c.String()})
+	return nil
+}
+
+func (r planContainers) Output(ctx context.Context, c container.Cmd) (string, error) {
+	return "", r.Run(ctx, c, nil)
+}
+
+// planRuntime is the container runtime of a dry run, the changes are added
+// to the plan by cli and the reads use the runtime when it's available
+type planRuntime struct {
+	plan    *plan
+	runtime container.Runtime
+	name    string
+	cli     *container.CLI
+}
+
+func (r planRuntime) Name() string {
+	return r.name
+}
+
+func (r planRuntime) Up(ctx context.Context, p container.Project, out io.Writer) error {
+	return r.cli.Up(ctx, p, out)
+}
+
+func (r planRuntime) Stop(ctx context.Context, p container.Project) error {
+	return r.cli.Stop(ctx, p)
+}
+
+func (r planRuntime) Down(ctx context.Context, p container.Project, volumes bool) error {
+	return r.cli.Down(ctx, p, volumes)
+}
+
+func (r planRuntime) Status(ctx context.Context, p container.Project) ([]container.Container, error) {
+	if r.runtime == nil {
+		return nil, nil
+	}
+	return r.runtime.Status(ctx, p)
+}
+
+func (r planRuntime) Logs(ctx context.Context, p container.Project, service string, opts container.LogsOptions, out io.Writer) error {
+	if r.runtime == nil {
+		return nil
+	}
+	return r.runtime.Logs(ctx, p, service, opts, out)
+}
+
+// Run adds the container to the plan as the docker command, the secrets are only the names
+func (r planRuntime) Run(ctx context.Context, spec container.RunSpec, out io.Writer) error {
+	return r.cli.Run(ctx, spec, out)
+}
+
+// planStore is the credential store of a dry run: the secrets are read from
+// the store, the changes are added to the plan and kept in memory, so the
+// next steps see them
+type planStore struct {
+	plan  *plan
+	store credstore.Store
+
+	mu sync.Mutex
+	// changes the secrets written, nil when they are deleted
+	changes map[string]*string
+}
+
+func (s *planStore) Name() string {
+	return s.store.Name()
+}
+
+func (s *planStore) Get(key string) (string, error) {
+	s.mu.Lock()
+	secret, ok := s.changes[key]
+	s.mu.Unlock()
+
+	switch {
+	case !ok:
+		return s.store.Get(key)
+	case secret == nil:
+		return "", credstore.ErrNotFound
+	}
+	return *secret, nil
+}
+
+func (s *planStore) Set(key, secret string) error {
+	s.plan.add(planStep{Kind: stepSecret, Action: "write", Store: s.Name(), Key: key})
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.changes[key] = &secret
+	return nil
+}
+
+func (s *planStore) Delete(key string) error {
+	s.plan.add(planStep{Kind: stepSecret, Action: "remove", Store: s.Name(), Key: key})
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.changes[key] = nil
+	return nil
+}
+
+func (s *planStore) List(prefix string) ([]string, error) {
+	keys, err := s.store.List(prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var list []string
+	for _, k := range keys {
+		if _, ok := s.changes[k]; !ok {
+			list = append(list, k)
+		}
+	}
+	for k, secret := range s.changes {
+		if secret != nil && strings.HasPrefix(k, prefix) {
+			list = append(list, k)
+		}
+	}
+	sort.Strings(list)
+	return list, nil
+}
+
+// planCommand makes cmd print its plan instead of doing anything with
+// --dry-run or --plan, in the format of --plan-output
+func planCommand(cmd *cobra.Command) {
+	run := cmd.RunE
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+		if p, _ := cmd.Flags().GetBool("plan"); !dryRun && !p {
+			return run(cmd, args)
+		}
+
+		format, _ := cmd.Flags().GetString("plan-output")
+		if format != planText && format != planJSON {
+			return errors.New("unknown plan format " + format + ", use: " + planText + " or " + planJSON)
+		}
+
+		currentPlan = &plan{}
+		defer func() { currentPlan = nil }()
+
+		// the plan is printed when the command fails too, it shows the steps until the error
+		err := run(cmd, args)
+		if perr := currentPlan.print(cmd.OutOrStdout(), cmd.CommandPath(), format); perr != nil && err == nil {
+			err = perr
+		}
+		return err
+	}
+}
+
+// actionOutput returns where the commands write their progress, it's
+// discarded in the dry runs, the plan is shown instead
+func actionOutput() io.Writer {
+	if currentPlan != nil {
+		return ioutil.Discard
+	}
+	return os.Stdout
+}
+
+// writeFile writes the file, in a dry run it's added to the plan
+func writeFile(path string, data []byte, perm os.FileMode) error {
+	if currentPlan != nil {
+		currentPlan.add(planStep{Kind: stepFile, Action: "write", Path: path})
+		return nil
+	}
+	return os.WriteFile(path, data, perm)
+}
+
+// createFile creates or truncates the file, in a dry run it's added to the
+// plan and what is written is discarded
+func createFile(path string) (io.WriteCloser, error) {
+	if currentPlan != nil {
+		currentPlan.add(planStep{Kind: stepFile, Action: "write", Path: path})
+		return nopWriteCloser{ioutil.Discard}, nil
+	}
+	return os.Create(path)
+}
+
+// nopWriteCloser is a writer which does nothing when it's closed
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
+
+// removeFile removes the file, it's fine if it doesn't exist. In a dry run it's added to the plan
+func removeFile(path string) error {
+	if currentPlan != nil {
+		currentPlan.add(planStep{Kind: stepFile, Action: "remove", Path: path})
+		return nil
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// mkdirAll creates the folder and its parents, in a dry run it's added to the plan when it doesn't exist
+func mkdirAll(path string, perm os.FileMode) error {
+	if currentPlan != nil {
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			currentPlan.add(planStep{Kind: stepFile, Action: "mkdir", Path: path})
+		}
+		return nil
+	}
+	return os.MkdirAll(path, perm)
+}
@@ -0,0 +1,233 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/jrmanes/axectl/pkg/container"
+	"github.com/jrmanes/axectl/pkg/credstore"
+	"github.com/spf13/cobra"
+)
+
+// TestPlanHTTP check no request is sent and the redacted plan of them
+func TestPlanHTTP(t *testing.T) {
+	var requests int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.Write([]byte(`{"valid":true}`))
+	}))
+	defer srv.Close()
+
+	currentPlan = &plan{}
+	defer func() { currentPlan = nil }()
+	ctx := context.Background()
+
+	// the answers are the ones of a new SonarQube, only the default password is valid
+	if valid, err := sonarClient(srv.URL, "admin", "s3cret").ValidateCredentials(ctx); err != nil || valid {
+		t.Errorf("ERROR: stored password: %t, %v", valid, err)
+	}
+	if valid, err := sonarClient(srv.URL, "admin", "admin").ValidateCredentials(ctx); err != nil || !valid {
+		t.Errorf("ERROR: default password: %t, %v", valid, err)
+	}
+	if err := sonarClient(srv.URL, "admin", "admin").ChangePassword(ctx, "admin", "admin", "s3cret"); err != nil {
+		t.Errorf("ERROR: change password: %v", err)
+	}
+	if token, err := sonarClient(srv.URL, "admin", "admin").GenerateToken(ctx, "api", ""); err != nil || token.Name != "api" {
+		t.Errorf("ERROR: generated token: %+v, %v", token, err)
+	}
+	// a new SonarQube has no tokens
+	if tokens, err := sonarClient(srv.URL, "admin", "admin").SearchTokens(ctx, ""); err != nil || len(tokens) != 0 {
+		t.Errorf("ERROR: the tokens of a new SonarQube: %v, %v", tokens, err)
+	}
+	if requests != 0 {
+		t.Errorf("ERROR: %d requests were sent", requests)
+	}
+
+	var got []string
+	for _, s := range currentPlan.steps {
+		got = append(got, s.String())
+	}
+	want := []string{
+		"GET " + srv.URL + "/api/authentication/validate",
+		"GET " + srv.URL + "/api/authentication/validate",
+		"POST " + srv.URL + "/api/users/change_password login=admin&password=REDACTED&previousPassword=REDACTED",
+		"POST " + srv.URL + "/api/user_tokens/generate name=api",
+		"GET " + srv.URL + "/api/user_tokens/search",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("ERROR: plan:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+// TestPlanRuntime check the changes of the containers are the commands of the runtime
+func TestPlanRuntime(t *testing.T) {
+	project := sonarProject(defaultComposeOptions)
+	compose := " -p " + project.Name + " -f " + project.ComposeFile
+	spec := container.RunSpec{Image: scannerImage, Network: sonarNetwork, Secrets: []string{"SONAR_TOKEN=squ_api"}, Args: []string{"-Dsonar.projectKey=api"}}
+
+	var tests = []struct {
+		name    string
+		runtime container.Runtime
+		want    []string
+	}{
+		{"not installed", nil, []string{"docker compose" + compose + " up -d", "docker compose" + compose + " down --remove-orphans -v",
+			"docker run --rm --network=" + sonarNetwork + " -e SONAR_TOKEN " + scannerImage + " -Dsonar.projectKey=api"}},
+		{"podman-compose", container.NewCLI(cliRunner{runner: &fakeRunner{}}, "podman", []string{"/usr/bin/podman-compose"}), []string{"/usr/bin/podman-compose" + compose + " up -d",
+			"/usr/bin/podman-compose" + compose + " down --remove-orphans -v", "podman run --rm --network=" + sonarNetwork + " -e SONAR_TOKEN " + scannerImage + " -Dsonar.projectKey=api"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &plan{}
+			name := runtimeDocker
+			if tt.runtime != nil {
+				name = tt.runtime.Name()
+			}
+			rt := p.runtime(tt.runtime, name)
+			ctx := context.Background()
+			if err := rt.Up(ctx, project, io.Discard); err != nil {
+				t.Fatal(err)
+			}
+			if err := rt.Down(ctx, project, true); err != nil {
+				t.Fatal(err)
+			}
+			if err := rt.Run(ctx, spec, io.Discard); err != nil {
+				t.Fatal(err)
+			}
+
+			var got []string
+			for _, s := range p.steps {
+				if s.Kind != stepContainer || s.Runtime != name {
+					t.Errorf("ERROR: step: %+v", s)
+				}
+				got = append(got, s.String())
+			}
+			if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("ERROR: plan:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+			}
+		})
+	}
+}
+
+// TestPlanStore check the secrets written by a plan are only kept in memory
+func TestPlanStore(t *testing.T) {
+	dir := t.TempDir()
+	file := credstore.NewFile(dir)
+	if err := file.Set("tokens/api", "squ_api"); err != nil {
+		t.Fatal(err)
+	}
+
+	p := &plan{}
+	store := p.secrets(file)
+	if err := store.Set("tokens/web", "squ_web"); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Delete("tokens/api"); err != nil {
+		t.Fatal(err)
+	}
+
+	if s, err := store.Get("tokens/web"); err != nil || s != "squ_web" {
+		t.Errorf("ERROR: written secret: %s, %v", s, err)
+	}
+	if _, err := store.Get("tokens/api"); !errors.Is(err, credstore.ErrNotFound) {
+		t.Errorf("ERROR: deleted secret: %v", err)
+	}
+	if keys, _ := store.List(tokensPrefix); strings.Join(keys, ",") != "tokens/web" {
+		t.Errorf("ERROR: keys: %v", keys)
+	}
+	if p.secrets(file) != store || len(p.steps) != 2 {
+		t.Errorf("ERROR: steps: %+v", p.steps)
+	}
+
+	// the store is not changed
+	if s, err := file.Get("tokens/api"); err != nil || s != "squ_api" {
+		t.Errorf("ERROR: the secret was deleted: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "tokens", "web")); !os.IsNotExist(err) {
+		t.Errorf("ERROR: the secret was written: %v", err)
+	}
+}
+
+// TestPlanCommand check the plan printed by the commands with --dry-run and --plan
+func TestPlanCommand(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "docker-compose.yml")
+
+	var tests = []struct {
+		name string
+		args []string
+		want string
+		err  bool
+	}{
+		{"without plan", nil, "", false},
+		{"dry run", []string{"--dry-run"}, "📋 Plan of test, nothing has been done:\n1  command  go version\n2  file     write " + file + "\n", false},
+		{"json", []string{"--plan", "--plan-output", "json"}, "test: command go version, file write " + file, false},
+		{"unknown format", []string{"--plan", "--plan-output", "yaml"}, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer os.Remove(file)
+
+			c := &cobra.Command{
+				Use: "test",
+				RunE: func(cmd *cobra.Command, args []string) error {
+					// the go command is available where the tests run
+					if err := newRunner(false).Run(context.Background(), Command{command: "go", args: []string{"version"}}); err != nil {
+						return err
+					}
+					return writeFile(file, []byte("services:"), 0600)
+				},
+			}
+			c.Flags().Bool("dry-run", false, "")
+			c.Flags().Bool("plan", false, "")
+			c.Flags().String("plan-output", planText, "")
+			planCommand(c)
+
+			var out bytes.Buffer
+			c.SetOut(&out)
+			c.SetErr(&out)
+			c.SetArgs(tt.args)
+			err := c.Execute()
+			if (err != nil) != tt.err {
+				t.Fatalf("ERROR: unexpected error: %v", err)
+			}
+			if currentPlan != nil {
+				t.Errorf("ERROR: the plan is still set")
+			}
+
+			_, statErr := os.Stat(file)
+			if written := statErr == nil; written != (tt.args == nil) {
+				t.Errorf("ERROR: written: %t", written)
+			}
+
+			got := out.String()
+			if strings.Contains(tt.name, "json") {
+				var p struct {
+					Command string     `json:"command"`
+					Steps   []planStep `json:"steps"`
+				}
+				if err := json.Unmarshal(out.Bytes(), &p); err != nil {
+					t.Fatalf("ERROR: invalid json: %v\n%s", err, got)
+				}
+				var steps []string
+				for _, s := range p.Steps {
+					steps = append(steps, s.Kind+" "+s.String())
+				}
+				got = p.Command + ": " + strings.Join(steps, ", ")
+			}
+			if !tt.err && got != tt.want {
+				t.Errorf("ERROR: output:\n%s\nwant:\n%s", got, tt.want)
+			}
+		})
+	}
+}
@@ -19,6 +19,7 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -26,6 +27,9 @@ import (
 
 var cfgFile string
 
+// configErr the error loading the config file, the commands fail with it
+var configErr error
+
 // rootCmd represents the base command when called without any subcommands
 var rootCmd = &cobra.Command{
 	Use:   "axectl",
@@ -64,6 +68,9 @@ var rootCmd = &cobra.Command{
 --------------------------------------------------
 axectl is a set of tools for DevOps/SRE.
 -------------------------------------------------`,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		return configErr
+	},
 }
 
 // Execute adds all child commands to the root command and sets flags appropriately.
@@ -77,7 +84,8 @@ func init() {
 	// Here you will define your flags and configuration settings.
 	// Cobra supports persistent flags, which, if defined here,
 	// will be global for your application.
-	//rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.piktocºtl.yaml)")
+	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.axectl/config.yml)")
+	rootCmd.PersistentFlags().StringVar(&profile, "profile", "", "Profile of the config file to use, by default "+profileEnv+" or the current-profile of the config file")
 
 	// Cobra also supports local flags, which will only run
 	// when this action is called directly.
@@ -101,46 +109,60 @@ func initConfig() {
 		configType := "yml"
 		configPath := filepath.Join(configHome, configName+"."+configType)
 
-		err = CreateFileInPath(configHome, configPath)
-		if err != nil {
-			log.Fatal(err)
+		if err := CreateFileInPath(configHome, configPath); err != nil {
+			configErr = err
+			return
 		}
 
 		viper.AddConfigPath(configHome)
 		viper.SetConfigName(configName)
 		viper.SetConfigType(configType)
-
-		if _, err := os.Stat(configHome); os.IsNotExist(err) {
-			err = os.MkdirAll(configHome, 0764)
-			log.Fatal(err)
-		}
 	}
 
-	viper.AutomaticEnv() // read in environment variables that match
+	// read in environment variables that match, AXECTL_SONAR_HOST for sonar.host
+	viper.SetEnvPrefix("axectl")
+	viper.SetEnvKeyReplacer(newEnvKeyReplacer())
+	viper.AutomaticEnv()
 
 	// If a config file is found, read it in.
-	//if err := viper.ReadInConfig(); err == nil {
-	//	fmt.Fprintln(os.Stderr, "Using config file:", viper.ConfigFileUsed())
-	//}
+	if err := viper.ReadInConfig(); err != nil {
+		log.Println("[WARN] config file not loaded: ", err)
+	}
+
+	// the settings of the profile replace the ones of the config file
+	// the commands fail with the error, config set creates a missing profile
+	config, err := readConfigFile(configFile())
+	if err != nil {
+		configErr = err
+		return
+	}
+	name, err := selectedProfile(config)
+	if err != nil {
+		configErr = err
+		return
+	}
+	configErr = applyProfile(viper.GetViper(), name)
+}
+
+// newEnvKeyReplacer returns the replacer of the keys to the environment variables, sonar.java-opts.web is SONAR_JAVA_OPTS_WEB
+func newEnvKeyReplacer() *strings.Replacer {
+	return strings.NewReplacer(".", "_", "-", "_")
 }
 
 // CreateFileInPath Create a file in a path
 func CreateFileInPath(configHome, configPath string) error {
 	// Check if the path does not exist
 	if _, err := os.Stat(configHome); os.IsNotExist(err) {
-		// Create the path
-		err := os.MkdirAll(configHome, 0764)
-		if err != nil {
-			log.Fatal("[ERROR] ", err)
+		// Create the path, only the user can read the folder
+		if err := os.MkdirAll(configHome, 0700); err != nil {
 			return err
 		}
 	}
 
 	// Check if the file exists or not, create if not exists
-	_, err := os.OpenFile(configPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0764)
+	f, err := os.OpenFile(configPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
 	if err != nil {
-		log.Fatal("[ERROR] ", err)
 		return err
 	}
-	return nil
+	return f.Close()
 }
@@ -0,0 +1,170 @@
+/*
+Copyright © 2021 Jose Ramon Mañes jr.mb47@gmail.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/jrmanes/axectl/pkg/container"
+)
+
+// Command struct which contains an info message, command to execute and an array of arguments
+type Command struct {
+	// message provide information about the command to be executed.
+	message string
+	// command base command to execute.
+	command string
+	// args array of arguments of the command.
+	args []string
+	// interactive the command can ask the user, example: the password of sudo
+	interactive bool
+	// input written to the standard input of the command, sudo asks the
+	// password in the terminal
+	input string
+	// env variables added to the environment of the command
+	env []string
+	// out where the output is written instead of the verbose mode, the
+	// containers write the scans and the logs
+	out io.Writer
+}
+
+// Commands list of commands
+type Commands []Command
+
+// String returns the command line
+func (c Command) String() string {
+	return strings.TrimSpace(c.command + " " + strings.Join(c.args, " "))
+}
+
+// Runner executes the commands of the system, the tests use a fake one which
+// records them
+type Runner interface {
+	// Run executes the command, its output is only shown in verbose mode
+	Run(ctx context.Context, c Command) error
+	// Output executes the command and returns its standard output
+	Output(ctx context.Context, c Command) (string, error)
+}
+
+// execRunner is the Runner which executes the commands
+type execRunner struct {
+	// verbose shows the output of the commands, set by --debug
+	verbose bool
+}
+
+// newRunner returns the Runner which executes the commands, with their output when
+// verbose is true, in a dry run the commands are added to the plan
+func newRunner(verbose bool) Runner {
+	if currentPlan != nil {
+		return currentPlan
+	}
+	return execRunner{verbose: verbose}
+}
+
+// command returns the command to execute, the interactive ones use the terminal
+func (r execRunner) command(ctx context.Context, c Command) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, c.command, c.args...)
+	if len(c.env) > 0 {
+		cmd.Env = append(os.Environ(), c.env...)
+	}
+	switch {
+	case c.input != "":
+		cmd.Stdin = strings.NewReader(c.input)
+	case c.interactive:
+		cmd.Stdin = os.Stdin
+	}
+	return cmd
+}
+
+// Run executes the command, the error has its output when it's not shown
+func (r execRunner) Run(ctx context.Context, c Command) error {
+	cmd := r.command(ctx, c)
+
+	var output bytes.Buffer
+	switch {
+	case c.out != nil:
+		cmd.Stdout = c.out
+		cmd.Stderr = c.out
+	case r.verbose:
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+	default:
+		cmd.Stdout = &output
+		cmd.Stderr = &output
+	}
+
+	if err := cmd.Run(); err != nil {
+		return commandError(c, err, output.String())
+	}
+	return nil
+}
+
+// Output executes the command and returns its standard output
+func (r execRunner) Output(ctx context.Context, c Command) (string, error) {
+	cmd := r.command(ctx, c)
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return string(out), commandError(c, err, stderr.String())
+	}
+	return string(out), nil
+}
+
+// cliRunner executes the commands of the container CLI with a Runner
+type cliRunner struct {
+	runner Runner
+}
+
+// Run executes the command writing its output to out
+func (r cliRunner) Run(ctx context.Context, c container.Cmd, out io.Writer) error {
+	return r.runner.Run(ctx, Command{command: c.Name, args: c.Args, env: c.Env, out: out})
+}
+
+// Output executes the command and returns its standard output
+func (r cliRunner) Output(ctx context.Context, c container.Cmd) (string, error) {
+	return r.runner.Output(ctx, Command{command: c.Name, args: c.Args, env: c.Env})
+}
+
+// commandError returns the error of a command with its output
+func commandError(c Command, err error, output string) error {
+	exit := &exec.ExitError{}
+	if msg := strings.TrimSpace(output); msg != "" && errors.As(err, &exit) {
+		return fmt.Errorf("%s: %w: %s", c, err, msg)
+	}
+	return fmt.Errorf("%s: %w", c, err)
+}
+
+// runCommands shows the message of every command and executes it, it stops at
+// the first error, which tells the step that failed
+func runCommands(ctx context.Context, r Runner, commands Commands, out io.Writer) error {
+	for i, c := range commands {
+		if c.message != "" {
+			fmt.Fprintln(out, c.message)
+		}
+		if err := r.Run(ctx, c); err != nil {
+			return fmt.Errorf("step %d of %d failed, %s: %w", i+1, len(commands), c, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,251 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/jrmanes/axectl/pkg/container"
+)
+
+// fakeRunner is a Runner which records the commands and their input, and
+// returns the scripted outputs and errors of the command lines, the other ones succeed
+type fakeRunner struct {
+	mu      sync.Mutex
+	calls   []string
+	inputs  map[string]string
+	outputs map[string]string
+	errors  map[string]error
+}
+
+func (f *fakeRunner) Run(ctx context.Context, c Command) error {
+	_, err := f.Output(ctx, c)
+	return err
+}
+
+func (f *fakeRunner) Output(ctx context.Context, c Command) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls = append(f.calls, c.String())
+	if c.input != "" {
+		if f.inputs == nil {
+			f.inputs = map[string]string{}
+		}
+		f.inputs[c.String()] = c.input
+	}
+	return f.outputs[c.String()], f.errors[c.String()]
+}
+
+// recordRuntime is a container runtime which records what it's asked to do
+// in the calls of a fakeRunner, the containers are run with runErr
+type recordRuntime struct {
+	fakeRuntime
+	runner *fakeRunner
+	runErr error
+}
+
+func (r recordRuntime) record(call string) {
+	r.runner.mu.Lock()
+	defer r.runner.mu.Unlock()
+	r.runner.calls = append(r.runner.calls, call)
+}
+func (r recordRuntime) Up(ctx context.Context, p container.Project, out io.Writer) error {
+	r.record("runtime up " + p.Name)
+	return nil
+}
+func (r recordRuntime) Stop(ctx context.Context, p container.Project) error {
+	r.record("runtime stop " + p.Name)
+	return nil
+}
+func (r recordRuntime) Run(ctx context.Context, spec container.RunSpec, out io.Writer) error {
+	r.record("runtime run " + spec.Image + " " + strings.Join(spec.Args, " "))
+	return r.runErr
+}
+
+// cliRuntime returns the CLI runtime of docker, its commands are recorded by the fakeRunner
+func cliRuntime(r *fakeRunner) container.Runtime {
+	return container.NewCLI(cliRunner{runner: r}, "docker", []string{"docker", "compose"})
+}
+
+// TestExecRunner check the output and the errors of the commands
+func TestExecRunner(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the commands need a shell")
+	}
+	r := newRunner(false)
+
+	out, err := r.Output(context.Background(), Command{command: "sh", args: []string{"-c", "echo axectl"}})
+	if err != nil || out != "axectl\n" {
+		t.Errorf("ERROR: output: %q, %v", out, err)
+	}
+	err = r.Run(context.Background(), Command{command: "sh", args: []string{"-c", "echo broken >&2; exit 3"}})
+	if err == nil || !strings.Contains(err.Error(), "sh -c echo broken >&2; exit 3: exit status 3: broken") {
+		t.Errorf("ERROR: the error has no output: %v", err)
+	}
+}
+
+// fakeSonarStart returns a fake SonarQube which is UP and GREEN, the admin password is valid
+func fakeSonarStart() *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/system/status", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"id":"1","version":"9.2.4.50792","status":"UP"}`)
+	})
+	mux.HandleFunc("/api/system/health", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"health":"GREEN","causes":[]}`)
+	})
+	mux.HandleFunc("/api/authentication/validate", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"valid":true}`)
+	})
+	return httptest.NewServer(mux)
+}
+
+// fakeProcSys returns a /proc/sys with the values of vm.max_map_count and fs.file-max
+func fakeProcSys(t *testing.T, maxMapCount, fileMax string) string {
+	dir := t.TempDir()
+	for _, s := range [][2]string{{"vm/max_map_count", maxMapCount}, {"fs/file-max", fileMax}} {
+		if err := os.MkdirAll(filepath.Join(dir, filepath.Dir(s[0])), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, s[0]), []byte(s[1]+"\n"), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+// TestStartStop check the commands and the containers of start and stop
+func TestStartStop(t *testing.T) {
+	if runtime.GOOS == "darwin" {
+		t.Skip("the system is configured in linux")
+	}
+	srv := fakeSonarStart()
+	defer srv.Close()
+
+	defer func(host, path, pass string, set bool) {
+		sonarHost, filePath, sonarPass, adminPasswordSet = host, path, pass, set
+	}(sonarHost, filePath, sonarPass, adminPasswordSet)
+	sonarHost, filePath, adminPasswordSet = srv.URL, t.TempDir()+"/", true
+	// only vm.max_map_count is too low
+	defer func(dir string, root func() bool) { procSys, isRoot = dir, root }(procSys, isRoot)
+	procSys, isRoot = fakeProcSys(t, "65530", "9223372036854775807"), func() bool { return false }
+
+	r := &fakeRunner{}
+	opts := startOptions{wait: defaultWaitOptions, compose: defaultComposeOptions, runner: r}
+	opts.runtime = cliRuntime(r)
+	project := sonarProject(opts.compose)
+
+	if err := start(context.Background(), opts, io.Discard); err != nil {
+		t.Fatalf("ERROR: start: %v", err)
+	}
+	if err := stop(context.Background(), opts.runtime, project, io.Discard); err != nil {
+		t.Fatalf("ERROR: stop: %v", err)
+	}
+	compose := "docker compose -p " + composeProject + " -f " + filePath + fileName
+	want := []string{"sudo sysctl -w vm.max_map_count=262144", compose + " up -d", compose + " stop"}
+	if strings.Join(r.calls, ",") != strings.Join(want, ",") {
+		t.Errorf("ERROR: calls: %q\nwant: %q", r.calls, want)
+	}
+	if _, err := os.Stat(filePath + fileName); err != nil {
+		t.Errorf("ERROR: the compose file was not written: %v", err)
+	}
+
+	// a generated password is stored before SonarQube uses it, it's never lost
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv(adminPasswordEnv, "")
+	rejected := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/authentication/validate" {
+			fmt.Fprint(w, `{"valid":false}`)
+			return
+		}
+		srv.Config.Handler.ServeHTTP(w, r)
+	}))
+	defer rejected.Close()
+	for _, tt := range []struct {
+		host string
+		err  bool
+	}{{rejected.URL, true}, {srv.URL, false}} {
+		sonarHost, adminPasswordSet = tt.host, false
+		err := start(context.Background(), opts, io.Discard)
+		stored, _ := adminPassword("")
+		if (err != nil) != tt.err || stored == "" || stored != sonarPass {
+			t.Errorf("ERROR: %s: start: %v, stored password: %t", tt.host, err, stored != "")
+		}
+	}
+
+	// the system can't be configured
+	r = &fakeRunner{errors: map[string]error{"sudo sysctl -w vm.max_map_count=262144": errors.New("exit status 1")}}
+	opts.runner, opts.runtime = r, cliRuntime(r)
+	if err := start(context.Background(), opts, io.Discard); err == nil || len(r.calls) != 1 {
+		t.Errorf("ERROR: start without sysctl: %v, %q", err, r.calls)
+	}
+}
+
+// TestScan check the scanner containers of the projects and the failed scans
+func TestScan(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	dir := t.TempDir()
+	for _, p := range []string{"api", "web"} {
+		if err := os.MkdirAll(filepath.Join(dir, p), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := writeToken(p, "squ_"+p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+	// the sources are mounted without the SELinux label
+	defer func(file string) { selinuxEnforce = file }(selinuxEnforce)
+	selinuxEnforce = filepath.Join(dir, "enforce")
+	if dir, err = os.Getwd(); err != nil {
+		t.Fatal(err)
+	}
+
+	r := &fakeRunner{}
+	opts := scanOptions{projects: []string{"api", "web"}, parallel: 1, runtime: cliRuntime(r)}
+	if err := scan(context.Background(), opts, io.Discard); err != nil {
+		t.Fatalf("ERROR: scan: %v", err)
+	}
+	want := []string{scanCommand(dir, "api"), scanCommand(dir, "web")}
+	if strings.Join(r.calls, "\n") != strings.Join(want, "\n") {
+		t.Errorf("ERROR: calls:\n%s\nwant:\n%s", strings.Join(r.calls, "\n"), strings.Join(want, "\n"))
+	}
+
+	// a failed scanner or a project without token fail the scan
+	r = &fakeRunner{errors: map[string]error{scanCommand(dir, "api"): &container.ExitError{Code: 2}}}
+	opts.runtime = cliRuntime(r)
+	if err := scan(context.Background(), opts, io.Discard); !errors.Is(err, errScanFailed) {
+		t.Errorf("ERROR: failed scanner: %v", err)
+	}
+	opts.runtime, opts.projects = cliRuntime(&fakeRunner{}), []string{"worker"}
+	if err := scan(context.Background(), opts, io.Discard); !errors.Is(err, errScanFailed) {
+		t.Errorf("ERROR: project without token: %v", err)
+	}
+	opts.parallel = 0
+	if err := scan(context.Background(), opts, io.Discard); err == nil {
+		t.Errorf("ERROR: --parallel 0 accepted")
+	}
+}
+
+// scanCommand returns the docker command of the scanner of the project in the
+// folder src of the local SonarQube, the token is in the environment
+func scanCommand(src, project string) string {
+	return "docker run --rm --network=" + sonarNetwork + " -e SONAR_HOST_URL=" + sonarInternalHost + " -e SONAR_TOKEN -v " + src + "/:/usr/src " + scannerImage +
+		" -Dsonar.projectKey=" + project + " -Dsonar.projectName=" + project + " -Dsonar.projectVersion=1.0 -Dsonar.sources=./" + project +
+		" -Dsonar.working.directory=.scannerwork/" + project + " -Dsonar.scm.disabled=true -Dsonar.host.url=" + sonarInternalHost
+}
@@ -16,50 +16,28 @@ limitations under the License.
 package cmd
 
 import (
-	"bufio"
-	"encoding/json"
-	"flag"
+	"context"
+	"errors"
 	"fmt"
-	"io/ioutil"
+	"io"
 	"log"
-	"net/http"
 	"net/url"
 	"os"
 	"os/exec"
-	"os/user"
+	"path"
 	"path/filepath"
 	"runtime"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/jrmanes/axectl/pkg/container"
+	"github.com/jrmanes/axectl/pkg/credstore"
+	"github.com/jrmanes/axectl/pkg/sonarapi"
 	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
 )
 
-// Command struct which contains an info message, command to execute and an array of arguments
-type Command struct {
-	// message provide information about the command to be executed.
-	message string
-	// command base command to execute.
-	command string
-	// args array of arguments of the command.
-	args []string
-}
-
-// Commands list of commands
-type Commands []Command
-
-// TokenResponse is the struct that we use for our Sonar responses
-type TokenResponse struct {
-	// Login kind of login
-	Login string `json:"login"`
-	// Name of the token
-	Name string `json:"name"`
-	// Token value of the token
-	Token string `json:"token"`
-	// CreatedAt timestamp about the creation
-	CreatedAt string `json:"createdAt"`
-}
-
 // sonarCmd represents the sonar command
 var sonarCmd = &cobra.Command{
 	Use:   "sonar",
@@ -79,52 +57,35 @@ Features:
 -----------------------------------------------------------------------------------------
 USAGE Examples:
 
-Go to the parent folder, or specify the package name separated by comas.
-There are different options for sonar:
 - Install needed packages (not needed if you have Docker & docker-compose installed in your system):
 
-axectl sonar -i
-
-- Start the service, creating the projects and scan them:
-
-axectl sonar -s -c --scan -p "someProject" -o "someOrganization"
+axectl sonar install
 
-Or specify multiple packages separated by comas:
+- Start the service, create the projects and scan them from their parent folder:
 
-axectl sonar -s -c --scan -p "someProject1,someProjet2,someProject3" -o "someOrganization"
+axectl sonar up
+axectl sonar project create someProject1 someProject2 -o "someOrganization"
+axectl sonar scan someProject1 someProject2
 
-- Start the service
-
-axectl sonar -s -p "someProject" -o "someOrganization"
+- Check the status of the service
 
-- Start the service creating the projects
+axectl sonar status
 
-axectl sonar -s -c -p "someProject" -o "someOrganization"
+- Stop the service
 
-- Check the status of the service
+axectl sonar down
 
-axectl sonar --status
+The old flags (-i, -s, -c, --scan, --status, --stop) still work, but they are deprecated.
 -----------------------------------------------------------------------------------------`,
-	// Validate if there is any flag added, if not, we send the user to Usage func
-	PreRunE: func(cmd *cobra.Command, args []string) error {
-		// parse flags
-		flag.Parse()
-		tail := flag.Args()
-		// check if we have less than one args
-		if len(tail) <= 1 {
-			// show usage
-			cmd.Usage()
-			// exit with error 0
-			os.Exit(0)
-		}
-		return nil
-	},
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
 		// Call StartSonar in order to initialize all the values
-		StartSonar(cmd)
+		return StartSonar(cmd)
 	},
 }
 
+// defaultSonarHost url of the SonarQube started by axectl
+const defaultSonarHost = "http://localhost:9000"
+
 // define vars
 var (
 	// filePath where we will store the file
@@ -133,13 +94,19 @@ var (
 	fileName = "docker-compose.piktochart-sonarqube"
 	// sonarUser default user admin name
 	sonarUser = "admin"
-	// sonarPass default user admin password to use
-	sonarPass = "admin123."
-	// tokensFolder folder where to store the tokens
-	tokensFolder = "/.axectl/sonar/tokens/"
+	// sonarPass password of the admin user, from --admin-password, the environment or the credential store
+	sonarPass string
+	// sonarHost url of the SonarQube server, it can be changed with --host or sonar.host in the config file
+	sonarHost = defaultSonarHost
+	// composeProject name given by docker-compose to the project, the folder of the file
+	composeProject = "tmp"
+	// sonarNetwork docker network created by docker-compose where SonarQube is running
+	sonarNetwork = composeProject + "_sonar"
+	// sonarInternalHost url of SonarQube inside the sonarNetwork
+	sonarInternalHost = "http://sonarqube:9000"
 	// dockerCompose docker-compose name
-	dockerCompose            = "docker-compose"
-	project, organization, u string
+	dockerCompose = "docker-compose"
+	u             string
 )
 
 // init add al flags to the sonarCmd command
@@ -147,588 +114,592 @@ func init() {
 	// add sonarCmd command to rootCmd
 	rootCmd.AddCommand(sonarCmd)
 
-	// Here you will define your flags and configuration settings.
-	sonarCmd.PersistentFlags().BoolP("install", "i", true, "Install all requirements needed")
-	sonarCmd.PersistentFlags().BoolP("scan", "", true, "Scan a project")
-	sonarCmd.PersistentFlags().BoolP("create", "c", true, "Create a project and tokens")
-	sonarCmd.PersistentFlags().StringP("organization", "o", "", "Organization in SonarQube")
-	sonarCmd.PersistentFlags().StringP("project", "p", "", "You can add one project name or multiple separated by comas.")
-	sonarCmd.PersistentFlags().BoolP("start", "s", true, "Start running the SonarQube container")
-	sonarCmd.PersistentFlags().BoolP("stop", "", true, "Stop the SonarQube container")
-	sonarCmd.PersistentFlags().BoolP("status", "", true, "Check the docker container status")
-	sonarCmd.PersistentFlags().StringP("user", "u", "admin:admin123.", "Use your user:password  -> Example: admin:admin123.")
+	// flags shared by all the subcommands
+	sonarCmd.PersistentFlags().StringP("user", "u", "", "Use your user:password, the command line is visible to the other users, prefer sonar.user and "+adminPasswordEnv)
 	sonarCmd.PersistentFlags().BoolP("debug", "d", false, "Set debug option")
+	sonarCmd.PersistentFlags().StringP("host", "", defaultSonarHost, "SonarQube url, the local containers are not started when it's a remote server")
+	sonarCmd.PersistentFlags().StringP("admin-password", "", "", "Password to set to the admin user on start, by default "+adminPasswordEnv+" or a generated one kept in the credential store")
+	sonarCmd.PersistentFlags().BoolP("dry-run", "", false, "Print the commands, HTTP requests and files the command would run, send and write, without doing it. The commands which only read, like status, run as usual")
+	sonarCmd.PersistentFlags().BoolP("plan", "", false, "Same as --dry-run, use it with --plan-output json to review the plan")
+	sonarCmd.PersistentFlags().StringP("plan-output", "", planText, "Format of the plan of --dry-run and --plan: text or json")
+
+	// the host can be set in the config file too: sonar.host
+	viper.SetDefault("sonar.host", defaultSonarHost)
+	cobra.CheckErr(viper.BindPFlag("sonar.host", sonarCmd.PersistentFlags().Lookup("host")))
+
+	// the old flags, before the subcommands
+	for _, l := range legacyActions {
+		sonarCmd.Flags().BoolP(l.flag, l.shorthand, false, l.usage)
+		cobra.CheckErr(sonarCmd.Flags().MarkDeprecated(l.flag, "use: axectl sonar "+l.command))
+	}
+	sonarCmd.Flags().StringP("organization", "o", "", "Organization in SonarQube")
+	sonarCmd.Flags().StringP("project", "p", "", "You can add one project name or multiple separated by comas.")
+	cobra.CheckErr(sonarCmd.Flags().MarkDeprecated("organization", "use: axectl sonar project create <project>... -o <organization>"))
+	cobra.CheckErr(sonarCmd.Flags().MarkDeprecated("project", "pass the projects as arguments of the subcommands"))
+	addScanFlags(sonarCmd)
+	addWaitFlags(sonarCmd)
+	for _, f := range []string{"coverage", "wait-gate", "target-branch", "pull-request", "branch-analysis", "parallel", "wait-timeout", "wait-interval"} {
+		cobra.CheckErr(sonarCmd.Flags().MarkHidden(f))
+	}
+	planCommand(sonarCmd)
 }
 
-// StartSonar initialize all the subcommands and detect the arguments
-func StartSonar(cmd *cobra.Command) {
-	// organization - get the organization flag value
-	organization, _ = cmd.Flags().GetString("organization")
-	// project - get the project flag value
-	project, _ = cmd.Flags().GetString("project")
-	// debug - get the debug flag value
-	debug := cmd.Flags().Changed("debug")
+// legacyAction is an old flag which runs a subcommand
+type legacyAction struct {
+	// flag name
+	flag string
+	// shorthand of the flag
+	shorthand string
+	// usage of the flag
+	usage string
+	// command which replaces the flag
+	command string
+}
 
-	// check if the user and password were provided
-	if cmd.Flags().Changed("user") {
-		// assign the value from the argument to the var
-		u, _ = cmd.Flags().GetString("user")
-		// split the string in the colons
-		userData := strings.Split(u, ":")
-		fmt.Println("ℹ️ New user config:", u)
-		fmt.Println("ℹ️ New user data:", userData)
+// legacyActions the old flags in the order they are executed
+var legacyActions = []legacyAction{
+	{"install", "i", "Install all requirements needed", "install"},
+	{"start", "s", "Start running the SonarQube container", "up"},
+	{"create", "c", "Create a project and tokens", "project create"},
+	{"scan", "", "Scan a project", "scan"},
+	{"status", "", "Check the docker container status", "status"},
+	{"stop", "", "Stop the SonarQube container", "down"},
+}
 
-		// add the first and second value to the variables
-		sonarUser = userData[0]
-		sonarPass = userData[1]
+// StartSonar runs the subcommands of the old flags, in the order of legacyActions
+func StartSonar(cmd *cobra.Command) error {
+	flags := cmd.Flags()
+
+	// without any action there is nothing to do
+	var actions []string
+	for _, l := range legacyActions {
+		if run, _ := flags.GetBool(l.flag); run {
+			actions = append(actions, l.flag)
+		}
+	}
+	if len(actions) == 0 {
+		return cmd.Help()
+	}
 
-		fmt.Println("New user config:", sonarUser, sonarPass)
+	organization, _ := flags.GetString("organization")
+	if !flags.Changed("organization") {
+		organization = viper.GetString("sonar.organization")
 	}
-	// check if the install flag has change, execute install function and send the value of the debug
-	if cmd.Flags().Changed("install") {
-		install(debug)
+	project, _ := flags.GetString("project")
+	projects := projectList(project)
+	if !flags.Changed("project") {
+		projects = projectList(strings.Join(viper.GetStringSlice("sonar.projects"), ","))
 	}
-	// check if the start flag has change, execute start function
-	if cmd.Flags().Changed("start") {
-		start()
+
+	// load the SonarQube host and credentials
+	if err := loadSonarConfig(cmd); err != nil {
+		return err
 	}
+
 	// validates the organization and project flags values
-	if cmd.Flags().Changed("organization") || cmd.Flags().Changed("project") {
+	if flags.Changed("organization") || flags.Changed("project") {
 		if organization == "" || project == "" {
 			fmt.Println("[ERROR] 🔥 Organization needs to be set, use parameter: -o ")
 		}
 	}
-	// check if the create flag has change, execute create function
-	if cmd.Flags().Changed("create") {
-		createProject()
-		createProjectToken()
-	}
-	// check if the scan flag has change
-	if cmd.Flags().Changed("scan") {
-		scan()
-	}
-	if cmd.Flags().Changed("status") {
-		status()
-	}
-	if cmd.Flags().Changed("stop") {
-		stop()
+
+	for _, action := range actions {
+		if err := runLegacyAction(cmd, action, projects, organization); err != nil {
+			return err
+		}
 	}
+	return nil
 }
 
-// install the needed software
-func install(debug bool) {
-	switch os := detectOS(); os {
-	case "darwin":
-		MacOSPkg(debug)
-	case "linux":
-		LinuxPkg(debug)
-	default:
-		LinuxPkg(debug)
+// runLegacyAction runs the subcommand of an old flag
+func runLegacyAction(cmd *cobra.Command, action string, projects []string, organization string) error {
+	ctx := context.Background()
+
+	switch action {
+	case "install":
+		debug, _ := cmd.Flags().GetBool("debug")
+		return install(ctx, newRunner(debug), actionOutput())
+	case "start":
+		opts, err := startFlags(cmd)
+		if err != nil {
+			return err
+		}
+		return start(ctx, opts, actionOutput())
+	case "create":
+		if err := createProject(projects, organization, actionOutput()); err != nil {
+			return err
+		}
+		return createProjectToken(projects, actionOutput())
+	case "scan":
+		opts := scanFlags(cmd)
+		opts.projects = projects
+		rt, err := containerRuntime()
+		if err != nil {
+			return err
+		}
+		opts.runtime = rt
+		return scan(ctx, opts, actionOutput())
+	case "status":
+		return status(actionOutput())
+	case "stop":
+		rt, project, err := managedRuntime()
+		if err != nil {
+			return err
+		}
+		return stop(ctx, rt, project, actionOutput())
 	}
-	// Install Linux Requirements
+	return nil
 }
 
-// LinuxPkg Install needed SonarQube packages for Linux environments
-func LinuxPkg(debug bool) {
-	// create a list with all the packages needed
-	packages := []string{
-		"docker",
-		dockerCompose,
+// loadSonarConfig set the SonarQube host and credentials from the flags, the config file and the environment
+func loadSonarConfig(cmd *cobra.Command) error {
+	// sonarHost - get the host from the flag or the config file
+	sonarHost = strings.TrimRight(viper.GetString("sonar.host"), "/")
+	// the local SonarQube can be published in another port
+	if sonarHost == defaultSonarHost && viper.GetInt("sonar.port") != defaultComposeOptions.Port {
+		sonarHost = "http://localhost:" + strconv.Itoa(viper.GetInt("sonar.port"))
 	}
 
-	// Update the package list
-	fmt.Println("📦 Update package list... ")
-	cmd := exec.Command("sudo", "apt", "update")
-	if debug {
-		cmd.Stdin = os.Stdin
-		cmd.Stdout = os.Stdout
+	// the user and the environment variable with its password can be set in the profile
+	if user := viper.GetString("sonar.user"); user != "" {
+		sonarUser = user
 	}
-	err := cmd.Run()
+
+	// get the admin password from the flag, the profile, the environment or the stored one
+	password, _ := cmd.Flags().GetString("admin-password")
+	if env := viper.GetString("sonar.password-env"); password == "" && env != "" {
+		password = os.Getenv(env)
+	}
+	password, err := adminPassword(password)
 	if err != nil {
-		log.Fatal(err)
+		return err
+	}
+	if password != "" {
+		sonarPass = password
+		adminPasswordSet = true
 	}
 
-	// Loop inside all packages and install them one by one
-	for _, p := range packages {
-		fmt.Println("📦 Installing package: ", "[", p, "]")
-
-		cmd := exec.Command("sudo", "apt", "install", "-y", p)
-		if debug {
-			cmd.Stdin = os.Stdin
-			cmd.Stdout = os.Stdout
-
-		}
-		err := cmd.Run()
-		if err != nil {
-			log.Fatal(err)
-		} else {
-			fmt.Println("✅", "[", p, "]", "-> successfully installed!")
+	// check if the user and password were provided
+	if cmd.Flags().Changed("user") {
+		// assign the value from the argument to the var
+		u, _ = cmd.Flags().GetString("user")
+		// split the string in the first colon, the password can have more of them
+		userData := strings.SplitN(u, ":", 2)
+		if len(userData) != 2 || userData[0] == "" {
+			return errors.New("the user must be user:password")
 		}
-	}
 
-	// Configure system
-	err = LinuxConfigSystem(debug)
-	if err != nil {
-		log.Fatal(err)
+		// add the first and second value to the variables, the password is never printed
+		sonarUser = userData[0]
+		sonarPass = userData[1]
+		adminPasswordSet = true
+
+		fmt.Fprintln(actionOutput(), "ℹ️ Using the user:", sonarUser)
 	}
+	return nil
 }
 
-// MacOSPkg Install needed SonarQube packages for MacOS environments
-func MacOSPkg(debug bool) {
-	// create a list with all the packages needed
-	packages := []string{
-		"docker",
-		dockerCompose,
-	}
+// status check the status of the containers and the server
+func status(out io.Writer) error {
+	return renderStatusTable(out, sonarStatusReport())
+}
 
-	// Loop inside all packages and install them one by one
-	for _, p := range packages {
-		fmt.Println("📦 Installing package: ", p)
+// scanOptions are the settings of the scans
+type scanOptions struct {
+	// coverage files provided with --coverage
+	coverage []string
+	// projects all the projects being scanned
+	projects []string
+	// reports coverage files with their format, relative to the current path
+	reports []coverageReport
+	// waitGate waits for the quality gate after every scan
+	waitGate bool
+	// wait timeout and interval to wait for the quality gate
+	wait waitOptions
+	// runtime runs the scanner container
+	runtime container.Runtime
+	// parallel number of projects scanned at the same time
+	parallel int
+	// keys of the projects by folder, the folder is the key when it's not there
+	keys map[string]string
+	// targetBranch branch the new code is compared with, the default one when it's empty
+	targetBranch string
+	// pullRequest key of the pull request analysed, the current branch is its source
+	pullRequest string
+	// branchAnalysis sends the branch and pull request settings
+	branchAnalysis bool
+}
 
-		cmd := exec.Command("sudo", "brew", "install", p)
-		if debug {
-			cmd.Stdin = os.Stdin
-			cmd.Stdout = os.Stdout
+// errScanFailed is returned when the scan or the quality gate of a project failed, the summary has the details
+var errScanFailed = errors.New("the scan of some projects failed")
+
+// startOptions how to start SonarQube
+type startOptions struct {
+	// wait timeout and interval to wait until SonarQube is ready
+	wait waitOptions
+	// compose settings of the containers
+	compose composeOptions
+	// runtime starts the containers, it's not used with a remote SonarQube
+	runtime container.Runtime
+	// runner configures the system
+	runner Runner
+	// persistSysctl keeps the kernel settings of SonarQube across reboots
+	persistSysctl bool
+}
 
-		}
-		err := cmd.Run()
-		if err != nil {
-			log.Fatal(err)
-		} else {
-			fmt.Println("✅ ", p, " -> successfully installed!")
-		}
-	}
+// scanProject is a project to scan
+type scanProject struct {
+	// key of the project in SonarQube
+	key string
+	// dir folder of the project, relative to the current path
+	dir string
+	// token used by the scanner
+	token string
+	// settings from the sonar-project.properties of the project, nil when it doesn't exist
+	settings map[string]string
+	// git repository of the project, nil when it's not in a checkout
+	git *gitInfo
 }
 
-// LinuxConfigSystem Configure system to execute SonarQube in Linux
-func LinuxConfigSystem(debug bool) error {
-	fmt.Println("\nℹ️  More info: https://docs.docker.com/engine/install/linux-postinstall/")
-	// get current user
-	user, err := user.Current()
+// scan check every project and scan it on sonar, it fails when the scan or
+// the quality gate of a project fails
+func scan(ctx context.Context, opts scanOptions, out io.Writer) error {
+	// set the current time
+	now := time.Now()
+	fmt.Fprintln(out, "🔭 Scanning projects...")
+
+	// get the current path, it's mounted in the scanner container
+	path, err := os.Getwd()
 	if err != nil {
 		return err
 	}
+	// detect the format of the coverage files
+	opts.reports, err = parseCoverageReports(path, opts.coverage)
+	if err != nil {
+		return err
+	}
+	for _, r := range opts.reports {
+		fmt.Fprintln(out, "📊 Coverage report: ", r.path, "[", r.format, "]")
+	}
+	for _, w := range coverageWarnings(opts.projects, opts.reports) {
+		fmt.Fprintln(out, "⚠️ "+w)
+	}
 
-	// commands list of commands to execute
-	commands := Commands{
-		Command{
-			message: "📦 Add docker group to the user: " + user.Username,
-			command: "sudo",
-			args:    []string{"usermod", "-aG", "docker", user.Username},
-		},
-		Command{
-			message: "📦 Activate the changes to the user's groups: " + user.Username,
-			command: "newgrp",
-			args:    []string{"docker"},
-		},
-	}
-
-	// loop inside all the commands to execute
-	for _, c := range commands {
-		fmt.Println(c.message)
-		c := exec.Command(c.command, c.args...)
-		if debug {
-			c.Stdin = os.Stdin
-			c.Stdout = os.Stdout
-		}
-		err = c.Run()
-		if err != nil {
-			return err
-		}
+	if opts.parallel < 1 {
+		return errors.New("--parallel must be at least 1")
+	}
+	logs, err := scanLogsPath()
+	if err != nil {
+		return err
 	}
 
-	fmt.Println("\nℹ️  In order to refresh your user with the Docker group, you have two options:")
-	fmt.Println("ℹ️  1: Execute the following command: newgrp docker")
-	fmt.Println("ℹ️  2: Or logout/login")
-	fmt.Println("\n✅ All packages have been installed successfully!")
+	results := scanProjects(ctx, opts.projects, opts.parallel, logs, out, func(ctx context.Context, p string, out io.Writer) (*sonarapi.ProjectStatus, error) {
+		return scanOne(ctx, path, p, opts, out)
+	})
 
+	// show how long it takes
+	fmt.Fprintln(out, "---------------------------- ")
+	passed := printScanSummary(out, results)
+	fmt.Fprintln(out, "Elapse: ", time.Since(now))
+	fmt.Fprintln(out, "---------------------------- ")
+
+	if !passed {
+		// the progress of a dry run is discarded, the plan is written to the standard output
+		if currentPlan != nil {
+			printScanSummary(os.Stderr, results)
+		}
+		return errScanFailed
+	}
 	return nil
 }
 
-// status check the status of the containers
-func status() {
-	cmd := exec.Command("docker", "ps", "-a")
+// scanOne scans the project in the folder p of path and waits for its
+// quality gate when it's requested, the output is written to out
+func scanOne(ctx context.Context, path, p string, opts scanOptions, out io.Writer) (*sonarapi.ProjectStatus, error) {
+	var err error
+	sp := scanProject{key: p, dir: p}
+	if key, ok := opts.keys[p]; ok {
+		sp.key = key
+	}
 
-	cmd.Stdin = os.Stdin
-	cmd.Stdout = os.Stdout
+	// get token value if exists
+	sp.token, err = readToken(sp.key)
+	if errors.Is(err, credstore.ErrNotFound) {
+		return nil, errors.New("there is no token for the project " + sp.key + ", create it with: axectl sonar project create " + p)
+	}
+	if err != nil {
+		return nil, err
+	}
 
-	err := cmd.Run()
+	// use the settings of the project when it has them
+	sp.settings, err = readProperties(filepath.Join(p, propertiesFile))
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
-}
 
-// scan check every project and scan it on sonar
-func scan() {
-	// set the current time
-	now := time.Now()
-	fmt.Println("🔭 Scanning projects...")
-	// get the projects from the argument and split each by ,
-	projects := strings.Split(project, ",")
-	// crate the project in SQ
-	for _, p := range projects {
-		fmt.Println("🔭 Scanning project...", p)
-		out, err := exec.Command("pwd").Output()
-		if err != nil {
-			log.Fatal(err)
+	// the branch, revision and version of the project
+	sp.git = readGit(filepath.Join(path, p), opts.targetBranch)
+	if sp.git == nil {
+		fmt.Fprintln(out, "⚠️ "+p+" is not in a git checkout, SCM disabled")
+	} else {
+		sp.git.scm = insideFolder(sp.git.root, path)
+		if !sp.git.scm {
+			fmt.Fprintln(out, "⚠️ The git repository "+sp.git.root+" is outside of "+path+", SCM disabled")
 		}
-		path := string(out)
-
-		strings.Replace(path, `\n`, "\n", -1)
-
-		// get token value if exists
-		token, err := GetTokenInFile(p)
-		if err != nil {
-			log.Fatal(err)
+		fmt.Fprintln(out, "🌿 Branch: ["+sp.git.branch+"], revision: "+sp.git.sha+", version: "+sp.git.version()+", target: ["+sp.git.target+"]")
+	}
+	if sp.settings != nil {
+		fmt.Fprintln(out, "📝 Using the settings in", filepath.Join(p, propertiesFile))
+		if key, ok := sp.settings["sonar.projectKey"]; ok && key != sp.key {
+			fmt.Fprintln(out, "⚠️ The project key in "+propertiesFile+" is ["+key+"] instead of ["+sp.key+"]")
 		}
+	}
 
-		// removed last character - new line
-		path = path[:len(path)-1]
+	err = SonarScanner(ctx, sp, opts, out)
+	if err != nil {
+		return nil, err
+	}
 
-		err = SonarScanner(p, token)
-		if err != nil {
-			log.Fatal(err)
-		}
+	// check the quality gate of the analysis, a dry run has no analysis to check
+	if !opts.waitGate || currentPlan != nil {
+		return nil, nil
 	}
-	// show how long it takes
-	fmt.Println("---------------------------- ")
-	fmt.Println("Elapse: ", time.Since(now))
-	fmt.Println("---------------------------- ")
+	return waitForGate(ctx, newSonarClient(), reportTaskFile(path, sp), opts.wait, out)
 }
 
-// SonarScanner executes the scanner of code
-func SonarScanner(p, token string) error {
+// SonarScanner executes the scanner of code, its output is written to out
+func SonarScanner(ctx context.Context, sp scanProject, opts scanOptions, out io.Writer) error {
 	// get the current path
 	path, err := os.Getwd()
 	if err != nil {
-		log.Println(err)
+		return err
 	}
 
-	command := `docker run \
---rm \
---network=tmp_sonar \
--e SONAR_HOST_URL="http://sonarqube:9000" \
--v ` + path + `/:/usr/src sonarsource/sonar-scanner-cli \
--Dsonar.projectKey=` + p + ` \
--Dsonar.sonar.projectName=` + p + ` \
--Dsonar.sonar.projectVersion=1.0 \
--Dsonar.sources=./` + p + ` \
--Dsonar.scm.disabled=true \
--Dsonar.sonar.host.url=http://sonarqube:9000 \
--Dsonar.login=` + token
-
-	cmd := exec.Command("bash", "-c", command)
-
-	cmd.Stdin = os.Stdin
-	cmd.Stdout = os.Stdout
+	return opts.runtime.Run(ctx, scannerSpec(path, sp, opts), out)
+}
 
-	err = cmd.Run()
-	if err != nil {
-		log.Fatal(err)
+// scannerArgs returns the arguments of the sonar-scanner for the project
+func scannerArgs(sp scanProject, opts scanOptions) []string {
+	var args []string
+
+	// the sonar-project.properties of the project is used from its folder
+	sources := "./" + sp.dir
+	if sp.settings != nil {
+		base := path.Join(scannerMount, filepath.ToSlash(sp.dir))
+		args = append(args,
+			"-Dsonar.projectBaseDir="+base,
+			"-Dproject.settings="+path.Join(base, propertiesFile),
+		)
+		sources = "."
+	}
+
+	// the default settings, unless the project has its own
+	defaults := [][2]string{
+		{"sonar.projectKey", sp.key},
+		{"sonar.projectName", sp.key},
+		{"sonar.projectVersion", sp.git.version()},
+		{"sonar.sources", sources},
+		{"sonar.working.directory", workingDirectory(sp)},
+	}
+	defaults = append(defaults, gitSettings(sp.git, opts)...)
+	for _, d := range defaults {
+		if _, ok := sp.settings[d[0]]; !ok {
+			args = append(args, "-D"+d[0]+"="+d[1])
+		}
 	}
 
-	return nil
+	// the token is passed in SONAR_TOKEN, see scannerSpec
+	args = append(args, "-Dsonar.host.url="+scannerHost())
+
+	return append(args, coverageArgs(sp.dir, opts.projects, opts.reports)...)
 }
 
-// start configure and initialize the containers
-func start() {
-	fmt.Println("🚢 We are starting the setup process... this can take some seconds...")
+// start configure and initialize the containers, then waits until SonarQube is ready
+func start(ctx context.Context, opts startOptions, out io.Writer) error {
+	// a remote SonarQube is already running, there is nothing to start
+	if !isLocalHost(sonarHost) {
+		fmt.Fprintln(out, "🌍 Using the SonarQube at "+sonarHost+", skipping the local containers")
+		return waitForSonar(ctx, newSonarClient(), opts.wait, out)
+	}
+
+	fmt.Fprintln(out, "🚢 We are starting the setup process... this can take some seconds...")
 	// configure the system needs
-	ConfigureSystem()
+	if err := ConfigureSystem(ctx, opts.runner, opts.runtime, opts.persistSysctl, out); err != nil {
+		return err
+	}
 
 	// get the docker compose file
-	dockerComposeFile := dockerComposeFile()
-	fileName := CreateFileWithContent(filePath+fileName, dockerComposeFile)
-
-	cmd := exec.Command(dockerCompose, "-f", filePath+fileName, "up", "-d")
-
-	cmd.Stdin = os.Stdin
-	cmd.Stdout = os.Stdout
-
-	err := cmd.Run()
+	dockerComposeFile, err := dockerComposeFile(opts.compose)
 	if err != nil {
-		log.Fatal("Please, check that your current user is in the Docker group or you are not using the ports 9000,5432 in your computer\n", err)
+		return err
 	}
-
-	// Give enough time to allow the service start
-	fmt.Println("🚢 SonarQube is starting, wait some seconds...")
-
-	// emojis clocks
-	timeEmoji := []string{"🕐", "🕑", "🕓", "🕔", "🕔", "🕕", "🕖", "🕗", "🕘"}
-
-	// look throughout the clocks
-	for i := 0; i < len(timeEmoji); i++ {
-		fmt.Printf(timeEmoji[i])
-		time.Sleep(1 * time.Second)
+	if err := writeFile(filePath+fileName, []byte(dockerComposeFile), 0644); err != nil {
+		return err
 	}
+	fmt.Fprintln(out, "📦 Using the images "+opts.compose.Image()+" and "+opts.compose.PostgresImage())
+	fmt.Fprintln(out, "🐳 Container runtime: "+opts.runtime.Name())
 
-	fmt.Println("\n🚧 Please, open the following link and change the password when the service will be up")
-	fmt.Println("👤 Default user [" + sonarUser + ":admin]")
-	fmt.Println("⚠️ http://localhost:9000/")
-	fmt.Println("\n🚨 RECOMMENDATION: \n⚠️ Change the password to: " + "[" + sonarPass + "], otherwise, you will have to use the flag -> [user] - to provide the password")
-	fmt.Println("⚠️ Press enter once you have change the password... ")
-
-	// wait until confirmation
-	buf := bufio.NewReader(os.Stdin)
-	fmt.Print("> ")
-	_, err = buf.ReadBytes('\n')
+	project := sonarProject(opts.compose)
+	err = opts.runtime.Up(ctx, project, out)
 	if err != nil {
-		fmt.Println(err)
+		ports := strconv.Itoa(opts.compose.Port)
+		if opts.compose.PostgresPort != 0 {
+			ports += "," + strconv.Itoa(opts.compose.PostgresPort)
+		}
+		return fmt.Errorf("%w\nPlease, check that your current user is in the Docker group or you are not using the ports %s in your computer, axectl sonar doctor checks all the requirements", err, ports)
 	}
 
-	fmt.Println("🙉 SonarQube is up an running!")
-}
-
-// stop the docker-compose containers
-func stop() {
-	fmt.Println("Stopping SonarQube...")
-	cmd := exec.Command(dockerCompose, "-f", filePath+fileName, "stop")
+	// Wait until the service is ready
+	fmt.Fprintln(out, "🚢 SonarQube is starting, it can take a couple of minutes...")
+	ctx, cancel := context.WithTimeout(ctx, opts.wait.timeout)
+	defer cancel()
+	err = waitForStatus(ctx, newSonarClient(), opts.wait, out)
+	if err != nil {
+		// the last logs of SonarQube usually tell why it didn't start
+		fmt.Fprintln(out, "📜 Last logs of SonarQube:")
+		if err := opts.runtime.Logs(context.Background(), project, "sonarqube", container.LogsOptions{Tail: 50}, out); err != nil {
+			fmt.Fprintln(out, "⚠️ The logs are not available: ", err)
+		}
+		return err
+	}
 
-	cmd.Stdin = os.Stdin
-	cmd.Stdout = os.Stdout
+	// replace the default password of the admin user, the first time a new one
+	// is generated, it's stored before SonarQube uses it, a stored password which
+	// was never applied replaces the default one in the next start
+	if !adminPasswordSet {
+		sonarPass, err = generatePassword(24)
+		if err != nil {
+			return err
+		}
+		if err := storeAdminPassword(sonarPass); err != nil {
+			return fmt.Errorf("the new password of the user [%s] can't be stored: %w", sonarUser, err)
+		}
+		adminPasswordSet = true
+		store, err := secretStore()
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(out, "🔑 A new password for the user ["+sonarUser+"] has been stored in the "+store.Name())
+	}
+	err = ensureAdminPassword(ctx, sonarHost, sonarUser, sonarPass, out)
+	if err != nil {
+		return err
+	}
 
-	err := cmd.Run()
+	err = waitForHealth(ctx, newSonarClient(), opts.wait, out)
 	if err != nil {
-		panic(err)
+		return err
 	}
 
-	fmt.Println("👋 SonarQube is stopped!")
+	fmt.Fprintln(out, "👤 Login at "+sonarHost+"/ with the user ["+sonarUser+"]")
+	fmt.Fprintln(out, "🙉 SonarQube is up an running!")
+	return nil
 }
 
-// ConfigureSystem set the needed path to the sysctl
-// https: //docs.sonarqube.org/latest/requirements/requirements/
-func ConfigureSystem() {
-	fmt.Println("Starting the containers, it can take a while...")
-	fmt.Println("🔧 We need going to configuring the system: \n\t https://docs.sonarqube.org/latest/requirements/requirements/ \n\t sysctl to -> vm.max_map_count=262144")
-	fmt.Println("🔓 We need to run as ROOT...")
-
-	// check the os and configure depending on which one is
-	switch o := detectOS(); o {
-	case "darwin":
-		fmt.Println("TODO: Development pending for MacOS...")
-	case "linux":
-		cmd := exec.Command("sudo", "sysctl", "-w", "vm.max_map_count=262144")
-		cmd.Stdin = os.Stdin
-		err := cmd.Run()
-		if err != nil {
-			panic(err)
-		}
-	default:
-		fmt.Println("Not OS detected...")
+// stop the docker-compose containers
+func stop(ctx context.Context, rt container.Runtime, project container.Project, out io.Writer) error {
+	// the containers of a remote SonarQube are not managed by axectl
+	if !isLocalHost(sonarHost) {
+		fmt.Fprintln(out, "🌍 The SonarQube at "+sonarHost+" is remote, nothing to stop")
+		return nil
 	}
-}
 
-// dockerComposeFile returns all the data inside the docker-compose.yml file
-func dockerComposeFile() string {
-	var dockerFile string
-
-	switch o := detectOS(); o {
-	case "darwin":
-		dockerFile = `
-version: "3"
-services:
-  sonarqube:
-    image: sonarqube:9.2-community
-    platform: linux/amd64
-    expose:
-      - 9000
-    ports:
-      - "9000:9000"
-    networks:
-      - sonar
-    environment:
-      - sonar.jdbc.username=sonar
-      - sonar.jdbc.password=sonar
-      - sonar.jdbc.url=jdbc:postgresql://psql:5432/sonar
-  psql:
-    image: postgres:9.5
-    networks:
-      - sonar
-    ports:
-      - 5432:5432
-    environment:
-      - POSTGRES_USER=sonar
-      - POSTGRES_PASSWORD=sonar
-      - POSTGRES_DATABASE=sonar
-    volumes:
-      - postgresql:/var/lib/postgresql
-      - postgresql_data:/var/lib/postgresql/data
-networks:
-  sonar:
-volumes:
-  postgresql_data:
-  postgresql:
-`
-	case "linux":
-		dockerFile = `
-version: "3"
-services:
-  sonarqube:
-    image: sonarqube:9.2-community
-    expose:
-      - 9000
-    ports:
-      - "9000:9000"
-    networks:
-      - sonar
-    environment:
-      - sonar.jdbc.username=sonar
-      - sonar.jdbc.password=sonar
-      - sonar.jdbc.url=jdbc:postgresql://psql:5432/sonar
-  psql:
-    image: postgres:9.5
-    networks:
-      - sonar
-    ports:
-      - 5432:5432
-    environment:
-      - POSTGRES_USER=sonar
-      - POSTGRES_PASSWORD=sonar
-      - POSTGRES_DATABASE=sonar
-    volumes:
-      - postgresql:/var/lib/postgresql
-      - postgresql_data:/var/lib/postgresql/data
-networks:
-  sonar:
-volumes:
-  postgresql_data:
-  postgresql:
-`
-	default:
-		fmt.Println("💡 OS not detected...")
+	fmt.Fprintln(out, "Stopping SonarQube...")
+	if err := rt.Stop(ctx, project); err != nil {
+		return err
 	}
 
-	return dockerFile
+	fmt.Fprintln(out, "👋 SonarQube is stopped!")
+	return nil
 }
 
-// createProject generates the project in SonarQube
-func createProject() {
-	printLine()
-	fmt.Println("💡 The organization to create the project is: ", organization)
-	printLine()
+// createProject generates the projects in SonarQube
+func createProject(projects []string, organization string, out io.Writer) error {
+	printLine(out)
+	fmt.Fprintln(out, "💡 The organization to create the project is: ", organization)
+	printLine(out)
+
+	client := newSonarClient()
 
-	projects := strings.Split(project, ",")
 	// crate the project in Sonar
 	for _, p := range projects {
-		fmt.Println("📚 Project to create: ", p)
-
-		params := url.Values{}
-		params.Add("project", p)
-		params.Add("organization", organization)
-		params.Add("name", p)
-		body := strings.NewReader(params.Encode())
-
-		req, err := http.NewRequest("POST", "http://localhost:9000/api/projects/create", body)
-		if err != nil {
-			log.Fatal(err)
+		fmt.Fprintln(out, "📚 Project to create: ", p)
+
+		_, err := client.CreateProject(context.Background(), sonarapi.CreateProjectOptions{
+			Key:          p,
+			Name:         p,
+			Organization: organization,
+		})
+		if sonarapi.IsAlreadyExists(err) {
+			fmt.Fprintln(out, "📚 Project already exists: ", p)
+			continue
 		}
-		req.SetBasicAuth(sonarUser, sonarPass)
-		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-
-		_, err = http.DefaultClient.Do(req)
 		if err != nil {
-			log.Fatal(err)
+			return err
 		}
 	}
+	return nil
 }
 
-// createProjectToken generates the token for the project in SonarQube
-func createProjectToken() {
-	printLine()
-	fmt.Println("💡 The organization to create the token is: ", organization)
-	printLine()
+// createProjectToken generates the token for the projects in SonarQube
+func createProjectToken(projects []string, out io.Writer) error {
+	printLine(out)
+
+	client := newSonarClient()
 
-	projects := strings.Split(project, ",")
 	// crate the project in SQ
 	for _, p := range projects {
-		fmt.Println("💡 Project to create the token: ", p)
+		fmt.Fprintln(out, "💡 Project to create the token: ", p)
 		// Get info from the actual tokens configuration
-		token, err := GetTokenInFile(p)
-		if err != nil && token == "" {
-			fmt.Println("✔️ Creating new token for project: ", p)
-
-			params := url.Values{}
-			params.Add("name", p)
-			body := strings.NewReader(params.Encode())
-
-			req, err := http.NewRequest("POST", "http://localhost:9000/api/user_tokens/generate", body)
-			if err != nil {
-				log.Fatal(err)
-			}
-			req.SetBasicAuth(sonarUser, sonarPass)
-			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-
-			resp, err := http.DefaultClient.Do(req)
-			if err != nil {
-				log.Fatal(err)
-			}
-
-			// check the response of SQ
-			err = CheckSonarResponse(resp, err)
-			if err != nil {
-				fmt.Println("[ERROR] 🔥 Failed token creation, it's possible that the token already exists in SonarQube, for check it, got to:")
-				fmt.Println("[ERROR] 🔥 Try to check the token in your path: ~/.axectl/sonar/tokens/ - or check it in the panel:")
-				fmt.Println("[ERROR] 🔥 http://localhost:9000/account/security")
-				log.Fatal(err)
-			}
-
-		} else {
-			fmt.Println("📜️ Using existing token for project: ", p)
+		_, err := readToken(p)
+		if err == nil {
+			fmt.Fprintln(out, "📜️ Using existing token for project: ", p)
+			printLine(out)
+			continue
 		}
-
-		printLine()
-	}
-}
-
-// CheckSonarResponse verify if the response of SQ after generate the token
-func CheckSonarResponse(resp *http.Response, err error) error {
-	// Check response, if it's ok, store the token into the FS
-	if resp.StatusCode == 200 {
-		token := TokenResponse{}
-		err2 := json.NewDecoder(resp.Body).Decode(&token)
-		if err2 != nil {
+		if !errors.Is(err, credstore.ErrNotFound) {
 			return err
 		}
-		fmt.Println("[INFO]: ", token.Name, "=", token.Token)
-
-		home, err := os.UserHomeDir()
-		cobra.CheckErr(err)
-
-		// Store the content insisde ~/.axectl/sonar/tokens/
-		configHome := filepath.Join(home, tokensFolder)
-		fileInPath := filepath.Join(configHome, token.Name)
 
-		err = CreateFileInPath(configHome, fileInPath)
+		fmt.Fprintln(out, "✔️ Creating new token for project: ", p)
+		t, err := client.GenerateToken(context.Background(), p, "")
+		if err == nil {
+			// store the token in the credential store
+			err = StoreToken(t, out)
+		}
 		if err != nil {
+			fmt.Fprintln(out, "[ERROR] 🔥 Failed token creation, it's possible that the token already exists in SonarQube, for check it, got to:")
+			fmt.Fprintln(out, "[ERROR] 🔥 Try to check the token with: axectl sonar token list - or check it in the panel:")
+			fmt.Fprintln(out, "[ERROR] 🔥 "+sonarHost+"/account/security")
 			return err
 		}
 
-		tokenFile := filepath.Join(configHome, token.Name)
-		CreateFileWithContent(tokenFile, token.Token)
-
-		return nil
+		printLine(out)
 	}
-
 	return nil
 }
 
-// GetTokenInFile check the content inside the file and return it
-func GetTokenInFile(tokenName string) (string, error) {
-	// Get current user directory
-	dirname, err := os.UserHomeDir()
-	if err != nil {
-		log.Println("user home dir not found...")
-		return "", err
+// StoreToken stores the token generated by SonarQube in the credential store, the token is never printed
+func StoreToken(token *sonarapi.UserToken, out io.Writer) error {
+	if err := writeToken(token.Name, token.Token); err != nil {
+		return err
 	}
-	tokenValue := dirname + tokensFolder + tokenName
+	fmt.Fprintln(out, "🔑 Token stored: ", token.Name)
+	return nil
+}
 
-	t, err2 := ioutil.ReadFile(tokenValue) // just pass the file name
-	if err2 != nil {
-		return "", err2
-	}
-	token := string(t)
+// newSonarClient returns a client for the SonarQube API authenticated with the admin user
+func newSonarClient() *sonarapi.Client {
+	return sonarClient(sonarHost, sonarUser, sonarPass)
+}
 
-	return token, nil
+// sonarClient returns a client for the SonarQube API, in a dry run its requests are added to the plan
+func sonarClient(host, user, password string) *sonarapi.Client {
+	opts := []sonarapi.Option{sonarapi.WithBasicAuth(user, password)}
+	if currentPlan != nil {
+		opts = append(opts, sonarapi.WithHTTPClient(currentPlan.httpClient()))
+	}
+	return sonarapi.NewClient(host, opts...)
 }
 
 //////////////////
@@ -759,20 +730,39 @@ func CommandExists(cmd string) bool {
 	return err == nil
 }
 
-// detectOS check the current OS where the tool is being executed
+// detectOS check the current OS where the tool is being executed: darwin, linux, windows...
 func detectOS() string {
-	switch os := runtime.GOOS; os {
-	case "darwin":
-		return "darwin"
-	case "linux":
-		return "linux"
+	return runtime.GOOS
+}
+
+// projectList split the projects separated by comas, ignoring spaces and empty names
+func projectList(projects string) []string {
+	var list []string
+	for _, p := range strings.Split(projects, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			list = append(list, p)
+		}
+	}
+	return list
+}
+
+// isLocalHost check if the SonarQube url points to this machine, which means
+// that the containers are managed by axectl
+func isLocalHost(host string) bool {
+	u, err := url.Parse(host)
+	if err != nil {
+		return false
+	}
+
+	switch u.Hostname() {
+	case "localhost", "127.0.0.1", "::1", "0.0.0.0":
+		return true
 	default:
-		return "linux"
+		return false
 	}
-	return ""
 }
 
 // printLine use for print the line
-func printLine() {
-	fmt.Println("--------------------------------------------------------------")
+func printLine(out io.Writer) {
+	fmt.Fprintln(out, "--------------------------------------------------------------")
 }
@@ -0,0 +1,280 @@
+/*
+Copyright © 2021 Jose Ramon Mañes jr.mb47@gmail.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"context"
+	"errors"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// installCmd installs the packages needed to run SonarQube
+var installCmd = &cobra.Command{
+	Use:   "install",
+	Short: "Install the container runtime needed to run SonarQube and the scans",
+	Long: `Install docker & docker-compose, or podman & podman-compose with --runtime podman.
+It's not needed if you already have them.
+
+USAGE Examples:
+
+axectl sonar install
+axectl sonar install --runtime podman
+axectl sonar install --dry-run`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		debug, _ := cmd.Flags().GetBool("debug")
+		return install(context.Background(), newRunner(debug), actionOutput())
+	},
+}
+
+// upCmd starts SonarQube
+var upCmd = &cobra.Command{
+	Use:     "up",
+	Aliases: []string{"start"},
+	Short:   "Start SonarQube and wait until it's ready",
+	Long: `Start the SonarQube and postgres containers and wait until SonarQube is up and healthy.
+With a remote --host it only waits for it.
+
+USAGE Examples:
+
+axectl sonar up
+axectl sonar up --wait-timeout 10m --sonar-version 9.9
+axectl sonar up --plan --plan-output json`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// load the SonarQube host and credentials
+		if err := loadSonarConfig(cmd); err != nil {
+			return err
+		}
+
+		opts, err := startFlags(cmd)
+		if err != nil {
+			return err
+		}
+		return start(context.Background(), opts, actionOutput())
+	},
+}
+
+// downCmd stops SonarQube
+var downCmd = &cobra.Command{
+	Use:     "down",
+	Aliases: []string{"stop"},
+	Short:   "Stop the SonarQube containers, keeping their data",
+	Long: `Stop the SonarQube and postgres containers, they are started again with: axectl sonar up
+To remove them use: axectl sonar destroy
+
+USAGE Examples:
+
+axectl sonar down`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// load the SonarQube host and credentials
+		if err := loadSonarConfig(cmd); err != nil {
+			return err
+		}
+
+		rt, project, err := managedRuntime()
+		if err != nil {
+			return err
+		}
+		return stop(context.Background(), rt, project, actionOutput())
+	},
+}
+
+// projectCmd groups the commands of the projects
+var projectCmd = &cobra.Command{
+	Use:   "project",
+	Short: "Manage the projects in SonarQube",
+}
+
+// projectCreateCmd creates projects and their tokens
+var projectCreateCmd = &cobra.Command{
+	Use:   "create <project>...",
+	Short: "Create the projects in SonarQube and a token for each one",
+	Long: `Create the projects in SonarQube, the ones which exist are skipped, and a token
+for each one stored in ~/.axectl/sonar/tokens/
+
+With --discover the projects are the folders of the current path with a go.mod, package.json,
+pom.xml, build.gradle, pyproject.toml or Cargo.toml, their key is the folder with - instead of /
+prefixed by the organization: someOrganization_services-api
+
+USAGE Examples:
+
+axectl sonar project create someProject
+axectl sonar project create someProject1 someProject2 -o "someOrganization"
+axectl sonar project create --discover -o "someOrganization" --exclude 'legacy/*' --dry-run`,
+	Args: cobra.ArbitraryArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		discover := discoverFlags(cmd)
+		projects, err := commandProjects(".", args, discover)
+		if err != nil {
+			return err
+		}
+		if currentPlan != nil {
+			// the plan is written to the standard output, it can be json
+			printProjects(os.Stderr, projects, "created with their tokens")
+		}
+
+		// load the SonarQube host and credentials
+		if err := loadSonarConfig(cmd); err != nil {
+			return err
+		}
+
+		keys := projectKeys(projects)
+		if err := createProject(keys, discover.organization, actionOutput()); err != nil {
+			return err
+		}
+		return createProjectToken(keys, actionOutput())
+	},
+}
+
+// scanCmd scans projects
+var scanCmd = &cobra.Command{
+	Use:   "scan <project>...",
+	Short: "Scan the projects with the sonar-scanner",
+	Long: `Scan the projects, folders of the current path, with the sonar-scanner container
+using the tokens created with: axectl sonar project create
+
+Use the same --discover, --include, --exclude and -o flags used to create the projects.
+
+USAGE Examples:
+
+axectl sonar scan someProject
+axectl sonar scan someProject1 someProject2 --coverage someProject1/cover.out --wait-gate
+axectl sonar scan api web worker --parallel 3
+axectl sonar scan --discover -o "someOrganization" --include 'services/*' --parallel 4`,
+	Args: cobra.ArbitraryArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		discover := discoverFlags(cmd)
+		projects, err := commandProjects(".", args, discover)
+		if err != nil {
+			return err
+		}
+		if currentPlan != nil {
+			// the plan is written to the standard output, it can be json
+			printProjects(os.Stderr, projects, "scanned")
+		}
+
+		// load the SonarQube host and credentials
+		if err := loadSonarConfig(cmd); err != nil {
+			return err
+		}
+
+		opts := scanFlags(cmd)
+		opts.keys = map[string]string{}
+		for _, p := range projects {
+			opts.projects = append(opts.projects, p.dir)
+			opts.keys[p.dir] = p.key
+		}
+		opts.runtime, err = containerRuntime()
+		if err != nil {
+			return err
+		}
+		return scan(context.Background(), opts, actionOutput())
+	},
+}
+
+// init add the subcommands to the sonar command
+func init() {
+	sonarCmd.AddCommand(installCmd, upCmd, downCmd, projectCmd, scanCmd)
+	projectCmd.AddCommand(projectCreateCmd)
+
+	addWaitFlags(upCmd)
+	addScanFlags(scanCmd)
+	addWaitFlags(scanCmd)
+	addDiscoverFlags(projectCreateCmd)
+	addDiscoverFlags(scanCmd)
+	projectCreateCmd.Flags().StringP("organization", "o", "", "Organization in SonarQube, prefix of the keys of the discovered projects")
+	scanCmd.Flags().StringP("organization", "o", "", "Organization, prefix of the keys of the discovered projects")
+	for _, c := range []*cobra.Command{installCmd, upCmd, downCmd, projectCreateCmd, scanCmd} {
+		planCommand(c)
+	}
+}
+
+// addWaitFlags adds the flags of the time to wait for SonarQube
+func addWaitFlags(cmd *cobra.Command) {
+	cmd.Flags().DurationP("wait-timeout", "", defaultWaitOptions.timeout, "Maximum time to wait until SonarQube is up")
+	cmd.Flags().DurationP("wait-interval", "", defaultWaitOptions.interval, "Time between the checks of SonarQube status, it's doubled after each check")
+}
+
+// waitFlags returns the wait options of the flags added by addWaitFlags
+func waitFlags(cmd *cobra.Command) waitOptions {
+	wait := defaultWaitOptions
+	wait.timeout, _ = cmd.Flags().GetDuration("wait-timeout")
+	wait.interval, _ = cmd.Flags().GetDuration("wait-interval")
+	return wait
+}
+
+// startFlags returns the start options of the flags added by addWaitFlags, the
+// compose settings and the runtime of the local SonarQube
+func startFlags(cmd *cobra.Command) (startOptions, error) {
+	opts := startOptions{wait: waitFlags(cmd), persistSysctl: viper.GetBool("sonar.persist-sysctl")}
+	debug, _ := cmd.Flags().GetBool("debug")
+	opts.runner = newRunner(debug)
+
+	var err error
+	opts.compose, err = loadComposeOptions()
+	if err != nil {
+		return opts, err
+	}
+	// a remote SonarQube doesn't need the containers
+	if isLocalHost(sonarHost) {
+		opts.runtime, err = containerRuntime()
+	}
+	return opts, err
+}
+
+// addScanFlags adds the flags of the scans
+func addScanFlags(cmd *cobra.Command) {
+	cmd.Flags().BoolP("wait-gate", "", false, "Wait for the quality gate after the scan, exit with error if it fails")
+	cmd.Flags().StringArrayP("coverage", "", nil, "Coverage file to send with the scan (Go cover.out, LCOV, JaCoCo XML or Cobertura XML of Python), it can be repeated")
+	cmd.Flags().StringP("target-branch", "", "", "Branch the new code is compared with, by default the one of origin/HEAD, main or master")
+	cmd.Flags().StringP("pull-request", "", "", "Key of the pull request to analyse, the current branch is its source, it needs --branch-analysis")
+	cmd.Flags().BoolP("branch-analysis", "", false, "Send the branch or pull request of the scan, it needs the Developer Edition or higher, by default when --edition is not community")
+	cmd.Flags().IntP("parallel", "", 1, "Number of projects scanned at the same time, their output is only stored in ~"+scanLogsFolder)
+}
+
+// scanFlags returns the scan options of the flags added by addScanFlags and addWaitFlags
+func scanFlags(cmd *cobra.Command) scanOptions {
+	opts := scanOptions{wait: waitFlags(cmd)}
+	opts.coverage, _ = cmd.Flags().GetStringArray("coverage")
+	opts.waitGate, _ = cmd.Flags().GetBool("wait-gate")
+	opts.parallel, _ = cmd.Flags().GetInt("parallel")
+	opts.targetBranch, _ = cmd.Flags().GetString("target-branch")
+	opts.pullRequest, _ = cmd.Flags().GetString("pull-request")
+	// the community edition fails with the branch settings
+	opts.branchAnalysis = viper.GetString("sonar.edition") != defaultComposeOptions.Edition
+	if cmd.Flags().Changed("branch-analysis") {
+		opts.branchAnalysis, _ = cmd.Flags().GetBool("branch-analysis")
+	}
+	return opts
+}
+
+// projectArgs returns the projects of the arguments, every argument can have
+// several projects separated by comas
+func projectArgs(args []string) ([]string, error) {
+	var projects []string
+	for _, a := range args {
+		projects = append(projects, projectList(a)...)
+	}
+	if len(projects) == 0 {
+		return nil, errors.New("the projects are needed, example: axectl sonar scan someProject")
+	}
+	return projects, nil
+}
@@ -0,0 +1,41 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestLegacyActions check that the old flags are deprecated and their subcommands exist
+func TestLegacyActions(t *testing.T) {
+	for _, l := range legacyActions {
+		f := sonarCmd.Flags().Lookup(l.flag)
+		if f == nil || f.Deprecated == "" || f.Shorthand != l.shorthand {
+			t.Errorf("ERROR: flag %s is not deprecated: %+v", l.flag, f)
+		}
+
+		c, rest, err := sonarCmd.Find(strings.Fields(l.command))
+		if err != nil || len(rest) != 0 || c.CommandPath() != "axectl sonar "+l.command {
+			t.Errorf("ERROR: flag %s: subcommand %s not found: %v", l.flag, l.command, err)
+		}
+	}
+}
+
+// TestProjectArgs check the projects of the arguments
+func TestProjectArgs(t *testing.T) {
+	var tests = []struct {
+		args []string
+		want string
+		err  bool
+	}{
+		{[]string{"api"}, "api", false},
+		{[]string{"api", "web,worker"}, "api,web,worker", false},
+		{[]string{" , "}, "", true},
+	}
+
+	for _, tt := range tests {
+		got, err := projectArgs(tt.args)
+		if (err != nil) != tt.err || strings.Join(got, ",") != tt.want {
+			t.Errorf("ERROR: args: %v, projects: %v, error: %v", tt.args, got, err)
+		}
+	}
+}
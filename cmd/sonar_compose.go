@@ -0,0 +1,276 @@
+/*
+Copyright © 2021 Jose Ramon Mañes jr.mb47@gmail.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// composeOptions settings of the docker-compose file
+type composeOptions struct {
+	// Edition of SonarQube: community, developer or enterprise
+	Edition string
+	// Version of the SonarQube image, 9.2, 9.9, lts...
+	Version string
+	// Port in the host where SonarQube is published
+	Port int
+	// PostgresVersion version of the postgres image
+	PostgresVersion string
+	// PostgresPort in the host where postgres is published, 0 to not publish it
+	PostgresPort int
+	// WebJavaOpts, CEJavaOpts and SearchJavaOpts JVM options of the SonarQube processes
+	WebJavaOpts    string
+	CEJavaOpts     string
+	SearchJavaOpts string
+	// PostgresVolume and PostgresDataVolume names of the database volumes
+	PostgresVolume     string
+	PostgresDataVolume string
+	// Platform of the images, needed in macOS to run the amd64 images
+	Platform string
+}
+
+// defaultComposeOptions the versions and ports used until now
+var defaultComposeOptions = composeOptions{
+	Edition:            "community",
+	Version:            "9.2",
+	Port:               9000,
+	PostgresVersion:    "9.5",
+	PostgresPort:       5432,
+	PostgresVolume:     "postgresql",
+	PostgresDataVolume: "postgresql_data",
+}
+
+// sonarEditions editions of SonarQube with a docker image
+var sonarEditions = []string{"community", "developer", "enterprise"}
+
+// imageTag and volumeName allowed values, they are written as they are in the YAML
+var (
+	imageTag   = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+	volumeName = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+)
+
+// composeTemplate of the docker-compose file
+var composeTemplate = template.Must(template.New("docker-compose").Parse(`
+version: "3.5"
+services:
+  sonarqube:
+    image: {{ .Image }}
+{{- if .Platform }}
+    platform: {{ .Platform }}
+{{- end }}
+    expose:
+      - 9000
+    ports:
+      - "{{ .Port }}:9000"
+    networks:
+      - sonar
+    ulimits:
+      nofile:
+        soft: 131072
+        hard: 131072
+      nproc:
+        soft: 8192
+        hard: 8192
+    environment:
+      - sonar.jdbc.username=sonar
+      - sonar.jdbc.password=sonar
+      - sonar.jdbc.url=jdbc:postgresql://psql:5432/sonar
+{{- if .WebJavaOpts }}
+      - {{ .EnvVar "SONAR_WEB_JAVAOPTS" .WebJavaOpts }}
+{{- end }}
+{{- if .CEJavaOpts }}
+      - {{ .EnvVar "SONAR_CE_JAVAOPTS" .CEJavaOpts }}
+{{- end }}
+{{- if .SearchJavaOpts }}
+      - {{ .EnvVar "SONAR_SEARCH_JAVAOPTS" .SearchJavaOpts }}
+{{- end }}
+  psql:
+    image: {{ .PostgresImage }}
+{{- if .Platform }}
+    platform: {{ .Platform }}
+{{- end }}
+    networks:
+      - sonar
+{{- if .PostgresPort }}
+    ports:
+      - "{{ .PostgresPort }}:5432"
+{{- end }}
+    environment:
+      - POSTGRES_USER=sonar
+      - POSTGRES_PASSWORD=sonar
+      - POSTGRES_DB=sonar
+    volumes:
+      - {{ .PostgresVolume }}:/var/lib/postgresql
+      - {{ .PostgresDataVolume }}:/var/lib/postgresql/data
+networks:
+  sonar:
+    name: {{ .Network }}
+volumes:
+  {{ .PostgresDataVolume }}:
+  {{ .PostgresVolume }}:
+`))
+
+// init add the flags of the docker-compose file, they can be set in the config file too
+func init() {
+	flags := sonarCmd.PersistentFlags()
+	flags.StringP("edition", "", defaultComposeOptions.Edition, "Edition of SonarQube: "+strings.Join(sonarEditions, ", "))
+	flags.StringP("sonar-version", "", defaultComposeOptions.Version, "Version of the SonarQube image, example: 9.9 or lts")
+	flags.IntP("port", "", defaultComposeOptions.Port, "Port of the host where SonarQube is published")
+	flags.StringP("postgres-version", "", defaultComposeOptions.PostgresVersion, "Version of the postgres image")
+	flags.IntP("postgres-port", "", defaultComposeOptions.PostgresPort, "Port of the host where postgres is published, 0 to not publish it")
+	flags.StringP("web-java-opts", "", "", "JVM options of the SonarQube web server, example: -Xmx1G")
+	flags.StringP("ce-java-opts", "", "", "JVM options of the SonarQube compute engine")
+	flags.StringP("search-java-opts", "", "", "JVM options of the SonarQube search server")
+	flags.StringP("postgres-volume", "", defaultComposeOptions.PostgresVolume, "Name of the volume of postgres")
+	flags.StringP("postgres-data-volume", "", defaultComposeOptions.PostgresDataVolume, "Name of the volume of the postgres data")
+
+	// config file keys of every flag
+	keys := map[string]string{
+		"sonar.edition":               "edition",
+		"sonar.version":               "sonar-version",
+		"sonar.port":                  "port",
+		"sonar.postgres.version":      "postgres-version",
+		"sonar.postgres.port":         "postgres-port",
+		"sonar.java-opts.web":         "web-java-opts",
+		"sonar.java-opts.ce":          "ce-java-opts",
+		"sonar.java-opts.search":      "search-java-opts",
+		"sonar.volumes.postgres":      "postgres-volume",
+		"sonar.volumes.postgres-data": "postgres-data-volume",
+	}
+	for key, flag := range keys {
+		cobra.CheckErr(viper.BindPFlag(key, flags.Lookup(flag)))
+	}
+}
+
+// loadComposeOptions returns the settings of the docker-compose file from the flags and the config file
+func loadComposeOptions() (composeOptions, error) {
+	opts := composeOptions{
+		Edition:            viper.GetString("sonar.edition"),
+		Version:            viper.GetString("sonar.version"),
+		Port:               viper.GetInt("sonar.port"),
+		PostgresVersion:    viper.GetString("sonar.postgres.version"),
+		PostgresPort:       viper.GetInt("sonar.postgres.port"),
+		WebJavaOpts:        viper.GetString("sonar.java-opts.web"),
+		CEJavaOpts:         viper.GetString("sonar.java-opts.ce"),
+		SearchJavaOpts:     viper.GetString("sonar.java-opts.search"),
+		PostgresVolume:     viper.GetString("sonar.volumes.postgres"),
+		PostgresDataVolume: viper.GetString("sonar.volumes.postgres-data"),
+	}
+	if detectOS() == "darwin" {
+		opts.Platform = "linux/amd64"
+	}
+
+	return opts, opts.validate()
+}
+
+// validate check the values before writing them in the docker-compose file
+func (o composeOptions) validate() error {
+	if !contains(sonarEditions, o.Edition) {
+		return errors.New("unknown edition " + o.Edition + ", use one of: " + strings.Join(sonarEditions, ", "))
+	}
+	if !imageTag.MatchString(o.Version) {
+		return errors.New("invalid SonarQube version: " + o.Version)
+	}
+	if !imageTag.MatchString(o.PostgresVersion) {
+		return errors.New("invalid postgres version: " + o.PostgresVersion)
+	}
+	if o.Port < 1 || o.Port > 65535 {
+		return fmt.Errorf("invalid port: %d", o.Port)
+	}
+	if o.PostgresPort < 0 || o.PostgresPort > 65535 {
+		return fmt.Errorf("invalid postgres port: %d", o.PostgresPort)
+	}
+	if o.PostgresPort == o.Port {
+		return fmt.Errorf("SonarQube and postgres can't use the same port: %d", o.Port)
+	}
+	for _, v := range []string{o.PostgresVolume, o.PostgresDataVolume} {
+		if !volumeName.MatchString(v) {
+			return errors.New("invalid volume name: " + v)
+		}
+	}
+	if o.PostgresVolume == o.PostgresDataVolume {
+		return errors.New("the postgres volumes need different names: " + o.PostgresVolume)
+	}
+	for _, v := range []string{o.WebJavaOpts, o.CEJavaOpts, o.SearchJavaOpts} {
+		if strings.ContainsAny(v, "\n\r") {
+			return errors.New("the JVM options must be in one line: " + strconv.Quote(v))
+		}
+	}
+	return nil
+}
+
+// EnvVar returns the environment variable quoted for the docker-compose file,
+// the $ is escaped so compose doesn't interpolate it
+func (o composeOptions) EnvVar(name, value string) string {
+	return strconv.Quote(name + "=" + strings.ReplaceAll(value, "$", "$$"))
+}
+
+// Image returns the SonarQube image of the version and edition, podman needs the full name
+func (o composeOptions) Image() string {
+	return "docker.io/library/sonarqube:" + o.Version + "-" + o.Edition
+}
+
+// PostgresImage returns the postgres image of the version
+func (o composeOptions) PostgresImage() string {
+	return "docker.io/library/postgres:" + o.PostgresVersion
+}
+
+// Network returns the name of the network, the same for docker-compose and podman-compose
+func (o composeOptions) Network() string {
+	return sonarNetwork
+}
+
+// localHost returns the url of the SonarQube published in the host
+func (o composeOptions) localHost() string {
+	return "http://localhost:" + strconv.Itoa(o.Port)
+}
+
+// volumes returns the names of the volumes created by docker-compose
+func (o composeOptions) volumes() []string {
+	// docker-compose adds the folder of the file as prefix
+	return []string{composeProject + "_" + o.PostgresVolume, composeProject + "_" + o.PostgresDataVolume}
+}
+
+// dockerComposeFile returns all the data inside the docker-compose.yml file
+func dockerComposeFile(opts composeOptions) (string, error) {
+	if err := opts.validate(); err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	if err := composeTemplate.Execute(&b, opts); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// contains check if the value is in the list
+func contains(list []string, value string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,127 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v2"
+)
+
+// compose structure of the docker-compose file, only the fields we check
+type compose struct {
+	Services map[string]struct {
+		Image       string   `yaml:"image"`
+		Platform    string   `yaml:"platform"`
+		Ports       []string `yaml:"ports"`
+		Environment []string `yaml:"environment"`
+		Volumes     []string `yaml:"volumes"`
+		Ulimits     map[string]struct {
+			Soft int64 `yaml:"soft"`
+			Hard int64 `yaml:"hard"`
+		} `yaml:"ulimits"`
+	} `yaml:"services"`
+	Networks map[string]struct {
+		Name string `yaml:"name"`
+	} `yaml:"networks"`
+	Volumes map[string]interface{} `yaml:"volumes"`
+}
+
+// TestDockerComposeFile check the docker-compose file rendered with the options
+func TestDockerComposeFile(t *testing.T) {
+	custom := defaultComposeOptions
+	custom.Edition = "developer"
+	custom.Version = "9.9"
+	custom.Port = 9001
+	custom.PostgresVersion = "13"
+	custom.PostgresPort = 0
+	custom.WebJavaOpts = "-Xmx1G -Xms128m"
+	custom.PostgresVolume = "sonar_pg"
+	custom.PostgresDataVolume = "sonar_pg_data"
+	custom.Platform = "linux/amd64"
+	special := defaultComposeOptions
+	special.CEJavaOpts = `-Dtitle="a: b" -Dx=#y -Dhome=$HOME`
+
+	var tests = []struct {
+		name     string
+		opts     composeOptions
+		image    string
+		postgres string
+		ports    []string
+		pgPorts  []string
+		env      string
+		volumes  []string
+		platform string
+	}{
+		{"default", defaultComposeOptions, "docker.io/library/sonarqube:9.2-community", "docker.io/library/postgres:9.5", []string{"9000:9000"}, []string{"5432:5432"}, "", []string{"postgresql", "postgresql_data"}, ""},
+		{"custom", custom, "docker.io/library/sonarqube:9.9-developer", "docker.io/library/postgres:13", []string{"9001:9000"}, nil, "SONAR_WEB_JAVAOPTS=-Xmx1G -Xms128m", []string{"sonar_pg", "sonar_pg_data"}, "linux/amd64"},
+		{"special characters", special, "docker.io/library/sonarqube:9.2-community", "docker.io/library/postgres:9.5", []string{"9000:9000"}, []string{"5432:5432"}, `SONAR_CE_JAVAOPTS=-Dtitle="a: b" -Dx=#y -Dhome=$$HOME`, []string{"postgresql", "postgresql_data"}, ""},
+	}
+
+	for _, tt := range tests {
+		content, err := dockerComposeFile(tt.opts)
+		if err != nil {
+			t.Fatalf("ERROR: %s: %v", tt.name, err)
+		}
+
+		c := compose{}
+		if err := yaml.Unmarshal([]byte(content), &c); err != nil {
+			t.Fatalf("ERROR: %s: invalid YAML: %v\n%s", tt.name, err, content)
+		}
+
+		sonar, psql := c.Services["sonarqube"], c.Services["psql"]
+		if sonar.Image != tt.image || psql.Image != tt.postgres {
+			t.Errorf("ERROR: %s: images: %s, %s", tt.name, sonar.Image, psql.Image)
+		}
+		if strings.Join(sonar.Ports, ",") != strings.Join(tt.ports, ",") || strings.Join(psql.Ports, ",") != strings.Join(tt.pgPorts, ",") {
+			t.Errorf("ERROR: %s: ports: %v, %v", tt.name, sonar.Ports, psql.Ports)
+		}
+		if sonar.Platform != tt.platform || psql.Platform != tt.platform {
+			t.Errorf("ERROR: %s: platform: %s", tt.name, sonar.Platform)
+		}
+		if tt.env != "" && !contains(sonar.Environment, tt.env) {
+			t.Errorf("ERROR: %s: %s not found in: %v", tt.name, tt.env, sonar.Environment)
+		}
+		for _, u := range sonarUlimits {
+			if l := sonar.Ulimits[u.Name]; l.Soft != u.Soft || l.Hard != u.Hard {
+				t.Errorf("ERROR: %s: ulimit %s: %+v", tt.name, u.Name, l)
+			}
+		}
+		if c.Networks["sonar"].Name != sonarNetwork {
+			t.Errorf("ERROR: %s: network: %+v", tt.name, c.Networks)
+		}
+		for _, v := range tt.volumes {
+			if _, ok := c.Volumes[v]; !ok {
+				t.Errorf("ERROR: %s: volume %s not found in: %v", tt.name, v, c.Volumes)
+			}
+		}
+	}
+}
+
+// TestComposeOptionsValidate check the values which can't be written in the docker-compose file
+func TestComposeOptionsValidate(t *testing.T) {
+	var tests = []struct {
+		name   string
+		change func(o *composeOptions)
+	}{
+		{"edition", func(o *composeOptions) { o.Edition = "free" }},
+		{"version", func(o *composeOptions) { o.Version = "9.2\n    privileged: true" }},
+		{"postgres version", func(o *composeOptions) { o.PostgresVersion = "" }},
+		{"port", func(o *composeOptions) { o.Port = 0 }},
+		{"postgres port", func(o *composeOptions) { o.PostgresPort = 70000 }},
+		{"same port", func(o *composeOptions) { o.PostgresPort = o.Port }},
+		{"volume", func(o *composeOptions) { o.PostgresVolume = "pg data" }},
+		{"same volume", func(o *composeOptions) { o.PostgresDataVolume = o.PostgresVolume }},
+		{"java opts", func(o *composeOptions) { o.CEJavaOpts = "-Xmx1G\n-Xms1G" }},
+	}
+
+	if err := defaultComposeOptions.validate(); err != nil {
+		t.Errorf("ERROR: default options: %v", err)
+	}
+	for _, tt := range tests {
+		o := defaultComposeOptions
+		tt.change(&o)
+		if _, err := dockerComposeFile(o); err == nil {
+			t.Errorf("ERROR: %s: error expected", tt.name)
+		}
+	}
+}
@@ -0,0 +1,184 @@
+/*
+Copyright © 2021 Jose Ramon Mañes jr.mb47@gmail.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// scannerMount folder where the current path is mounted inside the sonar-scanner container
+const scannerMount = "/usr/src"
+
+// coverage report formats
+const (
+	coverageGo        = "go"
+	coverageLCOV      = "lcov"
+	coverageCobertura = "cobertura"
+	coverageJaCoCo    = "jacoco"
+)
+
+// coverageProperties maps every coverage format with the property of the scanner,
+// SonarQube only reads the Cobertura reports of Python
+var coverageProperties = map[string]string{
+	coverageGo:        "sonar.go.coverage.reportPaths",
+	coverageLCOV:      "sonar.javascript.lcov.reportPaths",
+	coverageCobertura: "sonar.python.coverage.reportPaths",
+	coverageJaCoCo:    "sonar.coverage.jacoco.xmlReportPaths",
+}
+
+// coverageReport is a coverage file provided with --coverage
+type coverageReport struct {
+	// format of the report: go, lcov, cobertura or jacoco
+	format string
+	// path of the report relative to the current path, with / as separator
+	path string
+}
+
+// parseCoverageReports detects the format of the coverage files and makes
+// their paths relative to wd, the folder mounted in the scanner container
+func parseCoverageReports(wd string, paths []string) ([]coverageReport, error) {
+	var reports []coverageReport
+	for _, p := range paths {
+		abs, err := filepath.Abs(p)
+		if err != nil {
+			return nil, err
+		}
+		rel, err := filepath.Rel(wd, abs)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return nil, fmt.Errorf("coverage file %s must be inside the current path %s", p, wd)
+		}
+
+		format, err := detectCoverageFormat(abs)
+		if err != nil {
+			return nil, err
+		}
+
+		reports = append(reports, coverageReport{format: format, path: filepath.ToSlash(rel)})
+	}
+	return reports, nil
+}
+
+// detectCoverageFormat checks the content of the file to know its format
+func detectCoverageFormat(file string) (string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	// the beginning of the file is enough to know the format
+	head := make([]byte, 4096)
+	n, err := io.ReadFull(f, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return "", err
+	}
+	head = head[:n]
+
+	switch {
+	case bytes.HasPrefix(head, []byte("mode:")):
+		return coverageGo, nil
+	case bytes.Contains(head, []byte("<report")) && (bytes.Contains(head, []byte("JACOCO")) || bytes.Contains(head, []byte("<sessioninfo"))):
+		return coverageJaCoCo, nil
+	case bytes.Contains(head, []byte("<coverage")):
+		return coverageCobertura, nil
+	case isLCOV(head):
+		return coverageLCOV, nil
+	}
+
+	return "", errors.New("unknown format of the coverage file " + file + ", supported: Go cover.out, LCOV, Cobertura XML and JaCoCo XML")
+}
+
+// isLCOV check if the first line of the content is a LCOV record
+func isLCOV(head []byte) bool {
+	s := bufio.NewScanner(bytes.NewReader(head))
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line == "" {
+			continue
+		}
+		return strings.HasPrefix(line, "TN:") || strings.HasPrefix(line, "SF:")
+	}
+	return false
+}
+
+// coverageArgs returns the scanner properties with the reports of the project p,
+// a report is used by p when it's inside ./p or outside every scanned project
+// and p can read its format
+func coverageArgs(p string, projects []string, reports []coverageReport) []string {
+	byProperty := map[string][]string{}
+	for _, r := range reports {
+		if !coverageBelongsTo(r.path, p, projects) || !coverageLanguageOK(r, p) {
+			continue
+		}
+		property := coverageProperties[r.format]
+		byProperty[property] = append(byProperty[property], path.Join(scannerMount, r.path))
+	}
+
+	var args []string
+	for property, paths := range byProperty {
+		args = append(args, "-D"+property+"="+strings.Join(paths, ","))
+	}
+	// keep the same order in every run
+	sort.Strings(args)
+	return args
+}
+
+// coverageLanguageOK check if the report can be read in the project p, the
+// Cobertura reports are only read in Python projects or when the language is unknown
+func coverageLanguageOK(r coverageReport, p string) bool {
+	if r.format != coverageCobertura {
+		return true
+	}
+	language := detectLanguage(p)
+	return language == "" || language == languagePython
+}
+
+// coverageWarnings returns the reports left out of the projects which can't read them
+func coverageWarnings(projects []string, reports []coverageReport) []string {
+	var warnings []string
+	for _, p := range projects {
+		for _, r := range reports {
+			if coverageBelongsTo(r.path, p, projects) && !coverageLanguageOK(r, p) {
+				warnings = append(warnings, fmt.Sprintf("The Cobertura report %s is only read in Python projects, it's not sent with the %s project %s", r.path, detectLanguage(p), p))
+			}
+		}
+	}
+	return warnings
+}
+
+// coverageBelongsTo check if the report is used by the project p
+func coverageBelongsTo(report, p string, projects []string) bool {
+	p = path.Clean(p)
+	if p == "." || strings.HasPrefix(report, p+"/") {
+		return true
+	}
+	for _, other := range projects {
+		other = path.Clean(other)
+		if other != "." && strings.HasPrefix(report, other+"/") {
+			return false
+		}
+	}
+	return true
+}
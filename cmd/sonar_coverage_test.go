@@ -0,0 +1,139 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestParseCoverageReports check the detection of the formats and the paths inside the container
+func TestParseCoverageReports(t *testing.T) {
+	wd := t.TempDir()
+
+	files := map[string]string{
+		"api/cover.out":                 "mode: set\ngithub.com/jrmanes/axectl/main.go:1.1,2.2 1 1\n",
+		"web/coverage/lcov.info":        "TN:\nSF:src/index.js\nDA:1,1\nend_of_record\n",
+		"py/coverage.xml":               `<?xml version="1.0" ?><coverage version="6.2" line-rate="0.8"><packages/></coverage>`,
+		"java/target/jacoco/jacoco.xml": `<?xml version="1.0"?><!DOCTYPE report PUBLIC "-//JACOCO//DTD Report 1.1//EN" "report.dtd"><report name="app"><sessioninfo id="x"/></report>`,
+		"unknown.txt":                   "hello",
+	}
+	for name, content := range files {
+		path := filepath.Join(wd, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			t.Fatalf("ERROR: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatalf("ERROR: %v", err)
+		}
+	}
+
+	var tests = []struct {
+		file   string
+		format string
+	}{
+		{"api/cover.out", coverageGo},
+		{"web/coverage/lcov.info", coverageLCOV},
+		{"py/coverage.xml", coverageCobertura},
+		{"java/target/jacoco/jacoco.xml", coverageJaCoCo},
+	}
+
+	for _, tt := range tests {
+		reports, err := parseCoverageReports(wd, []string{filepath.Join(wd, tt.file)})
+		if err != nil {
+			t.Errorf("ERROR: file: %s, %v", tt.file, err)
+			continue
+		}
+		if reports[0].format != tt.format || reports[0].path != tt.file {
+			t.Errorf("ERROR: file: %s, got: %v, want: %s", tt.file, reports[0], tt.format)
+		}
+	}
+
+	if _, err := parseCoverageReports(wd, []string{filepath.Join(wd, "unknown.txt")}); err == nil {
+		t.Errorf("ERROR: unknown format accepted")
+	}
+	if _, err := parseCoverageReports(filepath.Join(wd, "api"), []string{filepath.Join(wd, "web/coverage/lcov.info")}); err == nil {
+		t.Errorf("ERROR: file outside the current path accepted")
+	}
+}
+
+// TestCoverageArgs check which reports are sent with every project
+func TestCoverageArgs(t *testing.T) {
+	reports := []coverageReport{
+		{coverageGo, "api/cover.out"},
+		{coverageLCOV, "web/coverage/lcov.info"},
+		{coverageGo, "shared/cover.out"},
+	}
+	projects := []string{"api", "web"}
+
+	var tests = []struct {
+		project string
+		want    string
+	}{
+		{"api", "-Dsonar.go.coverage.reportPaths=/usr/src/api/cover.out,/usr/src/shared/cover.out"},
+		{"web", "-Dsonar.go.coverage.reportPaths=/usr/src/shared/cover.out -Dsonar.javascript.lcov.reportPaths=/usr/src/web/coverage/lcov.info"},
+	}
+
+	for _, tt := range tests {
+		got := strings.Join(coverageArgs(tt.project, projects, reports), " ")
+		if got != tt.want {
+			t.Errorf("ERROR: project: %s, \n got: %s, \n want: %s", tt.project, got, tt.want)
+		}
+	}
+
+	// scanning the current path uses every report
+	if got := coverageArgs(".", []string{"."}, reports); len(got) != 2 {
+		t.Errorf("ERROR: got: %v", got)
+	}
+}
+
+// TestCoverageLanguages check the Cobertura reports are only sent with Python projects
+func TestCoverageLanguages(t *testing.T) {
+	dir := t.TempDir()
+	for _, f := range []string{"py/pyproject.toml", "api/go.mod", "docs/README.md"} {
+		if err := os.MkdirAll(filepath.Join(dir, filepath.Dir(f)), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, f), nil, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	var tests = []struct {
+		projects []string
+		report   coverageReport
+		// projects which send the report
+		sent     []string
+		warnings int
+	}{
+		{[]string{"py", "api"}, coverageReport{coverageCobertura, "py/coverage.xml"}, []string{"py"}, 0},
+		{[]string{"py", "api"}, coverageReport{coverageCobertura, "api/coverage.xml"}, nil, 1},
+		{[]string{"py", "docs"}, coverageReport{coverageCobertura, "coverage.xml"}, []string{"py", "docs"}, 0},
+		{[]string{"py", "api"}, coverageReport{coverageCobertura, "coverage.xml"}, []string{"py"}, 1},
+		{[]string{"api"}, coverageReport{coverageGo, "api/cover.out"}, []string{"api"}, 0},
+	}
+
+	for _, tt := range tests {
+		reports := []coverageReport{tt.report}
+		var sent []string
+		for _, p := range tt.projects {
+			if len(coverageArgs(p, tt.projects, reports)) > 0 {
+				sent = append(sent, p)
+			}
+		}
+		if strings.Join(sent, ",") != strings.Join(tt.sent, ",") {
+			t.Errorf("ERROR: %v %s: sent with %v, want %v", tt.projects, tt.report.path, sent, tt.sent)
+		}
+		if got := coverageWarnings(tt.projects, reports); len(got) != tt.warnings {
+			t.Errorf("ERROR: %v %s: warnings: %v", tt.projects, tt.report.path, got)
+		}
+	}
+}
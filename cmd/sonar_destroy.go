@@ -0,0 +1,257 @@
+/*
+Copyright © 2021 Jose Ramon Mañes jr.mb47@gmail.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/jrmanes/axectl/pkg/container"
+	"github.com/jrmanes/axectl/pkg/credstore"
+	"github.com/jrmanes/axectl/pkg/sonarapi"
+	"github.com/spf13/cobra"
+)
+
+// destroyOptions what to keep when destroying the resources
+type destroyOptions struct {
+	// keepData keeps the database volumes and the admin password
+	keepData bool
+	// keepTokens keeps the tokens in the credential store
+	keepTokens bool
+	// compose settings used to start the containers
+	compose composeOptions
+	// runtime removes the containers
+	runtime container.Runtime
+	// client revokes the tokens of a remote SonarQube
+	client *sonarapi.Client
+}
+
+// destroyCmd removes everything created by axectl sonar
+var destroyCmd = &cobra.Command{
+	Use:   "destroy",
+	Short: "Remove the SonarQube containers, volumes, network and local files created by axectl",
+	Long: `Remove all the resources created by axectl sonar:
+
+- the SonarQube and PostgreSQL containers
+- the network ` + sonarNetwork + `
+- the volumes with the database, unless --keep-data is used
+- the docker-compose file
+- the admin password generated by axectl, unless --keep-data is used
+- the tokens in the credential store, unless --keep-tokens is used
+
+A remote SonarQube is not managed by axectl: its tokens are revoked before
+they are removed, and its admin password is kept.
+
+USAGE Examples:
+
+axectl sonar destroy
+axectl sonar destroy --keep-data --yes
+axectl sonar destroy --dry-run`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// load the SonarQube host and credentials
+		if err := loadSonarConfig(cmd); err != nil {
+			return err
+		}
+
+		compose, err := loadComposeOptions()
+		if err != nil {
+			return err
+		}
+
+		opts := destroyOptions{compose: compose, client: newSonarClient()}
+		if isLocalHost(sonarHost) {
+			opts.runtime, err = containerRuntime()
+			if err != nil {
+				return err
+			}
+		}
+		opts.keepData, _ = cmd.Flags().GetBool("keep-data")
+		opts.keepTokens, _ = cmd.Flags().GetBool("keep-tokens")
+		yes, _ := cmd.Flags().GetBool("yes")
+
+		// a dry run shows the plan instead of the resources, nothing is removed
+		if currentPlan != nil {
+			_, err := destroy(opts)
+			return err
+		}
+
+		plan, err := destroyPlan(opts)
+		if err != nil {
+			return err
+		}
+
+		fmt.Println("🧨 The following resources will be removed:")
+		for _, p := range plan {
+			fmt.Println("\t- " + p)
+		}
+		if !yes && !confirm(os.Stdin, os.Stdout, "Do you want to continue?") {
+			fmt.Println("👋 Nothing has been removed")
+			return nil
+		}
+
+		removed, err := destroy(opts)
+		for _, r := range removed {
+			fmt.Println("🗑️ Removed: " + r)
+		}
+		if err != nil {
+			return err
+		}
+
+		fmt.Println("👋 All the resources have been removed!")
+		return nil
+	},
+}
+
+// init add the destroy command to the sonar command
+func init() {
+	sonarCmd.AddCommand(destroyCmd)
+
+	destroyCmd.Flags().BoolP("keep-data", "", false, "Keep the database volumes and the admin password")
+	destroyCmd.Flags().BoolP("keep-tokens", "", false, "Keep the tokens in the credential store")
+	destroyCmd.Flags().BoolP("yes", "y", false, "Don't ask for confirmation")
+	planCommand(destroyCmd)
+}
+
+// destroyPlan returns the description of the resources that destroy will remove
+func destroyPlan(opts destroyOptions) ([]string, error) {
+	var plan []string
+
+	if isLocalHost(sonarHost) {
+		plan = append(plan, "containers: sonarqube, psql", "network: "+sonarNetwork)
+		if !opts.keepData {
+			plan = append(plan, "volumes: "+strings.Join(opts.compose.volumes(), ", "))
+		}
+		plan = append(plan, "file: "+filePath+fileName)
+	}
+
+	store, err := secretStore()
+	if err != nil {
+		return nil, err
+	}
+	if !opts.keepData && isLocalHost(sonarHost) {
+		plan = append(plan, "admin password: "+store.Name())
+	}
+	if !opts.keepTokens {
+		plan = append(plan, tokensRemoved(store))
+	}
+
+	return plan, nil
+}
+
+// destroy removes the resources and returns what has been removed
+func destroy(opts destroyOptions) ([]string, error) {
+	var removed []string
+
+	// the containers of a remote SonarQube are not managed by axectl
+	if isLocalHost(sonarHost) {
+		composeFile := filePath + fileName
+		// docker-compose needs the file to know what to remove
+		if _, err := os.Stat(composeFile); os.IsNotExist(err) {
+			content, err := dockerComposeFile(opts.compose)
+			if err != nil {
+				return removed, err
+			}
+			if err := writeFile(composeFile, []byte(content), 0644); err != nil {
+				return removed, err
+			}
+		}
+
+		if err := opts.runtime.Down(context.Background(), sonarProject(opts.compose), !opts.keepData); err != nil {
+			return removed, fmt.Errorf("the containers can't be removed: %w", err)
+		}
+
+		removed = append(removed, "containers: sonarqube, psql", "network: "+sonarNetwork)
+		if !opts.keepData {
+			removed = append(removed, "volumes: "+strings.Join(opts.compose.volumes(), ", "))
+		}
+
+		if err := removeFile(composeFile); err != nil {
+			return removed, err
+		}
+		removed = append(removed, "file: "+composeFile)
+	}
+
+	store, err := secretStore()
+	if err != nil {
+		return removed, err
+	}
+
+	// the admin password of a remote SonarQube is its only copy
+	if !opts.keepData && isLocalHost(sonarHost) {
+		if _, err := store.Get(adminPasswordKey); err == nil {
+			if err := store.Delete(adminPasswordKey); err != nil {
+				return removed, err
+			}
+			removed = append(removed, "admin password: "+store.Name())
+		} else if !errors.Is(err, credstore.ErrNotFound) {
+			return removed, err
+		}
+	}
+
+	if !opts.keepTokens {
+		names, err := localTokens()
+		if err != nil {
+			return removed, err
+		}
+		for _, name := range names {
+			// the tokens of a remote SonarQube would still be valid
+			if isLocalHost(sonarHost) {
+				err = removeToken(name)
+			} else {
+				err = revokeToken(context.Background(), opts.client, name)
+			}
+			if err != nil {
+				return removed, err
+			}
+		}
+		if len(names) > 0 {
+			removed = append(removed, tokensRemoved(store))
+		}
+	}
+
+	return removed, nil
+}
+
+// tokensRemoved returns the description of the tokens removed by destroy
+func tokensRemoved(store credstore.Store) string {
+	if isLocalHost(sonarHost) {
+		return "tokens: " + store.Name()
+	}
+	return "tokens: revoked in " + sonarHost + ", " + store.Name()
+}
+
+// confirm asks a yes/no question, only yes or y continue
+func confirm(in io.Reader, out io.Writer, question string) bool {
+	fmt.Fprint(out, "⚠️ "+question+" [y/N] > ")
+
+	answer, err := bufio.NewReader(in).ReadString('\n')
+	if err != nil && answer == "" {
+		return false
+	}
+
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return true
+	default:
+		return false
+	}
+}
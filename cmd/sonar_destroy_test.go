@@ -0,0 +1,94 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jrmanes/axectl/pkg/sonarapi"
+)
+
+// TestConfirm check the answers accepted by the confirmation prompt
+func TestConfirm(t *testing.T) {
+	var tests = []struct {
+		answer string
+		want   bool
+	}{
+		{"y\n", true},
+		{"YES\n", true},
+		{" yes \n", true},
+		{"n\n", false},
+		{"\n", false},
+		{"", false},
+		{"whatever\n", false},
+	}
+
+	for _, tt := range tests {
+		if got := confirm(strings.NewReader(tt.answer), ioutil.Discard, "continue?"); got != tt.want {
+			t.Errorf("ERROR: answer: %q, got: %t, want: %t", tt.answer, got, tt.want)
+		}
+	}
+}
+
+// TestDestroyLocalState check the local files removed for a remote SonarQube,
+// its tokens are revoked and its admin password is kept
+func TestDestroyLocalState(t *testing.T) {
+	defer func(h string) { sonarHost = h }(sonarHost)
+	sonarHost = "https://sonar.example.com"
+
+	var tests = []struct {
+		name   string
+		opts   destroyOptions
+		tokens bool
+		remote int
+	}{
+		{"keep everything", destroyOptions{keepData: true, keepTokens: true}, true, 3},
+		{"keep tokens", destroyOptions{keepTokens: true}, true, 3},
+		{"keep data", destroyOptions{keepData: true}, false, 1},
+		{"remove everything", destroyOptions{}, false, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			home := t.TempDir()
+			t.Setenv("HOME", home)
+			if err := storeAdminPassword("s3cret-Pass"); err != nil {
+				t.Fatalf("ERROR: %v", err)
+			}
+			if err := writeToken("axectl", "squ_1"); err != nil {
+				t.Fatalf("ERROR: %v", err)
+			}
+			remote := map[string]bool{"axectl": true, "axectl" + tokenRotated + "2021-12-01T00:00:00Z": true, "other": true}
+			srv := fakeSonarTokens(remote)
+			defer srv.Close()
+			tt.opts.client = sonarapi.NewClient(srv.URL)
+
+			plan, err := destroyPlan(tt.opts)
+			if err != nil {
+				t.Fatalf("ERROR: %v", err)
+			}
+			removed, err := destroy(tt.opts)
+			if err != nil {
+				t.Fatalf("ERROR: %v", err)
+			}
+			// everything in the plan has been removed
+			if strings.Join(plan, ",") != strings.Join(removed, ",") {
+				t.Errorf("ERROR: plan: %v, removed: %v", plan, removed)
+			}
+
+			if _, err := os.Stat(filepath.Join(home, adminPasswordFile)); err != nil {
+				t.Errorf("ERROR: the admin password of a remote SonarQube was removed: %v", err)
+			}
+			_, err = readToken("axectl")
+			if (err == nil) != tt.tokens {
+				t.Errorf("ERROR: token exists: %t, want: %t", err == nil, tt.tokens)
+			}
+			// only the tokens of the projects removed are revoked, the rotated ones too
+			if len(remote) != tt.remote || !remote["other"] {
+				t.Errorf("ERROR: remote tokens: %v", remote)
+			}
+		})
+	}
+}
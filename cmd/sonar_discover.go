@@ -0,0 +1,206 @@
+/*
+Copyright © 2021 Jose Ramon Mañes jr.mb47@gmail.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// skippedFolders folders which never contain a project to scan
+var skippedFolders = []string{"node_modules", "vendor", "target", "build", "dist", "__pycache__"}
+
+// invalidKeyChars characters which are not allowed in a project key
+var invalidKeyChars = regexp.MustCompile(`[^A-Za-z0-9_.-]+`)
+
+// discoverOptions how to find the projects
+type discoverOptions struct {
+	// enabled when --discover is used
+	enabled bool
+	// include globs of the project folders to use, all of them when it's empty
+	include []string
+	// exclude globs of the project folders to skip
+	exclude []string
+	// organization prefix of the project keys
+	organization string
+	// defaults projects of the config used when there are no arguments
+	defaults []string
+}
+
+// discoveredProject is a buildable unit found in the current path
+type discoveredProject struct {
+	// dir folder of the project, relative to the current path, with / as separator
+	dir string
+	// key of the project in SonarQube
+	key string
+	// language detected from the project markers
+	language string
+}
+
+// addDiscoverFlags adds the flags to find the projects
+func addDiscoverFlags(cmd *cobra.Command) {
+	cmd.Flags().BoolP("discover", "", false, "Find the projects in the current path by their go.mod, package.json, pom.xml, build.gradle, pyproject.toml or Cargo.toml")
+	cmd.Flags().StringArrayP("include", "", nil, "Glob of the project folders to use with --discover, example: 'services/*', it can be repeated")
+	cmd.Flags().StringArrayP("exclude", "", nil, "Glob of the project folders to skip with --discover, example: 'legacy', it can be repeated")
+}
+
+// discoverFlags returns the options of the flags added by addDiscoverFlags
+func discoverFlags(cmd *cobra.Command) discoverOptions {
+	opts := discoverOptions{}
+	opts.enabled, _ = cmd.Flags().GetBool("discover")
+	opts.include, _ = cmd.Flags().GetStringArray("include")
+	opts.exclude, _ = cmd.Flags().GetStringArray("exclude")
+	opts.organization, _ = cmd.Flags().GetString("organization")
+	if !cmd.Flags().Changed("organization") {
+		opts.organization = viper.GetString("sonar.organization")
+	}
+	opts.defaults = viper.GetStringSlice("sonar.projects")
+	return opts
+}
+
+// commandProjects returns the projects of the arguments, or the ones of the config
+// without arguments, or the discovered ones in root with --discover, the key of a
+// project given as argument is its folder
+func commandProjects(root string, args []string, opts discoverOptions) ([]discoveredProject, error) {
+	if !opts.enabled {
+		if len(opts.include) > 0 || len(opts.exclude) > 0 {
+			return nil, errors.New("--include and --exclude need --discover")
+		}
+		if len(args) == 0 {
+			args = opts.defaults
+		}
+		dirs, err := projectArgs(args)
+		if err != nil {
+			return nil, err
+		}
+		var projects []discoveredProject
+		for _, d := range dirs {
+			projects = append(projects, discoveredProject{dir: d, key: d, language: detectLanguage(filepath.Join(root, d))})
+		}
+		return projects, nil
+	}
+
+	if len(args) > 0 {
+		return nil, errors.New("the projects are found with --discover, don't pass them as arguments")
+	}
+	for _, g := range append(append([]string{}, opts.include...), opts.exclude...) {
+		if _, err := path.Match(g, ""); err != nil {
+			return nil, fmt.Errorf("invalid glob %s: %w", g, err)
+		}
+	}
+
+	projects, err := discoverProjects(root, opts)
+	if err != nil {
+		return nil, err
+	}
+	if len(projects) == 0 {
+		return nil, errors.New("no projects found in the folders of " + root)
+	}
+	return projects, nil
+}
+
+// discoverProjects walks root and returns the folders with a project marker,
+// the folders inside a project are not checked, they are part of it
+func discoverProjects(root string, opts discoverOptions) ([]discoveredProject, error) {
+	var projects []discoveredProject
+
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() || p == root {
+			return nil
+		}
+
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+
+		// hidden folders, dependencies, build outputs and excluded folders
+		if strings.HasPrefix(d.Name(), ".") || contains(skippedFolders, d.Name()) || matchGlobs(opts.exclude, rel) {
+			return filepath.SkipDir
+		}
+
+		language := detectLanguage(p)
+		if language == "" {
+			return nil
+		}
+		if len(opts.include) == 0 || matchGlobs(opts.include, rel) {
+			projects = append(projects, discoveredProject{dir: rel, key: discoveredKey(opts.organization, rel), language: language})
+		}
+		return filepath.SkipDir
+	})
+
+	return projects, err
+}
+
+// matchGlobs check if the folder, or any of its parents, matches any of the globs
+func matchGlobs(globs []string, dir string) bool {
+	for _, g := range globs {
+		for d := dir; d != "." && d != "/"; d = path.Dir(d) {
+			if ok, _ := path.Match(g, d); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// discoveredKey returns the key of the project in the folder dir, prefixed by the
+// organization when there is one, example: acme_services-api
+func discoveredKey(organization, dir string) string {
+	key := invalidKeyChars.ReplaceAllString(strings.ReplaceAll(dir, "/", "-"), "-")
+	if organization != "" {
+		key = invalidKeyChars.ReplaceAllString(organization, "-") + "_" + key
+	}
+	return key
+}
+
+// projectKeys returns the keys of the projects
+func projectKeys(projects []discoveredProject) []string {
+	var keys []string
+	for _, p := range projects {
+		keys = append(keys, p.key)
+	}
+	return keys
+}
+
+// printProjects prints the projects and what would be done with them
+func printProjects(out io.Writer, projects []discoveredProject, action string) {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "FOLDER\tKEY\tLANGUAGE")
+	for _, p := range projects {
+		language := p.language
+		if language == "" {
+			language = "-"
+		}
+		fmt.Fprintln(w, p.dir+"\t"+p.key+"\t"+language)
+	}
+	w.Flush()
+	fmt.Fprintf(out, "🔎 Dry run, %d projects would be %s\n", len(projects), action)
+}
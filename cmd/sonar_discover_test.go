@@ -0,0 +1,99 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestDiscoverProjects check the projects found in a monorepo
+func TestDiscoverProjects(t *testing.T) {
+	root := t.TempDir()
+	files := []string{
+		"go.mod",
+		"services/api/go.mod",
+		"services/api/internal/tools/go.mod",
+		"services/web/package.json",
+		"services/web/node_modules/left-pad/package.json",
+		"libs/core/pom.xml",
+		"libs/core/module/pom.xml",
+		"tools/cli/Cargo.toml",
+		"legacy/app/pyproject.toml",
+		".github/actions/lint/package.json",
+		"docs/README.md",
+	}
+	for _, f := range files {
+		path := filepath.Join(root, f)
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, nil, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var tests = []struct {
+		name string
+		opts discoverOptions
+		want string
+	}{
+		{"all", discoverOptions{}, "legacy/app=legacy-app,libs/core=libs-core,services/api=services-api,services/web=services-web,tools/cli=tools-cli"},
+		{"include", discoverOptions{include: []string{"services/*", "tools"}}, "services/api=services-api,services/web=services-web,tools/cli=tools-cli"},
+		{"exclude", discoverOptions{exclude: []string{"legacy", "*/web"}}, "libs/core=libs-core,services/api=services-api,tools/cli=tools-cli"},
+		{"organization", discoverOptions{include: []string{"libs/*"}, organization: "acme corp"}, "libs/core=acme-corp_libs-core"},
+	}
+
+	for _, tt := range tests {
+		projects, err := discoverProjects(root, tt.opts)
+		if err != nil {
+			t.Fatalf("ERROR: %s: %v", tt.name, err)
+		}
+		var got []string
+		for _, p := range projects {
+			got = append(got, p.dir+"="+p.key)
+		}
+		if strings.Join(got, ",") != tt.want {
+			t.Errorf("ERROR: %s: %s\nwant: %s", tt.name, strings.Join(got, ","), tt.want)
+		}
+	}
+}
+
+// TestCommandProjects check the projects of the arguments and the flags
+func TestCommandProjects(t *testing.T) {
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "api"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "api", "go.mod"), nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	var tests = []struct {
+		name string
+		args []string
+		opts discoverOptions
+		want string
+		err  bool
+	}{
+		{"arguments", []string{"api,web"}, discoverOptions{}, "api=api,web=web", false},
+		{"projects of the config", nil, discoverOptions{defaults: []string{"api", "web,cli"}}, "api=api,web=web,cli=cli", false},
+		{"arguments before the config", []string{"web"}, discoverOptions{defaults: []string{"api"}}, "web=web", false},
+		{"discover", nil, discoverOptions{enabled: true}, "api=api", false},
+		{"discover with arguments", []string{"api"}, discoverOptions{enabled: true}, "", true},
+		{"include without discover", []string{"api"}, discoverOptions{include: []string{"api"}}, "", true},
+		{"invalid glob", nil, discoverOptions{enabled: true, exclude: []string{"[a-"}}, "", true},
+		{"nothing found", nil, discoverOptions{enabled: true, include: []string{"web"}}, "", true},
+	}
+
+	for _, tt := range tests {
+		projects, err := commandProjects(root, tt.args, tt.opts)
+		var got []string
+		for _, p := range projects {
+			got = append(got, p.dir+"="+p.key)
+		}
+		if (err != nil) != tt.err || strings.Join(got, ",") != tt.want {
+			t.Errorf("ERROR: %s: %v, %v", tt.name, got, err)
+		}
+	}
+}
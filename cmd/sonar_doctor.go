@@ -0,0 +1,567 @@
+/*
+Copyright © 2021 Jose Ramon Mañes jr.mb47@gmail.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/user"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/jrmanes/axectl/pkg/container"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
+)
+
+// results of the checks of the doctor
+const (
+	checkPass = "pass"
+	checkWarn = "warn"
+	checkFail = "fail"
+)
+
+// requirements of the host to run SonarQube
+// https://docs.sonarqube.org/latest/requirements/requirements/
+const (
+	minMaxMapCount = 262144
+	minFileMax     = 131072
+	// minMemory SonarQube, its Elasticsearch and postgres need 2GB at least
+	minMemory = 2 << 30
+	// minDisk and lowDisk free space for the images and the volumes
+	minDisk = 2 << 30
+	lowDisk = 10 << 30
+)
+
+// procSys and meminfoFile tell the kernel settings and the memory of Linux
+var (
+	procSys     = "/proc/sys"
+	meminfoFile = "/proc/meminfo"
+)
+
+// checkResult is the result of a check of the doctor
+type checkResult struct {
+	// Name of the check
+	Name string `json:"name" yaml:"name"`
+	// Result pass, warn or fail
+	Result string `json:"result" yaml:"result"`
+	// Message what has been found
+	Message string `json:"message" yaml:"message"`
+	// Hint how to fix it, empty when it passes
+	Hint string `json:"hint,omitempty" yaml:"hint,omitempty"`
+}
+
+// doctorOptions what the doctor checks
+type doctorOptions struct {
+	// runner executes the commands which tell the versions
+	runner Runner
+	// runtime name of the selected runtime: docker or podman
+	runtime string
+	// compose settings, the ports and the platform of the containers
+	compose composeOptions
+	// local false when SonarQube is remote, its containers are not checked
+	local bool
+}
+
+// doctorFormats renderers of every doctor format
+var doctorFormats = map[string]func(io.Writer, []checkResult) error{
+	"json":  renderDoctorJSON,
+	"yaml":  renderDoctorYAML,
+	"table": renderDoctorTable,
+}
+
+// doctorCmd checks the system before starting SonarQube
+var doctorCmd = &cobra.Command{
+	Use:   "doctor",
+	Short: "Check the system before starting SonarQube",
+	Long: `Check everything SonarQube needs before starting it: the container runtime,
+compose and their versions, the daemon, the docker group, the kernel settings,
+the free ports, the disk, the memory and the architecture. Every check passes,
+warns or fails, with a hint to fix it. It exits with error when a check fails.
+
+USAGE Examples:
+
+axectl sonar doctor
+axectl sonar doctor --runtime podman
+axectl sonar doctor -o json | jq '.[] | select(.result == "fail")'`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// load the SonarQube host and the compose settings
+		if err := loadSonarConfig(cmd); err != nil {
+			return err
+		}
+
+		format, _ := cmd.Flags().GetString("output")
+		render, ok := doctorFormats[format]
+		if !ok {
+			return errors.New("unknown output " + format + ", use one of: json, yaml, table")
+		}
+
+		name, err := selectedRuntime()
+		if err != nil {
+			return err
+		}
+		// auto without any runtime installed
+		if name == runtimeAuto {
+			name = runtimeDocker
+		}
+		compose, err := loadComposeOptions()
+		if err != nil {
+			return err
+		}
+		debug, _ := cmd.Flags().GetBool("debug")
+
+		opts := doctorOptions{runner: newRunner(debug), runtime: name, compose: compose, local: isLocalHost(sonarHost)}
+		results := doctor(context.Background(), opts)
+		if err := render(cmd.OutOrStdout(), results); err != nil {
+			return err
+		}
+
+		if failed := countResults(results, checkFail); failed > 0 {
+			cmd.SilenceUsage = true
+			return fmt.Errorf("%d checks failed", failed)
+		}
+		return nil
+	},
+}
+
+// init add the doctor command to the sonar command
+func init() {
+	sonarCmd.AddCommand(doctorCmd)
+
+	doctorCmd.Flags().StringP("output", "o", "table", "Output format: json, yaml or table")
+}
+
+// doctor runs all the checks, the ones of the containers only for a local SonarQube
+func doctor(ctx context.Context, opts doctorOptions) []checkResult {
+	daemon := checkDaemon(ctx, opts.runner, opts.runtime)
+	results := []checkResult{
+		checkRuntimeVersion(ctx, opts.runner, opts.runtime),
+		checkComposeVersion(ctx, opts.runner, opts.runtime),
+		daemon,
+	}
+	// podman runs rootless, docker needs the group
+	if opts.runtime == runtimeDocker && detectOS() == "linux" {
+		results = append(results, checkDockerGroup(daemon.Result == checkPass))
+	}
+	results = append(results, checkPlatform(runtime.GOOS, runtime.GOARCH, opts.compose.Platform))
+	if !opts.local {
+		return results
+	}
+
+	running := runningServices(ctx, opts.runtime)
+	results = append(results,
+		checkSysctl("vm.max_map_count", minMaxMapCount),
+		checkSysctl("fs.file-max", minFileMax),
+		checkPort(opts.compose.Port, "sonarqube", running),
+	)
+	if opts.compose.PostgresPort != 0 {
+		results = append(results, checkPort(opts.compose.PostgresPort, "psql", running))
+	}
+	return append(results, checkDisk(storagePath(opts.runtime)), checkMemory())
+}
+
+// countResults returns the number of checks with the result
+func countResults(results []checkResult, result string) int {
+	n := 0
+	for _, r := range results {
+		if r.Result == result {
+			n++
+		}
+	}
+	return n
+}
+
+// installHint returns how to install the runtime with axectl
+func installHint(name string) string {
+	if name == runtimePodman {
+		return "axectl sonar install --runtime podman"
+	}
+	return "axectl sonar install"
+}
+
+// firstLine returns the first line of the output of a command
+func firstLine(output string) string {
+	return strings.TrimSpace(strings.SplitN(strings.TrimSpace(output), "\n", 2)[0])
+}
+
+// checkRuntimeVersion check the runtime command is installed and its version
+func checkRuntimeVersion(ctx context.Context, r Runner, name string) checkResult {
+	result := checkResult{Name: name}
+	if !CommandExists(name) {
+		result.Result, result.Message, result.Hint = checkFail, name+" is not installed", installHint(name)
+		return result
+	}
+
+	out, err := r.Output(ctx, Command{command: name, args: []string{"--version"}})
+	if err != nil {
+		result.Result, result.Message, result.Hint = checkFail, err.Error(), "reinstall "+name+": "+installHint(name)
+		return result
+	}
+	result.Result, result.Message = checkPass, firstLine(out)
+	return result
+}
+
+// checkComposeVersion check compose is installed and its version, it's only
+// needed when the Engine API doesn't answer
+func checkComposeVersion(ctx context.Context, r Runner, name string) checkResult {
+	standalone := pkgCompose
+	if name == runtimePodman {
+		standalone = pkgPodmanCompose
+	}
+	result := checkResult{Name: "compose"}
+
+	compose := container.DetectCompose(ctx, cliRunner{runner: r}, name, standalone)
+	if compose == nil {
+		result.Result, result.Message, result.Hint = checkWarn, "neither "+name+" compose nor "+standalone+" are installed, they are needed when the Engine API doesn't answer", installHint(name)
+		return result
+	}
+
+	args := append(append([]string{}, compose[1:]...), "version")
+	out, err := r.Output(ctx, Command{command: compose[0], args: args})
+	if err != nil {
+		result.Result, result.Message, result.Hint = checkFail, err.Error(), "reinstall "+standalone+": "+installHint(name)
+		return result
+	}
+	result.Result, result.Message = checkPass, firstLine(out)
+	return result
+}
+
+// checkDaemon check the Engine API socket answers, or the daemon answers to the runtime command
+func checkDaemon(ctx context.Context, r Runner, name string) checkResult {
+	result := checkResult{Name: "daemon"}
+
+	socket, ok := dockerSocket()
+	hint := "start docker: sudo systemctl enable --now docker, or open Docker Desktop"
+	if name == runtimePodman {
+		socket, ok = podmanSocket()
+		hint = "enable the socket of podman: systemctl --user enable --now podman.socket"
+	}
+	if ok && ping(container.NewEngine(socket)) {
+		result.Result, result.Message = checkPass, "the Engine API answers in "+socket
+		return result
+	}
+
+	if !CommandExists(name) {
+		result.Result, result.Message, result.Hint = checkFail, name+" is not installed", installHint(name)
+		return result
+	}
+	if _, err := r.Output(ctx, Command{command: name, args: []string{"info"}}); err != nil {
+		result.Result, result.Message, result.Hint = checkFail, "the daemon doesn't answer: "+err.Error(), hint
+		return result
+	}
+
+	// podman works without its socket
+	result.Result, result.Message = checkPass, "the daemon answers to "+name+", the Engine API is not reachable"
+	if name == runtimeDocker {
+		result.Result, result.Hint = checkWarn, "check the permissions of "+socket
+	}
+	return result
+}
+
+// checkDockerGroup check the user is in the docker group, the daemon answers
+// without it to root and to rootless docker
+func checkDockerGroup(daemon bool) checkResult {
+	u, err := user.Current()
+	if err != nil {
+		return checkResult{Name: "docker group", Result: checkWarn, Message: err.Error()}
+	}
+	group, err := user.LookupGroup("docker")
+	if err != nil {
+		return dockerGroupResult(u.Username, nil, nil, daemon)
+	}
+	gids, err := u.GroupIds()
+	if err != nil {
+		return checkResult{Name: "docker group", Result: checkWarn, Message: err.Error()}
+	}
+	return dockerGroupResult(u.Username, gids, group, daemon)
+}
+
+// dockerGroupResult returns the result of the docker group check of the user
+// with the groups gids, group is nil when it doesn't exist
+func dockerGroupResult(username string, gids []string, group *user.Group, daemon bool) checkResult {
+	result := checkResult{Name: "docker group"}
+	switch {
+	case username == "root":
+		result.Result, result.Message = checkPass, "root doesn't need the docker group"
+	case group != nil && contains(gids, group.Gid):
+		result.Result, result.Message = checkPass, username+" is in the docker group"
+	case daemon:
+		result.Result, result.Message = checkPass, username+" is not in the docker group, but the daemon answers"
+	case group == nil:
+		result.Result, result.Message, result.Hint = checkFail, "the docker group doesn't exist", "reinstall docker: axectl sonar install"
+	default:
+		result.Result, result.Message, result.Hint = checkFail, username+" is not in the docker group", "sudo usermod -aG docker "+username+", then logout/login or run: newgrp docker"
+	}
+	return result
+}
+
+// readSysctl returns the value of a kernel setting, example: vm.max_map_count
+func readSysctl(name string) (int64, error) {
+	data, err := os.ReadFile(filepath.Join(procSys, strings.ReplaceAll(name, ".", "/")))
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+}
+
+// checkSysctl check the kernel setting is min at least, Elasticsearch doesn't
+// start with lower values
+func checkSysctl(name string, min int64) checkResult {
+	result := checkResult{Name: name}
+	if detectOS() != "linux" {
+		result.Result, result.Message = checkWarn, "it's set in the Linux VM of the runtime, it can't be checked from "+detectOS()
+		result.Hint = "axectl sonar up sets it in the VM"
+		return result
+	}
+
+	value, err := readSysctl(name)
+	if err != nil {
+		result.Result, result.Message = checkWarn, err.Error()
+		return result
+	}
+	if value < min {
+		result.Result, result.Message = checkFail, fmt.Sprintf("%d, it must be %d at least", value, min)
+		result.Hint = fmt.Sprintf("sudo sysctl -w %s=%d, or keep it across reboots with: axectl sonar up --persist-sysctl", name, min)
+		return result
+	}
+	result.Result, result.Message = checkPass, strconv.FormatInt(value, 10)
+	return result
+}
+
+// runningServices returns the services of the SonarQube containers which are running
+func runningServices(ctx context.Context, name string) []string {
+	rt, err := detectRuntime(name)
+	if err != nil {
+		return nil
+	}
+	opts, err := loadComposeOptions()
+	if err != nil {
+		return nil
+	}
+	containers, err := rt.Status(ctx, sonarProject(opts))
+	if err != nil {
+		return nil
+	}
+
+	var running []string
+	for _, c := range containers {
+		if c.State == container.StateRunning {
+			running = append(running, c.Service)
+		}
+	}
+	return running
+}
+
+// checkPort check the port is free, or used by the container of the service
+func checkPort(port int, service string, running []string) checkResult {
+	result := checkResult{Name: "port " + strconv.Itoa(port)}
+
+	l, err := net.Listen("tcp", ":"+strconv.Itoa(port))
+	if err == nil {
+		l.Close()
+		result.Result, result.Message = checkPass, "free for "+service
+		return result
+	}
+	if contains(running, service) {
+		result.Result, result.Message = checkPass, "used by the "+service+" container, which is running"
+		return result
+	}
+
+	key := "sonar.port"
+	if service == "psql" {
+		key = "sonar.postgres.port"
+	}
+	result.Result, result.Message = checkFail, "it's in use, "+service+" can't be published: "+err.Error()
+	result.Hint = "stop the process which uses it, or use another port: axectl config set " + key + " " + strconv.Itoa(port+1)
+	return result
+}
+
+// storagePath returns the folder where the runtime stores the images and the
+// volumes, the home of the user when it doesn't exist, like in macOS
+func storagePath(name string) string {
+	home, _ := os.UserHomeDir()
+	paths := []string{"/var/lib/docker"}
+	if name == runtimePodman {
+		paths = []string{filepath.Join(home, ".local", "share", "containers"), "/var/lib/containers"}
+	}
+	for _, p := range paths {
+		if fileExists(p) {
+			return p
+		}
+	}
+	return home
+}
+
+// checkDisk check the free space where the images and the volumes are stored
+func checkDisk(path string) checkResult {
+	result := checkResult{Name: "disk"}
+	free, err := freeDisk(path)
+	if err != nil {
+		result.Result, result.Message = checkWarn, "the free space can't be checked: "+err.Error()
+		return result
+	}
+
+	result.Message = gigabytes(free) + " free in " + path
+	switch {
+	case free < minDisk:
+		result.Result, result.Hint = checkFail, "free "+gigabytes(minDisk)+" at least, docker system prune removes the unused images"
+	case free < lowDisk:
+		result.Result, result.Hint = checkWarn, "the images and the database need more space as the projects grow"
+	default:
+		result.Result = checkPass
+	}
+	return result
+}
+
+// readMeminfo returns the total and the available memory of Linux in bytes
+func readMeminfo() (uint64, uint64, error) {
+	f, err := os.Open(meminfoFile)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+
+	// example: MemTotal:       16318004 kB
+	values := map[string]uint64{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		v, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		values[strings.TrimSuffix(fields[0], ":")] = v * 1024
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, 0, err
+	}
+	if values["MemTotal"] == 0 {
+		return 0, 0, errors.New("there is no MemTotal in " + meminfoFile)
+	}
+	return values["MemTotal"], values["MemAvailable"], nil
+}
+
+// checkMemory check there is memory enough for SonarQube and postgres
+func checkMemory() checkResult {
+	result := checkResult{Name: "memory"}
+	if detectOS() != "linux" {
+		result.Result, result.Message = checkWarn, "the containers use the memory of the Linux VM of the runtime, it can't be checked from "+detectOS()
+		result.Hint = "give " + gigabytes(2*minMemory) + " of memory at least to Docker Desktop or the podman machine"
+		return result
+	}
+
+	total, available, err := readMeminfo()
+	if err != nil {
+		result.Result, result.Message = checkWarn, err.Error()
+		return result
+	}
+
+	result.Message = gigabytes(available) + " available of " + gigabytes(total)
+	switch {
+	case total < minMemory:
+		result.Result, result.Hint = checkFail, "SonarQube needs "+gigabytes(minMemory)+" at least"
+	case available < minMemory:
+		result.Result, result.Hint = checkWarn, "close some applications, SonarQube needs "+gigabytes(minMemory)
+	default:
+		result.Result = checkPass
+	}
+	return result
+}
+
+// checkPlatform check there are images of SonarQube for the architecture, and
+// if they run emulated
+func checkPlatform(goos, arch, platform string) checkResult {
+	result := checkResult{Name: "platform"}
+	if goos != "linux" && goos != "darwin" {
+		result.Result, result.Message, result.Hint = checkWarn, goos+" is not supported", "run axectl in WSL2"
+		return result
+	}
+
+	image := arch
+	if platform != "" {
+		image = platform[strings.LastIndex(platform, "/")+1:]
+	}
+	result.Message = goos + "/" + arch + ", the images are linux/" + image
+	switch {
+	case image != "amd64" && image != "arm64":
+		result.Result, result.Hint = checkFail, "there are no images of SonarQube for "+image
+	case image != arch:
+		result.Result, result.Hint = checkWarn, "the images run emulated and slower, in Docker Desktop enable Rosetta for x86_64/amd64 emulation"
+	default:
+		result.Result = checkPass
+	}
+	return result
+}
+
+// gigabytes returns the bytes in GB with one decimal
+func gigabytes(b uint64) string {
+	return strconv.FormatFloat(float64(b)/(1<<30), 'f', 1, 64) + " GB"
+}
+
+// resultIcons icons of the results in the table
+var resultIcons = map[string]string{
+	checkPass: "✅",
+	checkWarn: "⚠️",
+	checkFail: "❌",
+}
+
+// renderDoctorJSON writes the checks as JSON
+func renderDoctorJSON(out io.Writer, results []checkResult) error {
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(results)
+}
+
+// renderDoctorYAML writes the checks as YAML
+func renderDoctorYAML(out io.Writer, results []checkResult) error {
+	data, err := yaml.Marshal(results)
+	if err != nil {
+		return err
+	}
+	_, err = out.Write(data)
+	return err
+}
+
+// renderDoctorTable writes the checks to read them in the terminal, with the
+// hints under the ones which don't pass
+func renderDoctorTable(out io.Writer, results []checkResult) error {
+	fmt.Fprintln(out, "🩺 Checking the system to run SonarQube:")
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	for _, r := range results {
+		fmt.Fprintln(w, r.Name+"\t"+resultIcons[r.Result]+" "+r.Message)
+		if r.Hint != "" {
+			fmt.Fprintln(w, "\t💡 "+r.Hint)
+		}
+	}
+	w.Flush()
+
+	fmt.Fprintf(out, "\n%d passed, %d with warnings, %d failed\n", countResults(results, checkPass), countResults(results, checkWarn), countResults(results, checkFail))
+	return nil
+}
@@ -0,0 +1,29 @@
+//go:build !linux && !darwin
+// +build !linux,!darwin
+
+/*
+Copyright © 2021 Jose Ramon Mañes jr.mb47@gmail.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"errors"
+	"runtime"
+)
+
+// freeDisk returns the bytes available to the user in the file system of the path
+func freeDisk(path string) (uint64, error) {
+	return 0, errors.New("not supported in " + runtime.GOOS)
+}
@@ -0,0 +1,201 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"os"
+	"os/user"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// TestCheckSysctl check the kernel settings are read from /proc/sys
+func TestCheckSysctl(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("the kernel settings are only checked in linux")
+	}
+	defer func(dir string) { procSys = dir }(procSys)
+	procSys = t.TempDir()
+	if err := os.MkdirAll(filepath.Join(procSys, "vm"), 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	var tests = []struct {
+		value  string
+		result string
+		hint   string
+	}{
+		{"262144\n", checkPass, ""},
+		{"1048576\n", checkPass, ""},
+		{"65530\n", checkFail, "sudo sysctl -w vm.max_map_count=262144, or keep it across reboots with: axectl sonar up --persist-sysctl"},
+		{"", checkWarn, ""},
+	}
+
+	for _, tt := range tests {
+		if err := os.WriteFile(filepath.Join(procSys, "vm", "max_map_count"), []byte(tt.value), 0600); err != nil {
+			t.Fatal(err)
+		}
+		r := checkSysctl("vm.max_map_count", minMaxMapCount)
+		if r.Result != tt.result || r.Hint != tt.hint {
+			t.Errorf("ERROR: %q: %+v", tt.value, r)
+		}
+	}
+}
+
+// TestDockerGroupResult check the users which can use the docker daemon
+func TestDockerGroupResult(t *testing.T) {
+	group := &user.Group{Gid: "998", Name: "docker"}
+
+	var tests = []struct {
+		name     string
+		username string
+		gids     []string
+		group    *user.Group
+		daemon   bool
+		result   string
+	}{
+		{"in the group", "jr", []string{"1000", "998"}, group, false, checkPass},
+		{"root", "root", []string{"0"}, group, false, checkPass},
+		{"rootless docker", "jr", []string{"1000"}, group, true, checkPass},
+		{"not in the group", "jr", []string{"1000"}, group, false, checkFail},
+		{"no group", "jr", []string{"1000"}, nil, false, checkFail},
+	}
+
+	for _, tt := range tests {
+		r := dockerGroupResult(tt.username, tt.gids, tt.group, tt.daemon)
+		if r.Result != tt.result || (r.Result == checkFail) != (r.Hint != "") {
+			t.Errorf("ERROR: %s: %+v", tt.name, r)
+		}
+	}
+}
+
+// TestCheckPort check the ports in use are only fine for the running containers
+func TestCheckPort(t *testing.T) {
+	l, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	port := l.Addr().(*net.TCPAddr).Port
+
+	if r := checkPort(port, "sonarqube", nil); r.Result != checkFail || !strings.Contains(r.Hint, "axectl config set sonar.port") {
+		t.Errorf("ERROR: port in use: %+v", r)
+	}
+	if r := checkPort(port, "psql", []string{"psql"}); r.Result != checkPass {
+		t.Errorf("ERROR: port of the running container: %+v", r)
+	}
+	l.Close()
+	if r := checkPort(port, "sonarqube", nil); r.Result != checkPass {
+		t.Errorf("ERROR: free port: %+v", r)
+	}
+}
+
+// TestCheckPlatform check the architectures with images of SonarQube
+func TestCheckPlatform(t *testing.T) {
+	var tests = []struct {
+		goos     string
+		arch     string
+		platform string
+		result   string
+	}{
+		{"linux", "amd64", "", checkPass},
+		{"linux", "arm64", "", checkPass},
+		{"darwin", "amd64", "linux/amd64", checkPass},
+		{"darwin", "arm64", "linux/amd64", checkWarn},
+		{"linux", "riscv64", "", checkFail},
+		{"windows", "amd64", "", checkWarn},
+	}
+
+	for _, tt := range tests {
+		if r := checkPlatform(tt.goos, tt.arch, tt.platform); r.Result != tt.result {
+			t.Errorf("ERROR: %s/%s %s: %+v", tt.goos, tt.arch, tt.platform, r)
+		}
+	}
+}
+
+// TestCheckMemory check the memory is read from /proc/meminfo
+func TestCheckMemory(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("the memory is only checked in linux")
+	}
+	defer func(file string) { meminfoFile = file }(meminfoFile)
+	meminfoFile = filepath.Join(t.TempDir(), "meminfo")
+
+	var tests = []struct {
+		meminfo string
+		result  string
+		message string
+	}{
+		{"MemTotal:       16318004 kB\nMemFree:         1318004 kB\nMemAvailable:    8159002 kB\n", checkPass, "7.8 GB available of 15.6 GB"},
+		{"MemTotal:       16318004 kB\nMemAvailable:    1048576 kB\n", checkWarn, "1.0 GB available of 15.6 GB"},
+		{"MemTotal:        1048576 kB\nMemAvailable:     524288 kB\n", checkFail, "0.5 GB available of 1.0 GB"},
+		{"MemFree:         1318004 kB\n", checkWarn, "there is no MemTotal in " + meminfoFile},
+	}
+
+	for _, tt := range tests {
+		if err := os.WriteFile(meminfoFile, []byte(tt.meminfo), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if r := checkMemory(); r.Result != tt.result || r.Message != tt.message {
+			t.Errorf("ERROR: %q: %+v", tt.meminfo, r)
+		}
+	}
+}
+
+// TestCheckRuntimeVersion check the versions of the runtime and compose
+func TestCheckRuntimeVersion(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake commands need a shell")
+	}
+	bin := t.TempDir()
+	for _, c := range []string{"podman", "podman-compose"} {
+		if err := os.WriteFile(filepath.Join(bin, c), []byte("#!/bin/sh\n"), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("PATH", bin)
+
+	r := &fakeRunner{
+		outputs: map[string]string{"podman --version": "podman version 4.9.3\n"},
+		errors: map[string]error{
+			"podman compose version":                          errors.New("exit status 125"),
+			filepath.Join(bin, "podman-compose") + " version": errors.New("exit status 1"),
+		},
+	}
+	ctx := context.Background()
+	if res := checkRuntimeVersion(ctx, r, runtimePodman); res.Result != checkPass || res.Message != "podman version 4.9.3" {
+		t.Errorf("ERROR: podman: %+v", res)
+	}
+	if res := checkComposeVersion(ctx, r, runtimePodman); res.Result != checkFail {
+		t.Errorf("ERROR: broken podman-compose: %+v", res)
+	}
+	if res := checkRuntimeVersion(ctx, r, runtimeDocker); res.Result != checkFail || res.Hint != "axectl sonar install" {
+		t.Errorf("ERROR: docker is not installed: %+v", res)
+	}
+}
+
+// TestRenderDoctorTable check the hints are shown under the checks
+func TestRenderDoctorTable(t *testing.T) {
+	results := []checkResult{
+		{Name: "docker", Result: checkPass, Message: "Docker version 24.0.7"},
+		{Name: "vm.max_map_count", Result: checkFail, Message: "65530, it must be 262144 at least", Hint: "sudo sysctl -w vm.max_map_count=262144"},
+	}
+	var out bytes.Buffer
+	if err := renderDoctorTable(&out, results); err != nil {
+		t.Fatal(err)
+	}
+	want := `🩺 Checking the system to run SonarQube:
+docker            ✅ Docker version 24.0.7
+vm.max_map_count  ❌ 65530, it must be 262144 at least
+                  💡 sudo sysctl -w vm.max_map_count=262144
+
+1 passed, 0 with warnings, 1 failed
+`
+	if out.String() != want {
+		t.Errorf("ERROR: table:\n%s\nwant:\n%s", out.String(), want)
+	}
+}
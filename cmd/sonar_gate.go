@@ -0,0 +1,125 @@
+/*
+Copyright © 2021 Jose Ramon Mañes jr.mb47@gmail.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/jrmanes/axectl/pkg/sonarapi"
+)
+
+// scannerWorkDir working directory of the scanner, relative to the project base dir
+const scannerWorkDir = ".scannerwork"
+
+// workingDirectory returns the working directory of the scanner for the project,
+// relative to its base dir, every project has its own one
+func workingDirectory(sp scanProject) string {
+	if dir, ok := sp.settings["sonar.working.directory"]; ok {
+		return dir
+	}
+	name := strings.NewReplacer(":", "_", "/", "_", `\`, "_").Replace(sp.key)
+	return scannerWorkDir + "/" + name
+}
+
+// reportTaskFile returns the path of the report-task.txt written by the scanner
+func reportTaskFile(wd string, sp scanProject) string {
+	// the base dir is the project folder when it has a sonar-project.properties
+	base := wd
+	if sp.settings != nil {
+		base = filepath.Join(wd, sp.dir)
+	}
+	return filepath.Join(base, filepath.FromSlash(workingDirectory(sp)), "report-task.txt")
+}
+
+// waitForGate waits until SonarQube processes the analysis of the project and
+// returns its quality gate status, the failing conditions are printed to out
+func waitForGate(ctx context.Context, client *sonarapi.Client, reportTask string, opts waitOptions, out io.Writer) (*sonarapi.ProjectStatus, error) {
+	report, err := readProperties(reportTask)
+	if err != nil {
+		return nil, err
+	}
+	taskID := report["ceTaskId"]
+	if taskID == "" {
+		return nil, errors.New("ceTaskId not found in " + reportTask)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, opts.timeout)
+	defer cancel()
+
+	// wait until the analysis report has been processed
+	poll := newPoller(opts)
+	var task *sonarapi.Task
+	for {
+		task, err = client.CeTask(ctx, taskID)
+		if err != nil && ctx.Err() == nil {
+			return nil, err
+		}
+		if err == nil && task.Done() {
+			break
+		}
+		if err == nil {
+			fmt.Fprintf(out, "%s Analysis of %s is %s\n", poll.clock(), report["projectKey"], task.Status)
+		}
+		if err := poll.wait(ctx); err != nil {
+			return nil, fmt.Errorf("the analysis %s was not processed after %s", taskID, opts.timeout)
+		}
+	}
+
+	if task.Status != sonarapi.TaskSuccess {
+		return nil, fmt.Errorf("the analysis %s is %s: %s", taskID, task.Status, task.ErrorMessage)
+	}
+
+	gate, err := client.QualityGateStatus(ctx, sonarapi.ProjectStatusOptions{AnalysisID: task.AnalysisID})
+	if err != nil {
+		return nil, err
+	}
+	printGate(out, task.ComponentKey, gate)
+
+	return gate, nil
+}
+
+// printGate prints the quality gate status and its failing conditions
+func printGate(out io.Writer, key string, gate *sonarapi.ProjectStatus) {
+	if gate.Passed() {
+		fmt.Fprintf(out, "✅ Quality gate of %s: %s\n", key, gate.Status)
+		return
+	}
+
+	fmt.Fprintf(out, "❌ Quality gate of %s: %s\n", key, gate.Status)
+	for _, c := range gate.Conditions {
+		if c.Status != sonarapi.GateError {
+			continue
+		}
+		fmt.Fprintf(out, "\t- %s is %s, it must not be %s %s\n", c.MetricKey, c.ActualValue, comparatorText(c.Comparator), c.ErrorThreshold)
+	}
+}
+
+// comparatorText returns the comparator of a condition in words
+func comparatorText(comparator string) string {
+	switch comparator {
+	case "LT":
+		return "less than"
+	case "GT":
+		return "greater than"
+	default:
+		return comparator
+	}
+}
@@ -0,0 +1,105 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jrmanes/axectl/pkg/sonarapi"
+)
+
+// TestWaitForGate check the polling of the analysis and the quality gate result
+func TestWaitForGate(t *testing.T) {
+	var tests = []struct {
+		name   string
+		tasks  []string
+		gate   string
+		passed bool
+		err    string
+		output string
+	}{
+		{"passed", []string{"PENDING", "IN_PROGRESS", "SUCCESS"}, `{"projectStatus":{"status":"OK"}}`, true, "", "✅"},
+		{"failed", []string{"SUCCESS"}, `{"projectStatus":{"status":"ERROR","conditions":[{"status":"ERROR","metricKey":"new_coverage","comparator":"LT","errorThreshold":"80","actualValue":"10.0"},{"status":"OK","metricKey":"new_bugs"}]}}`, false, "", "new_coverage is 10.0, it must not be less than 80"},
+		{"analysis failed", []string{"FAILED"}, "", false, "FAILED", ""},
+		{"never processed", []string{"PENDING"}, "", false, "was not processed", ""},
+	}
+
+	opts := waitOptions{timeout: 100 * time.Millisecond, interval: time.Millisecond, maxInterval: 5 * time.Millisecond}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			mux := http.NewServeMux()
+			mux.HandleFunc("/api/ce/task", func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Query().Get("id") != "AXy1" {
+					w.WriteHeader(http.StatusNotFound)
+					return
+				}
+				s := tt.tasks[len(tt.tasks)-1]
+				if calls < len(tt.tasks) {
+					s = tt.tasks[calls]
+				}
+				calls++
+				fmt.Fprintf(w, `{"task":{"id":"AXy1","componentKey":"api","status":%q,"analysisId":"AN1"}}`, s)
+			})
+			mux.HandleFunc("/api/qualitygates/project_status", func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Query().Get("analysisId") != "AN1" {
+					w.WriteHeader(http.StatusBadRequest)
+					return
+				}
+				fmt.Fprint(w, tt.gate)
+			})
+			srv := httptest.NewServer(mux)
+			defer srv.Close()
+
+			report := filepath.Join(t.TempDir(), "report-task.txt")
+			content := "projectKey=api\nserverUrl=http://sonarqube:9000\nceTaskId=AXy1\nceTaskUrl=http://sonarqube:9000/api/ce/task?id=AXy1\n"
+			if err := os.WriteFile(report, []byte(content), 0600); err != nil {
+				t.Fatalf("ERROR: %v", err)
+			}
+
+			out := &bytes.Buffer{}
+			gate, err := waitForGate(context.Background(), sonarapi.NewClient(srv.URL), report, opts, out)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Errorf("ERROR: got: %v, want: %s", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ERROR: %v", err)
+			}
+			if gate.Passed() != tt.passed || !strings.Contains(out.String(), tt.output) {
+				t.Errorf("ERROR: passed: %t, output: %s", gate.Passed(), out)
+			}
+			if strings.Contains(out.String(), "new_bugs") {
+				t.Errorf("ERROR: passing conditions printed: %s", out)
+			}
+		})
+	}
+}
+
+// TestReportTaskFile check where the report-task.txt of every project is written
+func TestReportTaskFile(t *testing.T) {
+	var tests = []struct {
+		sp   scanProject
+		want string
+	}{
+		{scanProject{key: "api", dir: "api"}, "/src/.scannerwork/api/report-task.txt"},
+		{scanProject{key: "org:web", dir: "web", settings: map[string]string{}}, "/src/web/.scannerwork/org_web/report-task.txt"},
+		{scanProject{key: "web", dir: "web", settings: map[string]string{"sonar.working.directory": "build/sonar"}}, "/src/web/build/sonar/report-task.txt"},
+	}
+
+	for _, tt := range tests {
+		if got := filepath.ToSlash(reportTaskFile("/src", tt.sp)); got != tt.want {
+			t.Errorf("ERROR: got: %s, want: %s", got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,174 @@
+/*
+Copyright © 2021 Jose Ramon Mañes jr.mb47@gmail.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// defaultProjectVersion version of the projects without tags
+const defaultProjectVersion = "1.0"
+
+// defaultTargetBranches branches the new code is compared with when origin/HEAD is not set
+var defaultTargetBranches = []string{"main", "master"}
+
+// ciBranchVars environment variables of the CI systems with the branch, used when HEAD is detached
+var ciBranchVars = []string{"GITHUB_HEAD_REF", "GITHUB_REF_NAME", "CI_COMMIT_REF_NAME", "BRANCH_NAME", "GIT_BRANCH"}
+
+// gitInfo is the state of the git repository of a project
+type gitInfo struct {
+	// root top level folder of the repository
+	root string
+	// branch checked out, empty when it's unknown
+	branch string
+	// sha of HEAD
+	sha string
+	// target branch the new code is compared with, empty when it doesn't exist
+	target string
+	// tag latest tag reachable from HEAD, empty when there is none
+	tag string
+	// scm true when the repository is inside the folder mounted in the scanner,
+	// it needs the .git folder to read the blame data
+	scm bool
+}
+
+// gitOutput runs a git command in dir and returns its output without spaces around
+func gitOutput(dir string, args ...string) (string, error) {
+	out, err := exec.Command("git", append([]string{"-C", dir}, args...)...).Output()
+	return strings.TrimSpace(string(out)), err
+}
+
+// readGit returns the state of the git repository of dir, the new code is
+// compared with target, or the default branch when it's empty. It returns nil
+// when git is not installed or dir is not in a checkout with commits.
+func readGit(dir, target string) *gitInfo {
+	if !CommandExists("git") {
+		return nil
+	}
+
+	root, err := gitOutput(dir, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return nil
+	}
+	sha, err := gitOutput(dir, "rev-parse", "HEAD")
+	if err != nil {
+		return nil
+	}
+	g := &gitInfo{root: filepath.FromSlash(root), sha: sha}
+
+	// HEAD is detached in most of the CI systems
+	if branch, err := gitOutput(dir, "symbolic-ref", "--quiet", "--short", "HEAD"); err == nil {
+		g.branch = branch
+	} else {
+		for _, v := range ciBranchVars {
+			if b := os.Getenv(v); b != "" {
+				g.branch = b
+				break
+			}
+		}
+	}
+
+	g.tag, _ = gitOutput(dir, "describe", "--tags", "--abbrev=0")
+
+	g.target = targetBranch(dir, target)
+
+	return g
+}
+
+// targetBranch returns the ref of the target branch, or of the default branch
+// when target is empty, the remote one when there is no local one
+func targetBranch(dir, target string) string {
+	candidates := []string{target, "origin/" + target}
+	if target == "" {
+		candidates = nil
+		if ref, err := gitOutput(dir, "symbolic-ref", "--quiet", "--short", "refs/remotes/origin/HEAD"); err == nil {
+			candidates = append(candidates, ref)
+		}
+		for _, b := range defaultTargetBranches {
+			candidates = append(candidates, b, "origin/"+b)
+		}
+	}
+
+	for _, c := range candidates {
+		if _, err := gitOutput(dir, "rev-parse", "--verify", "--quiet", c+"^{commit}"); err == nil {
+			return c
+		}
+	}
+	return ""
+}
+
+// targetName returns the name of the target branch without the remote
+func (g *gitInfo) targetName() string {
+	return strings.TrimPrefix(g.target, "origin/")
+}
+
+// version returns the version of the project, the latest tag
+func (g *gitInfo) version() string {
+	if g == nil || g.tag == "" {
+		return defaultProjectVersion
+	}
+	return g.tag
+}
+
+// insideFolder check if path is dir or is inside it
+func insideFolder(path, dir string) bool {
+	// the paths returned by git have the symlinks resolved
+	if p, err := filepath.EvalSymlinks(path); err == nil {
+		path = p
+	}
+	if d, err := filepath.EvalSymlinks(dir); err == nil {
+		dir = d
+	}
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// gitSettings returns the scanner settings of the git repository of the project
+func gitSettings(g *gitInfo, opts scanOptions) [][2]string {
+	if g == nil {
+		return [][2]string{{"sonar.scm.disabled", "true"}}
+	}
+
+	settings := [][2]string{{"sonar.scm.disabled", "true"}}
+	if g.scm {
+		settings = [][2]string{{"sonar.scm.provider", "git"}}
+	}
+	settings = append(settings, [2]string{"sonar.scm.revision", g.sha})
+
+	// the branches and pull requests need the Developer Edition or higher
+	if !opts.branchAnalysis || g.branch == "" {
+		return settings
+	}
+	if opts.pullRequest != "" {
+		settings = append(settings,
+			[2]string{"sonar.pullrequest.key", opts.pullRequest},
+			[2]string{"sonar.pullrequest.branch", g.branch},
+		)
+		if g.target != "" {
+			settings = append(settings, [2]string{"sonar.pullrequest.base", g.targetName()})
+		}
+		return settings
+	}
+
+	settings = append(settings, [2]string{"sonar.branch.name", g.branch})
+	if g.target != "" && g.targetName() != g.branch {
+		settings = append(settings, [2]string{"sonar.newCode.referenceBranch", g.targetName()})
+	}
+	return settings
+}
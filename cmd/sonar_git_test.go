@@ -0,0 +1,88 @@
+package cmd
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// gitRepo creates a repository with a commit in main, tagged v1.2.0, and
+// another one in the branch feature, which is checked out
+func gitRepo(t *testing.T) string {
+	if !CommandExists("git") {
+		t.Skip("git is not installed")
+	}
+
+	dir := t.TempDir()
+	run := func(args ...string) {
+		cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+		cmd.Env = append(os.Environ(), "GIT_AUTHOR_NAME=axectl", "GIT_AUTHOR_EMAIL=axectl@example.com", "GIT_COMMITTER_NAME=axectl", "GIT_COMMITTER_EMAIL=axectl@example.com")
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("ERROR: git %v: %v\n%s", args, err, out)
+		}
+	}
+
+	run("init", "--quiet")
+	run("checkout", "--quiet", "-b", "main")
+	run("commit", "--quiet", "--allow-empty", "-m", "first")
+	run("tag", "v1.2.0")
+	run("checkout", "--quiet", "-b", "feature")
+	run("commit", "--quiet", "--allow-empty", "-m", "second")
+	return dir
+}
+
+// TestReadGit check the branch, revision, tag and target branch of a repository
+func TestReadGit(t *testing.T) {
+	dir := gitRepo(t)
+	head, _ := gitOutput(dir, "rev-parse", "HEAD")
+
+	g := readGit(dir, "")
+	if g == nil {
+		t.Fatalf("ERROR: the repository is not read")
+	}
+	if g.branch != "feature" || g.sha != head || g.tag != "v1.2.0" || g.version() != "v1.2.0" || g.target != "main" {
+		t.Errorf("ERROR: git: %+v", g)
+	}
+	if !insideFolder(g.root, dir) || insideFolder(g.root, filepath.Join(dir, "api")) {
+		t.Errorf("ERROR: root %s is not inside %s", g.root, dir)
+	}
+
+	if g := readGit(dir, "release"); g.target != "" {
+		t.Errorf("ERROR: the target doesn't exist: %+v", g)
+	}
+
+	// outside of a checkout the scan goes on without SCM
+	if g := readGit(t.TempDir(), ""); g != nil || g.version() != defaultProjectVersion {
+		t.Errorf("ERROR: not a git checkout: %+v", g)
+	}
+}
+
+// TestGitSettings check the settings of the branches and pull requests
+func TestGitSettings(t *testing.T) {
+	g := &gitInfo{branch: "feature", sha: "abc", target: "origin/main", scm: true}
+
+	var tests = []struct {
+		name string
+		git  *gitInfo
+		opts scanOptions
+		want string
+	}{
+		{"no git", nil, scanOptions{branchAnalysis: true}, "sonar.scm.disabled=true"},
+		{"community", g, scanOptions{}, "sonar.scm.provider=git,sonar.scm.revision=abc"},
+		{"branch", g, scanOptions{branchAnalysis: true}, "sonar.scm.provider=git,sonar.scm.revision=abc,sonar.branch.name=feature,sonar.newCode.referenceBranch=main"},
+		{"pull request", g, scanOptions{branchAnalysis: true, pullRequest: "42"}, "sonar.scm.provider=git,sonar.scm.revision=abc,sonar.pullrequest.key=42,sonar.pullrequest.branch=feature,sonar.pullrequest.base=main"},
+		{"repository not mounted", &gitInfo{sha: "abc"}, scanOptions{branchAnalysis: true}, "sonar.scm.disabled=true,sonar.scm.revision=abc"},
+	}
+
+	for _, tt := range tests {
+		var got []string
+		for _, s := range gitSettings(tt.git, tt.opts) {
+			got = append(got, s[0]+"="+s[1])
+		}
+		if strings.Join(got, ",") != tt.want {
+			t.Errorf("ERROR: %s: %s\nwant: %s", tt.name, strings.Join(got, ","), tt.want)
+		}
+	}
+}
@@ -0,0 +1,410 @@
+/*
+Copyright © 2021 Jose Ramon Mañes jr.mb47@gmail.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/user"
+	"strings"
+
+	"github.com/jrmanes/axectl/pkg/container"
+)
+
+// packages of the container runtimes, by the name of their command, every
+// package manager has its own names for them
+const (
+	pkgDocker        = "docker"
+	pkgCompose       = "docker-compose"
+	pkgPodman        = "podman"
+	pkgPodmanCompose = "podman-compose"
+)
+
+// osReleaseFile describes the Linux distribution
+var osReleaseFile = "/etc/os-release"
+
+// packageInstalled returns true when the command of the package is available
+var packageInstalled = func(pkg string) bool {
+	switch pkg {
+	case pkgCompose:
+		// the compose plugin of docker works too
+		return CommandExists(pkgCompose) || (CommandExists(pkgDocker) && container.DetectCompose(context.Background(), cliRunner{runner: execRunner{}}, pkgDocker, pkgCompose) != nil)
+	case pkgPodmanCompose:
+		return CommandExists(pkgPodmanCompose) || (CommandExists(pkgPodman) && container.DetectCompose(context.Background(), cliRunner{runner: execRunner{}}, pkgPodman, pkgPodmanCompose) != nil)
+	}
+	return CommandExists(pkg)
+}
+
+// packageManager installs the packages of the container runtime
+type packageManager struct {
+	// name of the package manager command
+	name string
+	// sudo runs the package manager as root
+	sudo bool
+	// update arguments to refresh the list of packages, nil when it's not needed
+	update []string
+	// install arguments to install packages, the packages are added at the end
+	install []string
+	// packages names of the runtime packages in the repositories, the ones
+	// which are not there are missing
+	packages map[string]string
+	// repo commands which add the repository of the docker packages, run as root
+	repo Commands
+	// service commands which start docker now and on boot, run as root, nil when the package does it
+	service Commands
+	// hint where to find the packages which are not in the repositories
+	hint string
+}
+
+// systemdDocker starts docker with systemd
+var systemdDocker = Commands{
+	{message: "🔧 Start docker now and on boot", command: "systemctl", args: []string{"enable", "--now", "docker"}},
+}
+
+// dockerCE returns the package manager of the RHEL family, docker is not in
+// their repositories, it's installed from the repository of Docker
+// https://docs.docker.com/engine/install/centos/
+func dockerCE(repo string) packageManager {
+	return packageManager{
+		name: "dnf", sudo: true,
+		install:  []string{"install", "-y"},
+		packages: map[string]string{pkgDocker: "docker-ce", pkgCompose: "docker-compose-plugin", pkgPodman: "podman"},
+		repo: Commands{
+			{message: "📦 Add the repository of Docker: " + repo, command: "dnf", args: []string{"install", "-y", "dnf-plugins-core"}},
+			{command: "dnf", args: []string{"config-manager", "--add-repo", repo}},
+		},
+		service: systemdDocker,
+		hint:    "podman-compose is in EPEL: https://docs.fedoraproject.org/en-US/epel/",
+	}
+}
+
+// packageManagers the package managers supported, by their name
+var packageManagers = map[string]packageManager{
+	"apt": {
+		name: "apt", sudo: true,
+		update:   []string{"update"},
+		install:  []string{"install", "-y"},
+		packages: map[string]string{pkgDocker: "docker.io", pkgCompose: "docker-compose", pkgPodman: "podman", pkgPodmanCompose: "podman-compose"},
+	},
+	"dnf": {
+		name: "dnf", sudo: true,
+		install:  []string{"install", "-y"},
+		packages: map[string]string{pkgDocker: "moby-engine", pkgCompose: "docker-compose", pkgPodman: "podman", pkgPodmanCompose: "podman-compose"},
+		service:  systemdDocker,
+	},
+	"dnf-rhel":   dockerCE("https://download.docker.com/linux/rhel/docker-ce.repo"),
+	"dnf-centos": dockerCE("https://download.docker.com/linux/centos/docker-ce.repo"),
+	"pacman": {
+		name: "pacman", sudo: true,
+		update:   []string{"-Sy"},
+		install:  []string{"-S", "--needed", "--noconfirm"},
+		packages: map[string]string{pkgDocker: "docker", pkgCompose: "docker-compose", pkgPodman: "podman", pkgPodmanCompose: "podman-compose"},
+		service:  systemdDocker,
+	},
+	"zypper": {
+		name: "zypper", sudo: true,
+		update:   []string{"--non-interactive", "refresh"},
+		install:  []string{"--non-interactive", "install"},
+		packages: map[string]string{pkgDocker: "docker", pkgCompose: "docker-compose", pkgPodman: "podman", pkgPodmanCompose: "podman-compose"},
+		service:  systemdDocker,
+	},
+	"apk": {
+		name: "apk", sudo: true,
+		update:   []string{"update"},
+		install:  []string{"add"},
+		packages: map[string]string{pkgDocker: "docker", pkgCompose: "docker-compose", pkgPodman: "podman", pkgPodmanCompose: "podman-compose"},
+		service: Commands{
+			{message: "🔧 Start docker on boot", command: "rc-update", args: []string{"add", "docker", "default"}},
+			{message: "🔧 Start docker now", command: "service", args: []string{"docker", "start"}},
+		},
+	},
+	// Homebrew refuses to run as root
+	"brew": {
+		name:     "brew",
+		install:  []string{"install"},
+		packages: map[string]string{pkgDocker: "docker", pkgCompose: "docker-compose", pkgPodman: "podman", pkgPodmanCompose: "podman-compose"},
+	},
+}
+
+// distroManagers the package manager of the distributions, by their ID in /etc/os-release
+var distroManagers = map[string]string{
+	"debian": "apt", "ubuntu": "apt", "linuxmint": "apt", "pop": "apt", "raspbian": "apt",
+	"fedora": "dnf", "rhel": "dnf-rhel", "centos": "dnf-centos", "rocky": "dnf-centos", "almalinux": "dnf-centos",
+	"arch": "pacman", "manjaro": "pacman", "endeavouros": "pacman",
+	"opensuse": "zypper", "opensuse-leap": "zypper", "opensuse-tumbleweed": "zypper", "suse": "zypper", "sles": "zypper",
+	"alpine": "apk",
+}
+
+// command returns the command which runs the package manager with the arguments
+func (m packageManager) command(message string, args ...string) Command {
+	if m.sudo {
+		return elevate(message, m.name, args...)
+	}
+	return Command{message: message, command: m.name, args: args, interactive: true}
+}
+
+// elevated returns the commands run as root
+func elevated(commands Commands) Commands {
+	var list Commands
+	for _, c := range commands {
+		list = append(list, elevate(c.message, c.command, c.args...))
+	}
+	return list
+}
+
+// distro is the Linux distribution read from /etc/os-release
+type distro struct {
+	// id of the distribution, example: fedora
+	id string
+	// like the ids of the distributions it's based on, example: rhel centos fedora
+	like []string
+	// name shown to the user
+	name string
+}
+
+// parseOSRelease returns the distribution described by the content of /etc/os-release
+func parseOSRelease(r io.Reader) (distro, error) {
+	var d distro
+	var name string
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		kv := strings.SplitN(line, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		value := strings.Trim(kv[1], `"'`)
+
+		switch kv[0] {
+		case "ID":
+			d.id = strings.ToLower(value)
+		case "ID_LIKE":
+			d.like = strings.Fields(strings.ToLower(value))
+		case "NAME":
+			name = value
+		case "PRETTY_NAME":
+			d.name = value
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return d, err
+	}
+
+	if d.id == "" {
+		return d, errors.New("there is no ID in " + osReleaseFile)
+	}
+	if d.name == "" {
+		d.name = name
+	}
+	if d.name == "" {
+		d.name = d.id
+	}
+	return d, nil
+}
+
+// readDistro returns the distribution of the system
+func readDistro() (distro, error) {
+	f, err := os.Open(osReleaseFile)
+	if err != nil {
+		return distro{}, fmt.Errorf("the Linux distribution can't be detected: %w", err)
+	}
+	defer f.Close()
+	return parseOSRelease(f)
+}
+
+// packageManager returns the package manager of the distribution, or of the
+// ones it's based on, false when it's not supported
+func (d distro) packageManager() (packageManager, bool) {
+	for _, id := range append([]string{d.id}, d.like...) {
+		if name, ok := distroManagers[id]; ok {
+			return packageManagers[name], true
+		}
+	}
+	return packageManager{}, false
+}
+
+// install the needed software
+func install(ctx context.Context, r Runner, out io.Writer) error {
+	switch os := detectOS(); os {
+	case "darwin":
+		return MacOSPkg(ctx, r, out)
+	case "linux":
+		// Install Linux Requirements
+		return LinuxPkg(ctx, r, out)
+	default:
+		packages, _, _ := runtimePackages()
+		return errors.New("the install is not supported in " + os + ", install " + strings.Join(packages, " and ") + " by hand")
+	}
+}
+
+// runtimePackages returns the packages of the selected container runtime
+func runtimePackages() ([]string, bool, error) {
+	name, err := selectedRuntime()
+	if err != nil {
+		return nil, false, err
+	}
+	if name == runtimePodman {
+		return []string{pkgPodman, pkgPodmanCompose}, true, nil
+	}
+	return []string{pkgDocker, pkgCompose}, false, nil
+}
+
+// installPackages installs the packages of the runtime which are missing, it
+// returns the ones which have been installed
+func installPackages(ctx context.Context, r Runner, m packageManager, out io.Writer) ([]string, error) {
+	// create a list with all the packages needed
+	packages, podman, err := runtimePackages()
+	if err != nil {
+		return nil, err
+	}
+
+	var missing []string
+	for _, p := range packages {
+		if packageInstalled(p) {
+			fmt.Fprintln(out, "✅", "[", p, "]", "is already installed")
+			continue
+		}
+		missing = append(missing, p)
+	}
+	if len(missing) == 0 {
+		return nil, nil
+	}
+	for _, p := range missing {
+		if m.packages[p] == "" {
+			return nil, errors.New(p + " can't be installed with " + m.name + ", install it by hand, " + m.hint)
+		}
+	}
+
+	var commands Commands
+	if !podman {
+		commands = append(commands, elevated(m.repo)...)
+	}
+	if m.update != nil {
+		commands = append(commands, m.command("📦 Update package list... ", m.update...))
+	}
+	// install them one by one, the failed one is shown in the error
+	for _, p := range missing {
+		args := append(append([]string{}, m.install...), m.packages[p])
+		commands = append(commands, m.command("📦 Installing package: [ "+m.packages[p]+" ]", args...))
+	}
+	if !podman && contains(missing, pkgDocker) {
+		commands = append(commands, elevated(m.service)...)
+	}
+
+	return missing, runCommands(ctx, r, commands, out)
+}
+
+// LinuxPkg Install needed SonarQube packages for Linux environments
+func LinuxPkg(ctx context.Context, r Runner, out io.Writer) error {
+	d, err := readDistro()
+	if err != nil {
+		return err
+	}
+	m, ok := d.packageManager()
+	if !ok {
+		packages, _, _ := runtimePackages()
+		return errors.New("the Linux distribution " + d.name + " is not supported, install " + strings.Join(packages, " and ") + " by hand")
+	}
+	fmt.Fprintln(out, "🐧 Linux distribution: "+d.name+", package manager: "+m.name)
+
+	installed, err := installPackages(ctx, r, m, out)
+	if err != nil {
+		return err
+	}
+
+	// podman runs rootless, the user doesn't need to be in the docker group
+	if !contains(installed, pkgDocker) {
+		fmt.Fprintln(out, "\n✅ All packages have been installed successfully!")
+		return nil
+	}
+
+	// Configure system
+	return LinuxConfigSystem(ctx, r, out)
+}
+
+// MacOSPkg Install needed SonarQube packages for MacOS environments
+func MacOSPkg(ctx context.Context, r Runner, out io.Writer) error {
+	if !CommandExists("brew") {
+		return errors.New("homebrew is needed to install the packages: https://brew.sh")
+	}
+
+	_, podman, err := runtimePackages()
+	if err != nil {
+		return err
+	}
+	if _, err := installPackages(ctx, r, packageManagers["brew"], out); err != nil {
+		return err
+	}
+	fmt.Fprintln(out, "\n✅ All packages have been installed successfully!")
+
+	// in macOS the containers of podman run in a VM
+	if podman {
+		fmt.Fprintln(out, "ℹ️  Start the podman VM: podman machine init && podman machine start")
+	}
+	return nil
+}
+
+// LinuxConfigSystem Configure system to execute SonarQube in Linux
+func LinuxConfigSystem(ctx context.Context, r Runner, out io.Writer) error {
+	fmt.Fprintln(out, "\nℹ️  More info: https://docs.docker.com/engine/install/linux-postinstall/")
+	// root can use docker without the group
+	if isRoot() {
+		fmt.Fprintln(out, "\n✅ All packages have been installed successfully!")
+		return nil
+	}
+
+	// get current user
+	user, err := user.Current()
+	if err != nil {
+		return err
+	}
+
+	// busybox systems, like alpine, don't have usermod
+	group := []string{"usermod", "-aG", "docker", user.Username}
+	if !CommandExists("usermod") && CommandExists("addgroup") {
+		group = []string{"addgroup", user.Username, "docker"}
+	}
+
+	// commands list of commands to execute
+	commands := Commands{
+		elevate("📦 Add docker group to the user: "+user.Username, group[0], group[1:]...),
+		Command{
+			message: "📦 Activate the changes to the user's groups: " + user.Username,
+			command: "newgrp",
+			args:    []string{"docker"},
+		},
+	}
+
+	// loop inside all the commands to execute
+	if err := runCommands(ctx, r, commands, out); err != nil {
+		return err
+	}
+
+	fmt.Fprintln(out, "\nℹ️  In order to refresh your user with the Docker group, you have two options:")
+	fmt.Fprintln(out, "ℹ️  1: Execute the following command: newgrp docker")
+	fmt.Fprintln(out, "ℹ️  2: Or logout/login")
+	fmt.Fprintln(out, "\n✅ All packages have been installed successfully!")
+
+	return nil
+}
@@ -0,0 +1,137 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+// TestParseOSRelease check the distribution and the package manager of /etc/os-release
+func TestParseOSRelease(t *testing.T) {
+	var tests = []struct {
+		content string
+		name    string
+		manager string
+		err     bool
+	}{
+		{"PRETTY_NAME=\"Ubuntu 22.04.3 LTS\"\nNAME=\"Ubuntu\"\nID=ubuntu\nID_LIKE=debian\n", "Ubuntu 22.04.3 LTS", "apt", false},
+		{"NAME=\"Fedora Linux\"\nID=fedora\n# a comment\nVERSION_ID=39\n", "Fedora Linux", "dnf", false},
+		{"NAME=\"Rocky Linux\"\nID=\"rocky\"\nID_LIKE=\"rhel centos fedora\"\n", "Rocky Linux", "dnf", false},
+		{"NAME=\"Arch Linux\"\nID=arch\n", "Arch Linux", "pacman", false},
+		{"NAME=\"openSUSE Tumbleweed\"\nID=\"opensuse-tumbleweed\"\nID_LIKE=\"opensuse suse\"\n", "openSUSE Tumbleweed", "zypper", false},
+		{"NAME=\"Alpine Linux\"\nID=alpine\n", "Alpine Linux", "apk", false},
+		{"ID=pop\nID_LIKE=\"ubuntu debian\"\n", "pop", "apt", false},
+		{"NAME=NixOS\nID=nixos\n", "NixOS", "", false},
+		{"NAME=Unknown\n", "", "", true},
+	}
+
+	for _, tt := range tests {
+		d, err := parseOSRelease(strings.NewReader(tt.content))
+		if (err != nil) != tt.err {
+			t.Errorf("ERROR: %q: unexpected error: %v", tt.content, err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		m, _ := d.packageManager()
+		if d.name != tt.name || m.name != tt.manager {
+			t.Errorf("ERROR: %q: name: %s, manager: %s", tt.content, d.name, m.name)
+		}
+	}
+}
+
+// TestInstall check the commands of every package manager
+func TestInstall(t *testing.T) {
+	u, err := user.Current()
+	if err != nil {
+		t.Fatal(err)
+	}
+	group := "sudo usermod -aG docker " + u.Username
+	if !CommandExists("usermod") && CommandExists("addgroup") {
+		group = "sudo addgroup " + u.Username + " docker"
+	}
+
+	// a fake homebrew
+	bin := t.TempDir()
+	if err := os.WriteFile(filepath.Join(bin, "brew"), []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	defer func(file string, installed func(string) bool, root func() bool) {
+		osReleaseFile, packageInstalled, isRoot = file, installed, root
+	}(osReleaseFile, packageInstalled, isRoot)
+	osReleaseFile = filepath.Join(t.TempDir(), "os-release")
+	isRoot = func() bool { return false }
+	rocky := "ID=\"rocky\"\nID_LIKE=\"rhel centos fedora\""
+	centosRepo := []string{"sudo dnf install -y dnf-plugins-core", "sudo dnf config-manager --add-repo https://download.docker.com/linux/centos/docker-ce.repo"}
+	defer viper.Set("sonar.runtime", nil)
+
+	var tests = []struct {
+		name      string
+		osRelease string
+		runtime   string
+		installed []string
+		install   func(context.Context, Runner, io.Writer) error
+		errors    map[string]error
+		want      []string
+		err       string
+	}{
+		{"ubuntu docker", "ID=ubuntu", runtimeDocker, nil, LinuxPkg, nil, []string{"sudo apt update", "sudo apt install -y docker.io", "sudo apt install -y docker-compose", group, "newgrp docker"}, ""},
+		{"ubuntu podman", "ID=ubuntu", runtimePodman, nil, LinuxPkg, nil, []string{"sudo apt update", "sudo apt install -y podman", "sudo apt install -y podman-compose"}, ""},
+		{"fedora docker", "ID=fedora", runtimeDocker, nil, LinuxPkg, nil, []string{"sudo dnf install -y moby-engine", "sudo dnf install -y docker-compose", "sudo systemctl enable --now docker", group, "newgrp docker"}, ""},
+		{"rocky docker", rocky, runtimeDocker, nil, LinuxPkg, nil, append(centosRepo, "sudo dnf install -y docker-ce", "sudo dnf install -y docker-compose-plugin", "sudo systemctl enable --now docker", group, "newgrp docker"), ""},
+		{"rhel compose", "ID=rhel", runtimeDocker, []string{pkgDocker}, LinuxPkg, nil, []string{"sudo dnf install -y dnf-plugins-core", "sudo dnf config-manager --add-repo https://download.docker.com/linux/rhel/docker-ce.repo", "sudo dnf install -y docker-compose-plugin"}, ""},
+		{"rocky podman", rocky, runtimePodman, nil, LinuxPkg, nil, nil, "podman-compose can't be installed with dnf, install it by hand, podman-compose is in EPEL"},
+		{"arch docker", "ID=arch", runtimeDocker, nil, LinuxPkg, nil, []string{"sudo pacman -Sy", "sudo pacman -S --needed --noconfirm docker", "sudo pacman -S --needed --noconfirm docker-compose", "sudo systemctl enable --now docker", group, "newgrp docker"}, ""},
+		{"opensuse podman", "ID=opensuse-leap\nID_LIKE=\"suse opensuse\"", runtimePodman, nil, LinuxPkg, nil, []string{"sudo zypper --non-interactive refresh", "sudo zypper --non-interactive install podman", "sudo zypper --non-interactive install podman-compose"}, ""},
+		{"alpine docker", "ID=alpine", runtimeDocker, nil, LinuxPkg, nil, []string{"sudo apk update", "sudo apk add docker", "sudo apk add docker-compose", "sudo rc-update add docker default", "sudo service docker start", group, "newgrp docker"}, ""},
+		{"only compose missing", "ID=fedora", runtimeDocker, []string{pkgDocker}, LinuxPkg, nil, []string{"sudo dnf install -y docker-compose"}, ""},
+		{"already installed", "ID=ubuntu", runtimeDocker, []string{pkgDocker, pkgCompose}, LinuxPkg, nil, nil, ""},
+		{"failed package", "ID=ubuntu", runtimeDocker, nil, LinuxPkg, map[string]error{"sudo apt install -y docker.io": errors.New("exit status 100")}, []string{"sudo apt update", "sudo apt install -y docker.io"}, "step 2 of 3 failed, sudo apt install -y docker.io: exit status 100"},
+		{"unknown distribution", "NAME=NixOS\nID=nixos", runtimeDocker, nil, LinuxPkg, nil, nil, "the Linux distribution NixOS is not supported, install docker and docker-compose by hand"},
+		{"unknown runtime", "ID=ubuntu", "lxc", nil, LinuxPkg, nil, nil, "unknown runtime lxc"},
+		{"macos docker", "", runtimeDocker, nil, MacOSPkg, nil, []string{"brew install docker", "brew install docker-compose"}, ""},
+		{"macos podman", "", runtimePodman, []string{pkgPodman}, MacOSPkg, nil, []string{"brew install podman-compose"}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := os.WriteFile(osReleaseFile, []byte(tt.osRelease), 0600); err != nil {
+				t.Fatal(err)
+			}
+			viper.Set("sonar.runtime", tt.runtime)
+			packageInstalled = func(pkg string) bool { return contains(tt.installed, pkg) }
+
+			r := &fakeRunner{errors: tt.errors}
+			err := tt.install(context.Background(), r, io.Discard)
+			if (err != nil) != (tt.err != "") || (err != nil && !strings.HasPrefix(err.Error(), tt.err)) {
+				t.Errorf("ERROR: error: %v, want: %s", err, tt.err)
+			}
+			if strings.Join(r.calls, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("ERROR: %q\nwant: %q", r.calls, tt.want)
+			}
+		})
+	}
+
+	// root doesn't need sudo nor the docker group
+	isRoot = func() bool { return true }
+	packageInstalled = func(pkg string) bool { return false }
+	viper.Set("sonar.runtime", runtimeDocker)
+	if err := os.WriteFile(osReleaseFile, []byte("ID=alpine"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	r := &fakeRunner{}
+	want := []string{"apk update", "apk add docker", "apk add docker-compose", "rc-update add docker default", "service docker start"}
+	if err := LinuxPkg(context.Background(), r, io.Discard); err != nil || strings.Join(r.calls, ",") != strings.Join(want, ",") {
+		t.Errorf("ERROR: as root: %v, %q\nwant: %q", err, r.calls, want)
+	}
+}
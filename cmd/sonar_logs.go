@@ -0,0 +1,81 @@
+/*
+Copyright © 2021 Jose Ramon Mañes jr.mb47@gmail.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/signal"
+
+	"github.com/jrmanes/axectl/pkg/container"
+	"github.com/spf13/cobra"
+)
+
+// logsCmd shows the logs of the SonarQube containers
+var logsCmd = &cobra.Command{
+	Use:   "logs [sonarqube|psql]",
+	Short: "Show the logs of the SonarQube or postgres container",
+	Long: `Show the logs of the local SonarQube container, or the postgres one.
+
+USAGE Examples:
+
+axectl sonar logs
+axectl sonar logs psql --tail 100
+axectl sonar logs --follow`,
+	Args:      cobra.MaximumNArgs(1),
+	ValidArgs: []string{"sonarqube", "psql"},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// load the SonarQube host and credentials
+		if err := loadSonarConfig(cmd); err != nil {
+			return err
+		}
+		if !isLocalHost(sonarHost) {
+			return errors.New("the SonarQube at " + sonarHost + " is remote, its logs are not available")
+		}
+
+		service := "sonarqube"
+		if len(args) > 0 {
+			service = args[0]
+		}
+
+		opts := container.LogsOptions{}
+		opts.Follow, _ = cmd.Flags().GetBool("follow")
+		opts.Tail, _ = cmd.Flags().GetInt("tail")
+
+		rt, project, err := sonarRuntime()
+		if err != nil {
+			return err
+		}
+		if _, ok := project.Service(service); !ok {
+			return errors.New("unknown service " + service + ", use sonarqube or psql")
+		}
+
+		// stop following the logs with ctrl+c
+		ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer cancel()
+
+		return rt.Logs(ctx, project, service, opts, os.Stdout)
+	},
+}
+
+// init add the logs command to the sonar command
+func init() {
+	sonarCmd.AddCommand(logsCmd)
+
+	logsCmd.Flags().BoolP("follow", "f", false, "Keep showing the new logs")
+	logsCmd.Flags().IntP("tail", "", 0, "Number of lines to show from the end of the logs, all by default")
+}
@@ -0,0 +1,146 @@
+/*
+Copyright © 2021 Jose Ramon Mañes jr.mb47@gmail.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"strings"
+
+	"github.com/jrmanes/axectl/pkg/credstore"
+)
+
+const (
+	// defaultAdminPassword password of the admin user in a new SonarQube
+	defaultAdminPassword = "admin"
+	// legacyAdminPassword password axectl used to ask to set by hand
+	legacyAdminPassword = "admin123."
+	// adminPasswordEnv environment variable with the admin password
+	adminPasswordEnv = "AXECTL_SONAR_ADMIN_PASSWORD"
+	// adminPasswordFile file inside the home where the generated password is stored by the file store
+	adminPasswordFile = "/.axectl/sonar/admin-password"
+)
+
+// adminPasswordSet true when the admin password was provided by the user or stored by axectl
+var adminPasswordSet bool
+
+// adminPassword returns the admin password from the flag, the environment or
+// the credential store, in that order, empty when there is none
+func adminPassword(flag string) (string, error) {
+	if flag != "" {
+		return flag, nil
+	}
+	if env := os.Getenv(adminPasswordEnv); env != "" {
+		return env, nil
+	}
+
+	store, err := secretStore()
+	if err != nil {
+		return "", err
+	}
+	p, err := store.Get(adminPasswordKey)
+	if errors.Is(err, credstore.ErrNotFound) {
+		return "", nil
+	}
+	return p, err
+}
+
+// storeAdminPassword stores the admin password in the credential store
+func storeAdminPassword(password string) error {
+	store, err := secretStore()
+	if err != nil {
+		return err
+	}
+	return store.Set(adminPasswordKey, password)
+}
+
+// ensureAdminPassword makes sure the admin user uses password. It's safe to run
+// it many times: when the password is already in use nothing is changed,
+// otherwise the default password is replaced by the new one
+func ensureAdminPassword(ctx context.Context, host, user, password string, out io.Writer) error {
+	valid, err := sonarClient(host, user, password).ValidateCredentials(ctx)
+	if err != nil {
+		return err
+	}
+	if valid {
+		fmt.Fprintln(out, "🔑 The password of the user ["+user+"] is already configured")
+		return nil
+	}
+
+	// look for a known previous password to replace
+	for _, previous := range []string{defaultAdminPassword, legacyAdminPassword} {
+		if previous == password {
+			continue
+		}
+		client := sonarClient(host, user, previous)
+		valid, err := client.ValidateCredentials(ctx)
+		if err != nil {
+			return err
+		}
+		if !valid {
+			continue
+		}
+
+		if err := client.ChangePassword(ctx, user, previous, password); err != nil {
+			return err
+		}
+		fmt.Fprintln(out, "🔑 The password of the user ["+user+"] has been changed")
+		return nil
+	}
+
+	return errors.New("the password of the user [" + user + "] is unknown, provide it with --admin-password, " + adminPasswordEnv + " or -u user:password")
+}
+
+// generatePassword returns a random password with lower and upper case letters, digits and symbols
+func generatePassword(length int) (string, error) {
+	classes := []string{
+		"abcdefghijkmnopqrstuvwxyz",
+		"ABCDEFGHJKLMNPQRSTUVWXYZ",
+		"23456789",
+		"-_.+",
+	}
+
+	password := make([]byte, length)
+	for i := range password {
+		// the first characters use each class, so all of them are present
+		chars := strings.Join(classes, "")
+		if i < len(classes) {
+			chars = classes[i]
+		}
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(len(chars))))
+		if err != nil {
+			return "", err
+		}
+		password[i] = chars[n.Int64()]
+	}
+
+	// shuffle, so the classes are not always in the same positions
+	for i := len(password) - 1; i > 0; i-- {
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(i+1)))
+		if err != nil {
+			return "", err
+		}
+		j := n.Int64()
+		password[i], password[j] = password[j], password[i]
+	}
+
+	return string(password), nil
+}
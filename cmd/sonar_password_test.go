@@ -0,0 +1,121 @@
+package cmd
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fakeSonarUsers returns a fake SonarQube where the admin user has the password,
+// the password changes are stored in changes
+func fakeSonarUsers(password *string, changes *[]string) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/authentication/validate", func(w http.ResponseWriter, r *http.Request) {
+		_, p, _ := r.BasicAuth()
+		if p == *password {
+			w.Write([]byte(`{"valid":true}`))
+			return
+		}
+		w.Write([]byte(`{"valid":false}`))
+	})
+	mux.HandleFunc("/api/users/change_password", func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+		*changes = append(*changes, r.Form.Get("previousPassword")+"->"+r.Form.Get("password"))
+		*password = r.Form.Get("password")
+		w.WriteHeader(http.StatusNoContent)
+	})
+	return httptest.NewServer(mux)
+}
+
+// TestEnsureAdminPassword check that the password is only changed when needed
+func TestEnsureAdminPassword(t *testing.T) {
+	var tests = []struct {
+		name    string
+		current string
+		changes []string
+		err     bool
+	}{
+		{"new SonarQube", "admin", []string{"admin->s3cret"}, false},
+		{"password set by hand", "admin123.", []string{"admin123.->s3cret"}, false},
+		{"already changed", "s3cret", nil, false},
+		{"unknown password", "other", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			current := tt.current
+			var changes []string
+			srv := fakeSonarUsers(&current, &changes)
+			defer srv.Close()
+
+			err := ensureAdminPassword(context.Background(), srv.URL, "admin", "s3cret", ioutil.Discard)
+			if (err != nil) != tt.err {
+				t.Errorf("ERROR: unexpected error: %v", err)
+			}
+			if strings.Join(changes, ",") != strings.Join(tt.changes, ",") {
+				t.Errorf("ERROR: changes: %v, want: %v", changes, tt.changes)
+			}
+
+			// a second run must not change anything
+			if !tt.err {
+				changes = nil
+				if err := ensureAdminPassword(context.Background(), srv.URL, "admin", "s3cret", ioutil.Discard); err != nil || len(changes) > 0 {
+					t.Errorf("ERROR: second run, err: %v, changes: %v", err, changes)
+				}
+			}
+		})
+	}
+}
+
+// TestAdminPassword check the order used to find the admin password
+func TestAdminPassword(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv(adminPasswordEnv, "")
+
+	if p, err := adminPassword(""); err != nil || p != "" {
+		t.Errorf("ERROR: no password expected, got: %s, %v", p, err)
+	}
+
+	stored := "s3cret-Pass"
+	if err := storeAdminPassword(stored); err != nil {
+		t.Fatalf("ERROR: %v", err)
+	}
+	info, err := os.Stat(filepath.Join(home, adminPasswordFile))
+	if err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("ERROR: stored password file: %v, %v", info, err)
+	}
+	if p, _ := adminPassword(""); p != stored {
+		t.Errorf("ERROR: got: %s, want the stored password", p)
+	}
+
+	t.Setenv(adminPasswordEnv, "from-env")
+	if p, _ := adminPassword(""); p != "from-env" {
+		t.Errorf("ERROR: got: %s, want: from-env", p)
+	}
+	if p, _ := adminPassword("from-flag"); p != "from-flag" {
+		t.Errorf("ERROR: got: %s, want: from-flag", p)
+	}
+}
+
+// TestGeneratePassword check that all the kinds of characters are present
+func TestGeneratePassword(t *testing.T) {
+	for i := 0; i < 20; i++ {
+		p, err := generatePassword(24)
+		if err != nil {
+			t.Fatalf("ERROR: %v", err)
+		}
+		if len(p) != 24 ||
+			!strings.ContainsAny(p, "abcdefghijkmnopqrstuvwxyz") ||
+			!strings.ContainsAny(p, "ABCDEFGHJKLMNPQRSTUVWXYZ") ||
+			!strings.ContainsAny(p, "23456789") ||
+			!strings.ContainsAny(p, "-_.+") {
+			t.Errorf("ERROR: weak password: %s", p)
+		}
+	}
+}
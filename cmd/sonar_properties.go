@@ -0,0 +1,258 @@
+/*
+Copyright © 2021 Jose Ramon Mañes jr.mb47@gmail.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// propertiesFile name of the file with the scanner settings of a project
+const propertiesFile = "sonar-project.properties"
+
+// project languages detected from the files in the project folder
+const (
+	languageGo     = "go"
+	languageJS     = "javascript"
+	languageMaven  = "maven"
+	languageGradle = "gradle"
+	languagePython = "python"
+	languageRust   = "rust"
+)
+
+// projectMarkers files which identify the language of a project, in order of preference
+var projectMarkers = []struct {
+	file     string
+	language string
+}{
+	{"go.mod", languageGo},
+	{"pom.xml", languageMaven},
+	{"build.gradle", languageGradle},
+	{"build.gradle.kts", languageGradle},
+	{"package.json", languageJS},
+	{"pyproject.toml", languagePython},
+	{"setup.py", languagePython},
+	{"requirements.txt", languagePython},
+	{"Cargo.toml", languageRust},
+}
+
+// initCmd generates the sonar-project.properties of a project
+var initCmd = &cobra.Command{
+	Use:   "init <project>",
+	Short: "Generate the " + propertiesFile + " of a project",
+	Long: `Generate the ` + propertiesFile + ` inside the project folder.
+
+The sources, tests, exclusions and coverage reports are inferred from the files of the project:
+go.mod, package.json, pom.xml, build.gradle, pyproject.toml, setup.py, requirements.txt...
+
+When a project has a ` + propertiesFile + `, the scan uses it instead of the default settings.
+
+USAGE Examples:
+
+axectl sonar init someProject
+axectl sonar init . --force`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		force, _ := cmd.Flags().GetBool("force")
+
+		dir := args[0]
+		file := filepath.Join(dir, propertiesFile)
+		if _, err := os.Stat(file); err == nil && !force {
+			return errors.New(file + " already exists, use --force to replace it")
+		}
+
+		key := projectKey(dir)
+		content, language := generateProperties(dir, key)
+		if err := writeFile(file, []byte(content), 0644); err != nil {
+			return err
+		}
+
+		if language == "" {
+			language = "unknown"
+		}
+		fmt.Fprintln(actionOutput(), "📝 "+file+" generated for the project ["+key+"], language: "+language)
+		return nil
+	},
+}
+
+// init add the init command to the sonar command
+func init() {
+	sonarCmd.AddCommand(initCmd)
+
+	initCmd.Flags().BoolP("force", "f", false, "Replace the "+propertiesFile+" if it exists")
+	planCommand(initCmd)
+}
+
+// projectKey returns the key of the project in the folder dir
+func projectKey(dir string) string {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return filepath.Base(dir)
+	}
+	return filepath.Base(abs)
+}
+
+// detectLanguage returns the language of the project in dir, empty if it's unknown
+func detectLanguage(dir string) string {
+	for _, m := range projectMarkers {
+		if fileExists(filepath.Join(dir, m.file)) {
+			return m.language
+		}
+	}
+	return ""
+}
+
+// generateProperties returns the content of the sonar-project.properties for
+// the project in dir and the language detected
+func generateProperties(dir, key string) (string, string) {
+	language := detectLanguage(dir)
+
+	// existing returns the first folder which exists or def
+	existing := func(def string, folders ...string) string {
+		for _, f := range folders {
+			if fileExists(filepath.Join(dir, f)) {
+				return f
+			}
+		}
+		return def
+	}
+
+	// the version is not written, the scans use the latest git tag
+	props := [][2]string{
+		{"sonar.projectKey", key},
+		{"sonar.projectName", key},
+		{"sonar.sourceEncoding", "UTF-8"},
+	}
+
+	switch language {
+	case languageGo:
+		props = append(props,
+			[2]string{"sonar.sources", "."},
+			[2]string{"sonar.exclusions", "**/*_test.go,**/vendor/**,**/testdata/**"},
+			[2]string{"sonar.tests", "."},
+			[2]string{"sonar.test.inclusions", "**/*_test.go"},
+			[2]string{"sonar.test.exclusions", "**/vendor/**"},
+			[2]string{"sonar.go.coverage.reportPaths", "cover.out"},
+		)
+	case languageJS:
+		props = append(props,
+			[2]string{"sonar.sources", existing(".", "src", "lib")},
+			[2]string{"sonar.exclusions", "**/node_modules/**,**/dist/**,**/build/**,**/coverage/**,**/*.test.*,**/*.spec.*"},
+			[2]string{"sonar.tests", existing(".", "test", "tests", "__tests__", "src")},
+			[2]string{"sonar.test.inclusions", "**/*.test.*,**/*.spec.*,**/__tests__/**"},
+			[2]string{"sonar.javascript.lcov.reportPaths", "coverage/lcov.info"},
+		)
+		if fileExists(filepath.Join(dir, "tsconfig.json")) {
+			props = append(props, [2]string{"sonar.typescript.tsconfigPath", "tsconfig.json"})
+		}
+	case languageMaven, languageGradle:
+		build := "target"
+		binaries, testBinaries := "target/classes", "target/test-classes"
+		report := "target/site/jacoco/jacoco.xml"
+		if language == languageGradle {
+			build = "build"
+			binaries, testBinaries = "build/classes/java/main", "build/classes/java/test"
+			report = "build/reports/jacoco/test/jacocoTestReport.xml"
+		}
+		props = append(props,
+			[2]string{"sonar.sources", existing("src/main", "src/main/java", "src/main/kotlin")},
+			[2]string{"sonar.tests", existing("src/test", "src/test/java", "src/test/kotlin")},
+			[2]string{"sonar.exclusions", "**/" + build + "/**"},
+			[2]string{"sonar.java.binaries", binaries},
+			[2]string{"sonar.java.test.binaries", testBinaries},
+			[2]string{"sonar.coverage.jacoco.xmlReportPaths", report},
+		)
+	case languagePython:
+		props = append(props,
+			[2]string{"sonar.sources", existing(".", "src")},
+			[2]string{"sonar.exclusions", "**/.venv/**,**/venv/**,**/tests/**,**/test_*.py"},
+			[2]string{"sonar.tests", existing(".", "tests", "test")},
+			[2]string{"sonar.test.inclusions", "**/tests/**,**/test_*.py"},
+			[2]string{"sonar.python.coverage.reportPaths", "coverage.xml"},
+			[2]string{"sonar.python.version", "3"},
+		)
+	case languageRust:
+		props = append(props,
+			[2]string{"sonar.sources", existing(".", "src")},
+			[2]string{"sonar.exclusions", "**/target/**"},
+		)
+	default:
+		props = append(props, [2]string{"sonar.sources", "."})
+	}
+
+	var b strings.Builder
+	b.WriteString("# Generated by axectl sonar init\n")
+	b.WriteString("# https://docs.sonarqube.org/latest/analysis/analysis-parameters/\n")
+	for _, p := range props {
+		b.WriteString(p[0] + "=" + p[1] + "\n")
+	}
+
+	return b.String(), language
+}
+
+// readProperties reads a .properties file, returns nil without error when it doesn't exist
+func readProperties(file string) (map[string]string, error) {
+	f, err := os.Open(file)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	props := map[string]string{}
+	s := bufio.NewScanner(f)
+	var line string
+	for s.Scan() {
+		part := strings.TrimSpace(s.Text())
+		// the values can continue in the next line with \
+		if strings.HasSuffix(part, `\`) {
+			line += strings.TrimSuffix(part, `\`)
+			continue
+		}
+		line += part
+
+		if line != "" && !strings.HasPrefix(line, "#") && !strings.HasPrefix(line, "!") {
+			key, value := splitProperty(line)
+			props[key] = value
+		}
+		line = ""
+	}
+
+	return props, s.Err()
+}
+
+// splitProperty splits a line in key and value, the separator is = or :
+func splitProperty(line string) (string, string) {
+	i := strings.IndexAny(line, "=:")
+	if i < 0 {
+		return line, ""
+	}
+	return strings.TrimSpace(line[:i]), strings.TrimSpace(line[i+1:])
+}
+
+// fileExists check if the file or folder exists
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
@@ -0,0 +1,113 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestGenerateProperties check the settings inferred for every kind of project
+func TestGenerateProperties(t *testing.T) {
+	var tests = []struct {
+		name     string
+		files    []string
+		language string
+		want     []string
+	}{
+		{"go", []string{"go.mod"}, languageGo, []string{"sonar.test.inclusions=**/*_test.go", "sonar.go.coverage.reportPaths=cover.out"}},
+		{"typescript", []string{"package.json", "tsconfig.json", "src/index.ts"}, languageJS, []string{"sonar.sources=src", "sonar.typescript.tsconfigPath=tsconfig.json"}},
+		{"maven", []string{"pom.xml", "src/main/java/App.java", "src/test/java/AppTest.java"}, languageMaven, []string{"sonar.sources=src/main/java", "sonar.tests=src/test/java", "sonar.java.binaries=target/classes"}},
+		{"gradle", []string{"build.gradle.kts"}, languageGradle, []string{"sonar.java.binaries=build/classes/java/main", "sonar.java.test.binaries=build/classes/java/test"}},
+		{"python", []string{"pyproject.toml", "tests/test_app.py"}, languagePython, []string{"sonar.tests=tests", "sonar.python.coverage.reportPaths=coverage.xml"}},
+		{"unknown", []string{"README.md"}, "", []string{"sonar.sources=."}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for _, f := range tt.files {
+				path := filepath.Join(dir, f)
+				if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+					t.Fatalf("ERROR: %v", err)
+				}
+				if err := os.WriteFile(path, nil, 0600); err != nil {
+					t.Fatalf("ERROR: %v", err)
+				}
+			}
+
+			content, language := generateProperties(dir, "someProject")
+			if language != tt.language {
+				t.Errorf("ERROR: language: %s, want: %s", language, tt.language)
+			}
+			for _, w := range append(tt.want, "sonar.projectKey=someProject", "sonar.sourceEncoding=UTF-8") {
+				if !strings.Contains(content, w+"\n") {
+					t.Errorf("ERROR: %s not found in: \n%s", w, content)
+				}
+			}
+			// the version of the scans is the latest git tag
+			if strings.Contains(content, "sonar.projectVersion") {
+				t.Errorf("ERROR: the version is fixed in: \n%s", content)
+			}
+
+			// the generated file can be read back
+			file := filepath.Join(dir, propertiesFile)
+			if err := os.WriteFile(file, []byte(content), 0600); err != nil {
+				t.Fatalf("ERROR: %v", err)
+			}
+			props, err := readProperties(file)
+			if err != nil || props["sonar.projectKey"] != "someProject" {
+				t.Errorf("ERROR: props: %v, %v", props, err)
+			}
+		})
+	}
+}
+
+// TestReadProperties check comments, separators and multi line values
+func TestReadProperties(t *testing.T) {
+	file := filepath.Join(t.TempDir(), propertiesFile)
+	content := "# comment\n! other comment\n\nsonar.projectKey = my:key\nsonar.sources: src\nsonar.exclusions=a/**,\\\n  b/**\n"
+	if err := os.WriteFile(file, []byte(content), 0600); err != nil {
+		t.Fatalf("ERROR: %v", err)
+	}
+
+	props, err := readProperties(file)
+	if err != nil {
+		t.Fatalf("ERROR: %v", err)
+	}
+	want := map[string]string{"sonar.projectKey": "my:key", "sonar.sources": "src", "sonar.exclusions": "a/**,b/**"}
+	if len(props) != len(want) {
+		t.Errorf("ERROR: props: %v", props)
+	}
+	for k, v := range want {
+		if props[k] != v {
+			t.Errorf("ERROR: key: %s, got: %q, want: %q", k, props[k], v)
+		}
+	}
+
+	if props, err := readProperties(filepath.Join(t.TempDir(), "missing")); props != nil || err != nil {
+		t.Errorf("ERROR: missing file: %v, %v", props, err)
+	}
+}
+
+// TestScannerArgsWithProperties check that the settings of the project are not overridden
+func TestScannerArgsWithProperties(t *testing.T) {
+	sp := scanProject{
+		key:      "api",
+		dir:      "api",
+		token:    "squ_1",
+		settings: map[string]string{"sonar.projectKey": "api", "sonar.sources": "cmd,pkg"},
+	}
+	args := strings.Join(scannerArgs(sp, scanOptions{}), " ")
+
+	for _, w := range []string{"-Dsonar.projectBaseDir=/usr/src/api", "-Dproject.settings=/usr/src/api/" + propertiesFile, "-Dsonar.projectVersion=1.0"} {
+		if !strings.Contains(args, w) {
+			t.Errorf("ERROR: %s not found in: %s", w, args)
+		}
+	}
+	for _, nw := range []string{"-Dsonar.projectKey", "-Dsonar.sources"} {
+		if strings.Contains(args, nw) {
+			t.Errorf("ERROR: %s overrides the settings: %s", nw, args)
+		}
+	}
+}
@@ -0,0 +1,433 @@
+/*
+Copyright © 2021 Jose Ramon Mañes jr.mb47@gmail.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/jrmanes/axectl/pkg/sonarapi"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// reportMetrics measures included in the reports
+var reportMetrics = []string{
+	"alert_status",
+	"bugs",
+	"vulnerabilities",
+	"security_hotspots",
+	"code_smells",
+	"coverage",
+	"duplicated_lines_density",
+	"ncloc",
+}
+
+// issuesPageSize maximum page size allowed by /api/issues/search
+const issuesPageSize = 500
+
+// issuesSearchLimit /api/issues/search doesn't return the issues after the
+// first 10000, the report of a project with more of them is truncated
+const issuesSearchLimit = 10000
+
+// projectReport are the issues and measures of a project
+type projectReport struct {
+	// Key of the project
+	Key string `json:"key"`
+	// Measures of the project by metric
+	Measures map[string]string `json:"measures"`
+	// Issues not resolved
+	Issues []sonarapi.Issue `json:"issues"`
+	// Total number of issues not resolved, there are less Issues when it's truncated
+	Total int `json:"total"`
+	// Truncated true when there are more issues than issuesSearchLimit
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// issuesSummary returns the number of issues, and how many are listed when the report is truncated
+func (r projectReport) issuesSummary() string {
+	if !r.Truncated {
+		return fmt.Sprintf("%d issues", len(r.Issues))
+	}
+	return fmt.Sprintf("%d issues, only the first %d are listed", r.Total, len(r.Issues))
+}
+
+// reportFormats renderers of every report format
+var reportFormats = map[string]func(io.Writer, []projectReport) error{
+	"json":     renderJSON,
+	"sarif":    renderSARIF,
+	"junit":    renderJUnit,
+	"markdown": renderMarkdown,
+	"table":    renderTable,
+}
+
+// reportCmd exports the issues of the projects
+var reportCmd = &cobra.Command{
+	Use:   "report [<project>...] [-p <project>]",
+	Short: "Export the issues and measures of the projects",
+	Long: `Export the unresolved issues and the main measures of the projects after a scan.
+The projects are the arguments, -p or the sonar.projects of the config file.
+
+Formats:
+- json: raw data
+- sarif: SARIF 2.1.0, for editors and code scanning tools
+- junit: JUnit XML, one test case per issue, for test dashboards
+- markdown: to paste into merge requests
+- table: to read in the terminal
+
+USAGE Examples:
+
+axectl sonar report someProject
+axectl sonar report -p someProject --format markdown
+axectl sonar report someProject1 someProject2 --format sarif > sonar.sarif`,
+	Args: cobra.ArbitraryArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// load the SonarQube host and credentials
+		if err := loadSonarConfig(cmd); err != nil {
+			return err
+		}
+
+		format, _ := cmd.Flags().GetString("format")
+		render, ok := reportFormats[format]
+		if !ok {
+			return errors.New("unknown format " + format + ", use one of: json, sarif, junit, markdown, table")
+		}
+
+		if p, _ := cmd.Flags().GetString("project"); p != "" {
+			args = append(args, p)
+		}
+		if len(args) == 0 {
+			args = viper.GetStringSlice("sonar.projects")
+		}
+		projects, err := projectArgs(args)
+		if err != nil {
+			return err
+		}
+
+		reports, err := fetchReports(context.Background(), newSonarClient(), projects)
+		if err != nil {
+			return err
+		}
+		for _, r := range reports {
+			if r.Truncated {
+				fmt.Fprintln(os.Stderr, "⚠️ The report of "+r.Key+" is truncated, it has "+r.issuesSummary()+", SonarQube doesn't return more")
+			}
+		}
+		return render(os.Stdout, reports)
+	},
+}
+
+// init add the report command to the sonar command
+func init() {
+	sonarCmd.AddCommand(reportCmd)
+
+	reportCmd.Flags().StringP("format", "f", "table", "Format of the report: json, sarif, junit, markdown or table")
+	reportCmd.Flags().StringP("project", "p", "", "You can add one project name or multiple separated by comas.")
+}
+
+// fetchReports gets the issues and measures of every project
+func fetchReports(ctx context.Context, client *sonarapi.Client, projects []string) ([]projectReport, error) {
+	var reports []projectReport
+	for _, p := range projects {
+		component, err := client.ComponentMeasures(ctx, p, reportMetrics)
+		if err != nil {
+			return nil, err
+		}
+		measures := map[string]string{}
+		for _, m := range component.Measures {
+			measures[m.Metric] = m.Value
+		}
+
+		issues, total, err := fetchIssues(ctx, client, p)
+		if err != nil {
+			return nil, err
+		}
+
+		reports = append(reports, projectReport{Key: p, Measures: measures, Issues: issues, Total: total, Truncated: len(issues) < total})
+	}
+	return reports, nil
+}
+
+// fetchIssues gets all the pages of unresolved issues of the project, up to
+// issuesSearchLimit, and the total number of them
+func fetchIssues(ctx context.Context, client *sonarapi.Client, p string) ([]sonarapi.Issue, int, error) {
+	resolved := false
+	issues := []sonarapi.Issue{}
+	for page := 1; ; page++ {
+		result, err := client.SearchIssues(ctx, sonarapi.IssueSearchOptions{
+			ComponentKeys: []string{p},
+			Resolved:      &resolved,
+			Page:          page,
+			PageSize:      issuesPageSize,
+		})
+		if err != nil {
+			return nil, 0, err
+		}
+		issues = append(issues, result.Issues...)
+
+		if len(result.Issues) == 0 || len(issues) >= result.Total || len(issues) >= issuesSearchLimit {
+			return issues, result.Total, nil
+		}
+	}
+}
+
+// issueFile returns the path of the file of the issue, without the project key
+func issueFile(issue sonarapi.Issue) string {
+	if i := strings.Index(issue.Component, ":"); i >= 0 {
+		return issue.Component[i+1:]
+	}
+	return issue.Component
+}
+
+// renderJSON writes the reports as JSON
+func renderJSON(out io.Writer, reports []projectReport) error {
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(reports)
+}
+
+// sarif structures, only the fields we fill
+// https://docs.oasis-open.org/sarif/sarif/v2.1.0/sarif-v2.1.0.html
+type (
+	sarifLog struct {
+		Schema  string     `json:"$schema"`
+		Version string     `json:"version"`
+		Runs    []sarifRun `json:"runs"`
+	}
+	sarifRun struct {
+		Tool    sarifTool     `json:"tool"`
+		Results []sarifResult `json:"results"`
+	}
+	sarifTool struct {
+		Driver sarifDriver `json:"driver"`
+	}
+	sarifDriver struct {
+		Name           string      `json:"name"`
+		InformationURI string      `json:"informationUri"`
+		Rules          []sarifRule `json:"rules"`
+	}
+	sarifRule struct {
+		ID string `json:"id"`
+	}
+	sarifResult struct {
+		RuleID    string          `json:"ruleId"`
+		Level     string          `json:"level"`
+		Message   sarifMessage    `json:"message"`
+		Locations []sarifLocation `json:"locations"`
+	}
+	sarifMessage struct {
+		Text string `json:"text"`
+	}
+	sarifLocation struct {
+		PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+	}
+	sarifPhysicalLocation struct {
+		ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+		Region           *sarifRegion          `json:"region,omitempty"`
+	}
+	sarifArtifactLocation struct {
+		URI string `json:"uri"`
+	}
+	sarifRegion struct {
+		StartLine   int `json:"startLine"`
+		EndLine     int `json:"endLine,omitempty"`
+		StartColumn int `json:"startColumn,omitempty"`
+		EndColumn   int `json:"endColumn,omitempty"`
+	}
+)
+
+// sarifLevel maps the severity of the issue with the SARIF level
+func sarifLevel(severity string) string {
+	switch severity {
+	case "BLOCKER", "CRITICAL":
+		return "error"
+	case "MAJOR":
+		return "warning"
+	default:
+		return "note"
+	}
+}
+
+// renderSARIF writes the reports as SARIF 2.1.0, all the projects in one run
+func renderSARIF(out io.Writer, reports []projectReport) error {
+	run := sarifRun{
+		Tool: sarifTool{Driver: sarifDriver{
+			Name:           "SonarQube",
+			InformationURI: "https://www.sonarqube.org/",
+			Rules:          []sarifRule{},
+		}},
+		Results: []sarifResult{},
+	}
+
+	rules := map[string]bool{}
+	for _, r := range reports {
+		for _, issue := range r.Issues {
+			if !rules[issue.Rule] {
+				rules[issue.Rule] = true
+				run.Tool.Driver.Rules = append(run.Tool.Driver.Rules, sarifRule{ID: issue.Rule})
+			}
+
+			location := sarifPhysicalLocation{ArtifactLocation: sarifArtifactLocation{URI: issueFile(issue)}}
+			if tr := issue.TextRange; tr != nil {
+				location.Region = &sarifRegion{
+					StartLine:   tr.StartLine,
+					EndLine:     tr.EndLine,
+					StartColumn: tr.StartOffset + 1,
+					EndColumn:   tr.EndOffset + 1,
+				}
+			} else if issue.Line > 0 {
+				location.Region = &sarifRegion{StartLine: issue.Line}
+			}
+
+			run.Results = append(run.Results, sarifResult{
+				RuleID:    issue.Rule,
+				Level:     sarifLevel(issue.Severity),
+				Message:   sarifMessage{Text: issue.Message},
+				Locations: []sarifLocation{{PhysicalLocation: location}},
+			})
+		}
+	}
+	sort.Slice(run.Tool.Driver.Rules, func(i, j int) bool { return run.Tool.Driver.Rules[i].ID < run.Tool.Driver.Rules[j].ID })
+
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(sarifLog{
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Version: "2.1.0",
+		Runs:    []sarifRun{run},
+	})
+}
+
+// junit structures
+type (
+	junitSuites struct {
+		XMLName xml.Name     `xml:"testsuites"`
+		Suites  []junitSuite `xml:"testsuite"`
+	}
+	junitSuite struct {
+		Name     string      `xml:"name,attr"`
+		Tests    int         `xml:"tests,attr"`
+		Failures int         `xml:"failures,attr"`
+		Cases    []junitCase `xml:"testcase"`
+	}
+	junitCase struct {
+		Name      string        `xml:"name,attr"`
+		Classname string        `xml:"classname,attr"`
+		Failure   *junitFailure `xml:"failure,omitempty"`
+	}
+	junitFailure struct {
+		Message string `xml:"message,attr"`
+		Type    string `xml:"type,attr"`
+		Text    string `xml:",chardata"`
+	}
+)
+
+// renderJUnit writes the reports as JUnit XML, a suite per project and a failed test case per issue
+func renderJUnit(out io.Writer, reports []projectReport) error {
+	suites := junitSuites{}
+	for _, r := range reports {
+		suite := junitSuite{Name: r.Key, Tests: len(r.Issues), Failures: len(r.Issues)}
+		for _, issue := range r.Issues {
+			suite.Cases = append(suite.Cases, junitCase{
+				Name:      issue.Rule + " line " + strconv.Itoa(issue.Line),
+				Classname: issueFile(issue),
+				Failure: &junitFailure{
+					Message: issue.Message,
+					Type:    issue.Severity,
+					Text:    fmt.Sprintf("%s %s at %s:%d\n%s", issue.Severity, issue.Type, issueFile(issue), issue.Line, issue.Message),
+				},
+			})
+		}
+		suites.Suites = append(suites.Suites, suite)
+	}
+
+	if _, err := io.WriteString(out, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(out)
+	enc.Indent("", "  ")
+	if err := enc.Encode(suites); err != nil {
+		return err
+	}
+	_, err := io.WriteString(out, "\n")
+	return err
+}
+
+// renderMarkdown writes the reports as Markdown, a section per project
+func renderMarkdown(out io.Writer, reports []projectReport) error {
+	// escape avoids breaking the tables
+	escape := strings.NewReplacer("|", `\|`, "\n", " ").Replace
+
+	var b strings.Builder
+	for _, r := range reports {
+		fmt.Fprintf(&b, "## SonarQube report: %s\n\n", r.Key)
+		b.WriteString("| Metric | Value |\n|---|---|\n")
+		for _, m := range reportMetrics {
+			if v, ok := r.Measures[m]; ok {
+				fmt.Fprintf(&b, "| %s | %s |\n", m, v)
+			}
+		}
+
+		fmt.Fprintf(&b, "\n**%s**\n\n", r.issuesSummary())
+		if len(r.Issues) > 0 {
+			b.WriteString("| Severity | Type | File | Line | Message | Rule |\n|---|---|---|---|---|---|\n")
+			for _, issue := range r.Issues {
+				fmt.Fprintf(&b, "| %s | %s | %s | %d | %s | %s |\n",
+					issue.Severity, issue.Type, escape(issueFile(issue)), issue.Line, escape(issue.Message), issue.Rule)
+			}
+		}
+		b.WriteString("\n")
+	}
+
+	_, err := io.WriteString(out, b.String())
+	return err
+}
+
+// renderTable writes the reports as tables for the terminal
+func renderTable(out io.Writer, reports []projectReport) error {
+	for _, r := range reports {
+		fmt.Fprintln(out, "📊 "+r.Key)
+
+		w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		for _, m := range reportMetrics {
+			if v, ok := r.Measures[m]; ok {
+				fmt.Fprintf(w, "%s\t%s\n", m, v)
+			}
+		}
+		w.Flush()
+
+		fmt.Fprintf(out, "\n%s\n", r.issuesSummary())
+		if len(r.Issues) > 0 {
+			w = tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "SEVERITY\tTYPE\tFILE\tLINE\tMESSAGE")
+			for _, issue := range r.Issues {
+				fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\n", issue.Severity, issue.Type, issueFile(issue), issue.Line, issue.Message)
+			}
+			w.Flush()
+		}
+		fmt.Fprintln(out, "--------------------------------------------------------------")
+	}
+	return nil
+}
@@ -0,0 +1,141 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/jrmanes/axectl/pkg/sonarapi"
+)
+
+// testReports returns reports with a couple of issues
+func testReports() []projectReport {
+	return []projectReport{{
+		Key:      "api",
+		Measures: map[string]string{"coverage": "81.5", "bugs": "1"},
+		Issues: []sonarapi.Issue{
+			{Key: "1", Rule: "go:S1192", Severity: "CRITICAL", Type: "CODE_SMELL", Component: "api:cmd/root.go", Line: 10, Message: "Define a constant | now",
+				TextRange: &sonarapi.TextRange{StartLine: 10, EndLine: 10, StartOffset: 4, EndOffset: 12}},
+			{Key: "2", Rule: "go:S108", Severity: "MINOR", Type: "BUG", Component: "api:main.go", Line: 3, Message: "Empty block"},
+		},
+	}}
+}
+
+// TestFetchReports check that all the pages of issues are fetched, up to the limit of SonarQube
+func TestFetchReports(t *testing.T) {
+	var total int
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/issues/search", func(w http.ResponseWriter, r *http.Request) {
+		page, _ := strconv.Atoi(r.URL.Query().Get("p"))
+		size, _ := strconv.Atoi(r.URL.Query().Get("ps"))
+		if page*size > issuesSearchLimit {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"errors":[{"msg":"Can return only the first 10000 results"}]}`)
+			return
+		}
+		var issues []string
+		for i := (page - 1) * size; i < page*size && i < total; i++ {
+			issues = append(issues, fmt.Sprintf(`{"key":"%d","rule":"go:S1"}`, i))
+		}
+		fmt.Fprintf(w, `{"total":%d,"issues":[%s]}`, total, strings.Join(issues, ","))
+	})
+	mux.HandleFunc("/api/measures/component", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"component":{"key":"api","measures":[{"metric":"coverage","value":"81.5"}]}}`)
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	var tests = []struct {
+		total     int
+		issues    int
+		truncated bool
+	}{
+		{1200, 1200, false},
+		{12000, issuesSearchLimit, true},
+	}
+
+	for _, tt := range tests {
+		total = tt.total
+		reports, err := fetchReports(context.Background(), sonarapi.NewClient(srv.URL), []string{"api"})
+		if err != nil {
+			t.Fatalf("ERROR: %d issues: %v", tt.total, err)
+		}
+		r := reports[0]
+		if len(r.Issues) != tt.issues || r.Total != tt.total || r.Truncated != tt.truncated || r.Measures["coverage"] != "81.5" {
+			t.Errorf("ERROR: issues: %d, total: %d, truncated: %t, measures: %v", len(r.Issues), r.Total, r.Truncated, r.Measures)
+		}
+	}
+}
+
+// TestRenderSARIF check the SARIF rules, levels and locations
+func TestRenderSARIF(t *testing.T) {
+	out := &bytes.Buffer{}
+	if err := renderSARIF(out, testReports()); err != nil {
+		t.Fatalf("ERROR: %v", err)
+	}
+
+	log := sarifLog{}
+	if err := json.Unmarshal(out.Bytes(), &log); err != nil {
+		t.Fatalf("ERROR: invalid JSON: %v", err)
+	}
+	run := log.Runs[0]
+	if log.Version != "2.1.0" || len(run.Tool.Driver.Rules) != 2 || len(run.Results) != 2 {
+		t.Fatalf("ERROR: unexpected SARIF: %s", out)
+	}
+	first := run.Results[0]
+	region := first.Locations[0].PhysicalLocation.Region
+	if first.Level != "error" || first.Locations[0].PhysicalLocation.ArtifactLocation.URI != "cmd/root.go" || region.StartColumn != 5 {
+		t.Errorf("ERROR: unexpected result: %+v", first)
+	}
+	if run.Results[1].Level != "note" || run.Results[1].Locations[0].PhysicalLocation.Region.StartLine != 3 {
+		t.Errorf("ERROR: unexpected result: %+v", run.Results[1])
+	}
+}
+
+// TestRenderJUnit check that every issue is a failed test case
+func TestRenderJUnit(t *testing.T) {
+	out := &bytes.Buffer{}
+	if err := renderJUnit(out, testReports()); err != nil {
+		t.Fatalf("ERROR: %v", err)
+	}
+
+	suites := junitSuites{}
+	if err := xml.Unmarshal(out.Bytes(), &suites); err != nil {
+		t.Fatalf("ERROR: invalid XML: %v", err)
+	}
+	suite := suites.Suites[0]
+	if suite.Name != "api" || suite.Tests != 2 || suite.Failures != 2 || suite.Cases[1].Classname != "main.go" {
+		t.Errorf("ERROR: unexpected suite: %+v", suite)
+	}
+}
+
+// TestRenderText check the markdown and table formats
+func TestRenderText(t *testing.T) {
+	var tests = []struct {
+		format string
+		want   []string
+	}{
+		{"markdown", []string{"## SonarQube report: api", "| coverage | 81.5 |", `Define a constant \| now`, "**2 issues**"}},
+		{"table", []string{"📊 api", "coverage", "2 issues", "cmd/root.go"}},
+		{"json", []string{`"key": "api"`, `"coverage": "81.5"`}},
+	}
+
+	for _, tt := range tests {
+		out := &bytes.Buffer{}
+		if err := reportFormats[tt.format](out, testReports()); err != nil {
+			t.Fatalf("ERROR: %v", err)
+		}
+		for _, w := range tt.want {
+			if !strings.Contains(out.String(), w) {
+				t.Errorf("ERROR: format: %s, %q not found in: \n%s", tt.format, w, out)
+			}
+		}
+	}
+}
@@ -0,0 +1,299 @@
+/*
+Copyright © 2021 Jose Ramon Mañes jr.mb47@gmail.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jrmanes/axectl/pkg/container"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// pingTimeout maximum time to wait for the Engine API to answer
+const pingTimeout = 2 * time.Second
+
+// scannerImage image of the sonar-scanner, the full name is needed by podman
+const scannerImage = "docker.io/sonarsource/sonar-scanner-cli"
+
+// container runtimes which can be selected with --runtime
+const (
+	runtimeAuto   = "auto"
+	runtimeDocker = "docker"
+	runtimePodman = "podman"
+)
+
+// containerRuntimes all the values of --runtime
+var containerRuntimes = []string{runtimeAuto, runtimeDocker, runtimePodman}
+
+// selinuxEnforce file which tells if SELinux is enforcing, the scanner needs
+// to relabel the sources to read them
+var selinuxEnforce = "/sys/fs/selinux/enforce"
+
+// init add the runtime flag to the sonar command, it can be set in the config file too
+func init() {
+	sonarCmd.PersistentFlags().StringP("runtime", "", runtimeAuto, "Container runtime: "+strings.Join(containerRuntimes, ", ")+", auto uses docker when it's available, podman otherwise")
+
+	viper.SetDefault("sonar.runtime", runtimeAuto)
+	cobra.CheckErr(viper.BindPFlag("sonar.runtime", sonarCmd.PersistentFlags().Lookup("runtime")))
+}
+
+// selectedRuntime returns the runtime selected with --runtime or the config file
+func selectedRuntime() (string, error) {
+	name := viper.GetString("sonar.runtime")
+	if !contains(containerRuntimes, name) {
+		return "", errors.New("unknown runtime " + name + ", use one of: " + strings.Join(containerRuntimes, ", "))
+	}
+	if name == runtimeAuto && !CommandExists("docker") && CommandExists("podman") {
+		return runtimePodman, nil
+	}
+	return name, nil
+}
+
+// containerRuntime returns the runtime which manages the containers: the Engine
+// API when its socket answers, the docker or podman commands otherwise. In a
+// dry run the changes are added to the plan, the runtime can be installed by
+// the same command, so it's not needed
+func containerRuntime() (container.Runtime, error) {
+	name, err := selectedRuntime()
+	if err != nil {
+		return nil, err
+	}
+
+	rt, err := detectRuntime(name)
+	if currentPlan == nil {
+		return rt, err
+	}
+	switch {
+	case rt != nil:
+		name = rt.Name()
+	case name == runtimeAuto:
+		// the runtime installed by axectl sonar install
+		name = runtimeDocker
+	}
+	return currentPlan.runtime(rt, name), nil
+}
+
+// detectRuntime returns the runtime of the name, auto uses the one which is available
+func detectRuntime(name string) (container.Runtime, error) {
+	switch name {
+	case runtimeDocker:
+		return dockerRuntime()
+	case runtimePodman:
+		return podmanRuntime()
+	}
+
+	// auto: docker first, podman when docker isn't available
+	if rt, err := dockerRuntime(); err == nil {
+		return rt, nil
+	}
+	if rt, err := podmanRuntime(); err == nil {
+		return rt, nil
+	}
+	return nil, errors.New("docker or podman are not installed, run: axectl sonar install")
+}
+
+// dockerRuntime returns the Docker Engine API or the docker commands
+func dockerRuntime() (container.Runtime, error) {
+	if socket, ok := dockerSocket(); ok {
+		if engine := container.NewEngine(socket); ping(engine) {
+			return engine, nil
+		}
+	}
+
+	if !CommandExists("docker") {
+		return nil, errors.New("docker is not installed, run: axectl sonar install")
+	}
+	r := cliRunner{runner: execRunner{}}
+	return container.NewCLI(r, "docker", container.DetectCompose(context.Background(), r, "docker", "docker-compose")), nil
+}
+
+// podmanRuntime returns the compatible API of podman or the podman commands
+func podmanRuntime() (container.Runtime, error) {
+	if socket, ok := podmanSocket(); ok {
+		if engine := container.NewEngine(socket, container.WithName(runtimePodman)); ping(engine) {
+			return engine, nil
+		}
+	}
+
+	if !CommandExists("podman") {
+		return nil, errors.New("podman is not installed, run: axectl sonar install --runtime podman")
+	}
+	r := cliRunner{runner: execRunner{}}
+	return container.NewCLI(r, "podman", container.DetectCompose(context.Background(), r, "podman", "podman-compose")), nil
+}
+
+// ping check if the Engine API answers
+func ping(engine *container.Engine) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), pingTimeout)
+	defer cancel()
+	return engine.Ping(ctx) == nil
+}
+
+// dockerSocket returns the unix socket of the Docker Engine, false when
+// DOCKER_HOST is not a unix socket, the docker CLI knows how to reach it
+func dockerSocket() (string, bool) {
+	if host := os.Getenv("DOCKER_HOST"); host != "" {
+		if !strings.HasPrefix(host, "unix://") {
+			return "", false
+		}
+		return strings.TrimPrefix(host, "unix://"), true
+	}
+
+	// Docker Desktop creates the socket in the home of the user
+	if home, err := os.UserHomeDir(); err == nil && !fileExists(container.DefaultSocket) {
+		if socket := filepath.Join(home, ".docker", "run", "docker.sock"); fileExists(socket) {
+			return socket, true
+		}
+	}
+	return container.DefaultSocket, true
+}
+
+// podmanSocket returns the unix socket of the podman API, the one of the user
+// when podman is rootless, false when CONTAINER_HOST is not a unix socket
+func podmanSocket() (string, bool) {
+	if host := os.Getenv("CONTAINER_HOST"); host != "" {
+		if !strings.HasPrefix(host, "unix://") {
+			return "", false
+		}
+		return strings.TrimPrefix(host, "unix://"), true
+	}
+
+	if os.Getuid() == 0 {
+		return "/run/podman/podman.sock", true
+	}
+	runtimeDir := os.Getenv("XDG_RUNTIME_DIR")
+	if runtimeDir == "" {
+		runtimeDir = "/run/user/" + strconv.Itoa(os.Getuid())
+	}
+	return filepath.Join(runtimeDir, "podman", "podman.sock"), true
+}
+
+// selinuxEnforcing check if SELinux is enforcing, Fedora and RHEL by default
+func selinuxEnforcing() bool {
+	data, err := os.ReadFile(selinuxEnforce)
+	return err == nil && strings.TrimSpace(string(data)) == "1"
+}
+
+// sonarProject returns the containers of the docker-compose file as a project,
+// it must be kept in sync with composeTemplate
+func sonarProject(opts composeOptions) container.Project {
+	env := []string{
+		"sonar.jdbc.username=sonar",
+		"sonar.jdbc.password=sonar",
+		"sonar.jdbc.url=jdbc:postgresql://psql:5432/sonar",
+	}
+	javaOpts := [][2]string{
+		{"SONAR_WEB_JAVAOPTS", opts.WebJavaOpts},
+		{"SONAR_CE_JAVAOPTS", opts.CEJavaOpts},
+		{"SONAR_SEARCH_JAVAOPTS", opts.SearchJavaOpts},
+	}
+	for _, j := range javaOpts {
+		if j[1] != "" {
+			env = append(env, j[0]+"="+j[1])
+		}
+	}
+
+	psql := container.Service{
+		Name:     "psql",
+		Image:    opts.PostgresImage(),
+		Platform: opts.Platform,
+		Env:      []string{"POSTGRES_USER=sonar", "POSTGRES_PASSWORD=sonar", "POSTGRES_DB=sonar"},
+		Mounts: []container.Mount{
+			{Volume: opts.PostgresVolume, Target: "/var/lib/postgresql"},
+			{Volume: opts.PostgresDataVolume, Target: "/var/lib/postgresql/data"},
+		},
+	}
+	if opts.PostgresPort != 0 {
+		psql.Ports = []container.Port{{Host: opts.PostgresPort, Container: 5432}}
+	}
+
+	return container.Project{
+		Name:        composeProject,
+		ComposeFile: filePath + fileName,
+		Network:     "sonar",
+		Volumes:     []string{opts.PostgresDataVolume, opts.PostgresVolume},
+		Services: []container.Service{
+			psql,
+			{
+				Name:     "sonarqube",
+				Image:    opts.Image(),
+				Platform: opts.Platform,
+				Env:      env,
+				Ports:    []container.Port{{Host: opts.Port, Container: 9000}},
+				Ulimits:  sonarUlimits,
+			},
+		},
+	}
+}
+
+// scannerSpec returns the sonar-scanner container to scan the project
+func scannerSpec(wd string, sp scanProject, opts scanOptions) container.RunSpec {
+	spec := container.RunSpec{
+		Image: scannerImage,
+		Binds: []string{wd + "/:" + scannerMount},
+		Args:  scannerArgs(sp, opts),
+	}
+	// the container can't read the sources without the SELinux label
+	if selinuxEnforcing() {
+		spec.Binds[0] += ":z"
+	}
+
+	// the local SonarQube is reached through the docker-compose network,
+	// a remote one directly with its url
+	if isLocalHost(sonarHost) {
+		spec.Network = sonarNetwork
+	}
+	spec.Env = []string{"SONAR_HOST_URL=" + scannerHost()}
+	// the token is not an argument, it would be shown in the process list
+	spec.Secrets = []string{"SONAR_TOKEN=" + sp.token}
+
+	return spec
+}
+
+// scannerHost returns the url of SonarQube from the scanner container
+func scannerHost() string {
+	if isLocalHost(sonarHost) {
+		return sonarInternalHost
+	}
+	return sonarHost
+}
+
+// sonarRuntime returns the runtime and the project of the SonarQube containers
+func sonarRuntime() (container.Runtime, container.Project, error) {
+	compose, err := loadComposeOptions()
+	if err != nil {
+		return nil, container.Project{}, err
+	}
+
+	rt, err := containerRuntime()
+	return rt, sonarProject(compose), err
+}
+
+// managedRuntime returns the runtime and the project of the local SonarQube,
+// the runtime is nil for a remote one, its containers are not managed by axectl
+func managedRuntime() (container.Runtime, container.Project, error) {
+	if !isLocalHost(sonarHost) {
+		return nil, container.Project{}, nil
+	}
+	return sonarRuntime()
+}
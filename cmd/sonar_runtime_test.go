@@ -0,0 +1,143 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v2"
+)
+
+// TestSonarProject check that the project is the same as the docker-compose file
+func TestSonarProject(t *testing.T) {
+	custom := defaultComposeOptions
+	custom.PostgresPort = 0
+	custom.WebJavaOpts = "-Xmx1G"
+	custom.Platform = "linux/amd64"
+
+	for _, opts := range []composeOptions{defaultComposeOptions, custom} {
+		content, err := dockerComposeFile(opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c := compose{}
+		if err := yaml.Unmarshal([]byte(content), &c); err != nil {
+			t.Fatal(err)
+		}
+
+		p := sonarProject(opts)
+		if len(p.Services) != len(c.Services) || len(p.Volumes) != len(c.Volumes) {
+			t.Fatalf("ERROR: project: %+v, compose file: %+v", p, c)
+		}
+		for _, s := range p.Services {
+			cs, ok := c.Services[s.Name]
+			if !ok {
+				t.Fatalf("ERROR: service %s not found in the compose file", s.Name)
+			}
+
+			var ports, mounts []string
+			for _, port := range s.Ports {
+				ports = append(ports, strconv.Itoa(port.Host)+":"+strconv.Itoa(port.Container))
+			}
+			for _, m := range s.Mounts {
+				mounts = append(mounts, m.Volume+":"+m.Target)
+			}
+			same := func(a, b []string) bool {
+				sort.Strings(a)
+				sort.Strings(b)
+				return strings.Join(a, ",") == strings.Join(b, ",")
+			}
+
+			if s.Image != cs.Image || s.Platform != cs.Platform || !same(s.Env, cs.Environment) || !same(ports, cs.Ports) || !same(mounts, cs.Volumes) {
+				t.Errorf("ERROR: service %s: %+v, compose file: %+v", s.Name, s, cs)
+			}
+		}
+		if p.NetworkName() != sonarNetwork {
+			t.Errorf("ERROR: network: %s, expected: %s", p.NetworkName(), sonarNetwork)
+		}
+	}
+}
+
+// TestDockerSocket check the socket from DOCKER_HOST
+func TestDockerSocket(t *testing.T) {
+	var tests = []struct {
+		host   string
+		socket string
+		ok     bool
+	}{
+		{"unix:///run/user/1000/docker.sock", "/run/user/1000/docker.sock", true},
+		{"tcp://10.0.0.1:2376", "", false},
+		{"ssh://user@host", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Setenv("DOCKER_HOST", tt.host)
+		if socket, ok := dockerSocket(); socket != tt.socket || ok != tt.ok {
+			t.Errorf("ERROR: host: %s, socket: %s, %t", tt.host, socket, ok)
+		}
+	}
+}
+
+// TestPodmanSocket check the socket of the rootless and rootful podman
+func TestPodmanSocket(t *testing.T) {
+	t.Setenv("CONTAINER_HOST", "unix:///tmp/podman.sock")
+	if socket, ok := podmanSocket(); socket != "/tmp/podman.sock" || !ok {
+		t.Errorf("ERROR: CONTAINER_HOST not used: %s", socket)
+	}
+	t.Setenv("CONTAINER_HOST", "ssh://core@localhost:2222/run/podman/podman.sock")
+	if _, ok := podmanSocket(); ok {
+		t.Errorf("ERROR: a ssh CONTAINER_HOST is not a unix socket")
+	}
+
+	t.Setenv("CONTAINER_HOST", "")
+	t.Setenv("XDG_RUNTIME_DIR", "/run/user/1000")
+	want := "/run/user/1000/podman/podman.sock"
+	if os.Getuid() == 0 {
+		want = "/run/podman/podman.sock"
+	}
+	if socket, _ := podmanSocket(); socket != filepath.FromSlash(want) {
+		t.Errorf("ERROR: socket: %s, expected: %s", socket, want)
+	}
+}
+
+// TestSelectedRuntime check the values of --runtime
+func TestSelectedRuntime(t *testing.T) {
+	defer viper.Set("sonar.runtime", nil)
+
+	var tests = []struct {
+		runtime string
+		err     bool
+	}{
+		{runtimeDocker, false},
+		{runtimePodman, false},
+		{"containerd", true},
+	}
+
+	for _, tt := range tests {
+		viper.Set("sonar.runtime", tt.runtime)
+		name, err := selectedRuntime()
+		if (err != nil) != tt.err || (!tt.err && name != tt.runtime) {
+			t.Errorf("ERROR: runtime: %s, selected: %s, error: %v", tt.runtime, name, err)
+		}
+	}
+}
+
+// TestScannerSpecSELinux check that the sources are relabeled when SELinux is enforcing
+func TestScannerSpecSELinux(t *testing.T) {
+	defer func(s string) { selinuxEnforce = s }(selinuxEnforce)
+	selinuxEnforce = filepath.Join(t.TempDir(), "enforce")
+
+	for _, enforce := range []string{"0", "1"} {
+		if err := os.WriteFile(selinuxEnforce, []byte(enforce+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		spec := scannerSpec("/src", scanProject{key: "api", dir: "api"}, scanOptions{})
+		if got := strings.HasSuffix(spec.Binds[0], ":z"); got != (enforce == "1") {
+			t.Errorf("ERROR: enforce: %s, binds: %v", enforce, spec.Binds)
+		}
+	}
+}
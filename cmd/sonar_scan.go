@@ -0,0 +1,190 @@
+/*
+Copyright © 2021 Jose Ramon Mañes jr.mb47@gmail.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/jrmanes/axectl/pkg/sonarapi"
+)
+
+// scanLogsFolder folder inside the home where the output of every scan is stored
+const scanLogsFolder = "/.axectl/sonar/logs/"
+
+// Status of the scan of a project
+const (
+	// scanPassed the scan finished and the quality gate passed or was not checked
+	scanPassed = "passed"
+	// scanFailed the scan finished but the quality gate failed
+	scanFailed = "failed"
+	// scanError the project couldn't be scanned
+	scanError = "error"
+)
+
+// scanIcons icon shown with every status
+var scanIcons = map[string]string{
+	scanPassed: "✅",
+	scanFailed: "❌",
+	scanError:  "🔥",
+}
+
+// scanResult is the result of the scan of a project
+type scanResult struct {
+	// project scanned
+	project string
+	// status passed, failed or error
+	status string
+	// duration of the scan, including the wait for the quality gate
+	duration time.Duration
+	// gate status of the quality gate, empty when it's not checked
+	gate string
+	// log file with the output of the scan
+	log string
+	// err why the project couldn't be scanned
+	err error
+}
+
+// scanFunc scans a project writing its output to out, it returns the quality
+// gate when it's checked
+type scanFunc func(ctx context.Context, project string, out io.Writer) (*sonarapi.ProjectStatus, error)
+
+// scanLogsPath returns the folder where the output of the scans is stored, it's created when it doesn't exist
+func scanLogsPath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	dir := filepath.Join(home, scanLogsFolder)
+	return dir, mkdirAll(dir, 0700)
+}
+
+// scanLogFile returns the log file of a project, the folders of the project are joined with _
+func scanLogFile(dir, project string) string {
+	name := strings.ReplaceAll(filepath.ToSlash(filepath.Clean(project)), "/", "_")
+	return filepath.Join(dir, name+".log")
+}
+
+// scanProjects scans the projects running up to parallel scans at the same time,
+// the output of every scan is written to its log file in logs, and to out too
+// when there is only one scan at a time. A failed project doesn't stop the others.
+func scanProjects(ctx context.Context, projects []string, parallel int, logs string, out io.Writer, scan scanFunc) []scanResult {
+	if parallel > len(projects) {
+		parallel = len(projects)
+	}
+
+	results := make([]scanResult, len(projects))
+	jobs := make(chan int)
+	// mu doesn't allow to mix the progress lines of the workers
+	var mu sync.Mutex
+	progress := func(format string, a ...interface{}) {
+		mu.Lock()
+		defer mu.Unlock()
+		fmt.Fprintf(out, format, a...)
+	}
+
+	var wg sync.WaitGroup
+	for w := 0; w < parallel; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				p := projects[i]
+				progress("🔭 Scanning project... %s\n", p)
+				r := scanWithLog(ctx, p, scanLogFile(logs, p), parallel, out, scan)
+				progress("%s %s: %s in %s, log: %s\n", scanIcons[r.status], p, r.status, r.duration, r.log)
+				results[i] = r
+			}
+		}()
+	}
+
+	for i := range projects {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	return results
+}
+
+// scanWithLog scans a project writing its output to the log file
+func scanWithLog(ctx context.Context, project, log string, parallel int, out io.Writer, scan scanFunc) (r scanResult) {
+	started := time.Now()
+	r = scanResult{project: project, status: scanError, log: log}
+	defer func() { r.duration = elapsed(started) }()
+
+	f, err := createFile(log)
+	if err != nil {
+		r.err = err
+		return r
+	}
+	defer f.Close()
+
+	// the output of parallel scans would be mixed in the terminal
+	var w io.Writer = f
+	if parallel == 1 {
+		w = io.MultiWriter(f, out)
+	}
+
+	gate, err := scan(ctx, project, w)
+	if err != nil {
+		fmt.Fprintln(f, "[ERROR] 🔥 ", err)
+		r.err = err
+		return r
+	}
+
+	r.status = scanPassed
+	if gate != nil {
+		r.gate = gate.Status
+		if !gate.Passed() {
+			r.status = scanFailed
+		}
+	}
+	return r
+}
+
+// printScanSummary prints the status of every scan, it returns false when any of them didn't pass
+func printScanSummary(out io.Writer, results []scanResult) bool {
+	passed := true
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "PROJECT\tSTATUS\tDURATION\tQUALITY GATE\tLOG")
+	for _, r := range results {
+		gate := r.gate
+		if gate == "" {
+			gate = "-"
+		}
+		fmt.Fprintln(w, strings.Join([]string{r.project, r.status, r.duration.String(), gate, r.log}, "\t"))
+		if r.status != scanPassed {
+			passed = false
+		}
+	}
+	w.Flush()
+
+	for _, r := range results {
+		if r.err != nil {
+			fmt.Fprintln(out, "[ERROR] 🔥 "+r.project+": "+r.err.Error())
+		}
+	}
+	return passed
+}
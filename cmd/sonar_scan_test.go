@@ -0,0 +1,109 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jrmanes/axectl/pkg/sonarapi"
+)
+
+// TestScanProjects check that the scans run in parallel, their output goes to
+// their log files and a failed one doesn't stop the rest
+func TestScanProjects(t *testing.T) {
+	var mu sync.Mutex
+	running, maxRunning := 0, 0
+	scan := func(ctx context.Context, p string, out io.Writer) (*sonarapi.ProjectStatus, error) {
+		mu.Lock()
+		running++
+		if running > maxRunning {
+			maxRunning = running
+		}
+		mu.Unlock()
+		defer func() {
+			mu.Lock()
+			running--
+			mu.Unlock()
+		}()
+
+		fmt.Fprintln(out, "scanning "+p)
+		time.Sleep(20 * time.Millisecond)
+		switch p {
+		case "broken":
+			return nil, errors.New("token not found")
+		case "services/bad":
+			return &sonarapi.ProjectStatus{Status: sonarapi.GateError}, nil
+		default:
+			return &sonarapi.ProjectStatus{Status: sonarapi.GateOK}, nil
+		}
+	}
+
+	var tests = []struct {
+		parallel int
+		max      int
+		stdout   bool
+	}{
+		{1, 1, true},
+		{2, 2, false},
+		{10, 4, false},
+	}
+
+	projects := []string{"api", "broken", "services/bad", "web"}
+	want := []string{scanPassed, scanError, scanFailed, scanPassed}
+	for _, tt := range tests {
+		logs := t.TempDir()
+		maxRunning = 0
+		out := &bytes.Buffer{}
+
+		results := scanProjects(context.Background(), projects, tt.parallel, logs, out, scan)
+		if maxRunning != tt.max {
+			t.Errorf("ERROR: parallel: %d, scans at the same time: %d, expected: %d", tt.parallel, maxRunning, tt.max)
+		}
+		if got := strings.Contains(out.String(), "scanning api"); got != tt.stdout {
+			t.Errorf("ERROR: parallel: %d, output of the scan in stdout: %t\n%s", tt.parallel, got, out)
+		}
+
+		for i, r := range results {
+			if r.project != projects[i] || r.status != want[i] {
+				t.Errorf("ERROR: parallel: %d, result: %+v, expected: %s", tt.parallel, r, want[i])
+			}
+			data, err := os.ReadFile(r.log)
+			if err != nil || !strings.Contains(string(data), "scanning "+r.project) {
+				t.Errorf("ERROR: parallel: %d, log %s: %q, %v", tt.parallel, r.log, data, err)
+			}
+		}
+		if results[2].log != filepath.Join(logs, "services_bad.log") || results[2].gate != sonarapi.GateError {
+			t.Errorf("ERROR: result: %+v", results[2])
+		}
+	}
+}
+
+// TestPrintScanSummary check the summary table and the result
+func TestPrintScanSummary(t *testing.T) {
+	results := []scanResult{
+		{project: "api", status: scanPassed, gate: sonarapi.GateOK, duration: time.Minute, log: "/logs/api.log"},
+		{project: "web", status: scanError, err: errors.New("token not found"), log: "/logs/web.log"},
+	}
+
+	out := &bytes.Buffer{}
+	if printScanSummary(out, results) {
+		t.Errorf("ERROR: a failed scan is expected")
+	}
+	for _, want := range []string{"1m0s", "/logs/api.log", "error", "web: token not found"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("ERROR: %q not found in:\n%s", want, out)
+		}
+	}
+
+	if !printScanSummary(&bytes.Buffer{}, results[:1]) {
+		t.Errorf("ERROR: all the scans passed")
+	}
+}
@@ -0,0 +1,297 @@
+/*
+Copyright © 2021 Jose Ramon Mañes jr.mb47@gmail.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/jrmanes/axectl/pkg/container"
+	"github.com/jrmanes/axectl/pkg/sonarapi"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
+)
+
+// statusTimeout maximum time to get the status of SonarQube
+const statusTimeout = 10 * time.Second
+
+// sonarStatus is the state of the containers and the server
+type sonarStatus struct {
+	// Host url of SonarQube
+	Host string `json:"host" yaml:"host"`
+	// Runtime which manages the containers, empty for a remote SonarQube
+	Runtime string `json:"runtime,omitempty" yaml:"runtime,omitempty"`
+	// Containers of SonarQube and postgres
+	Containers []containerStatus `json:"containers" yaml:"containers"`
+	// Server state of SonarQube
+	Server serverStatus `json:"server" yaml:"server"`
+	// Database connection of SonarQube
+	Database databaseStatus `json:"database" yaml:"database"`
+	// Projects number of projects in SonarQube, null when it's unknown
+	Projects *int `json:"projects" yaml:"projects"`
+	// Tokens number of tokens in the credential store
+	Tokens int `json:"tokens" yaml:"tokens"`
+	// Errors which didn't allow to get part of the status
+	Errors []string `json:"errors,omitempty" yaml:"errors,omitempty"`
+}
+
+// containerStatus is the state of a container
+type containerStatus struct {
+	Service string   `json:"service" yaml:"service"`
+	Name    string   `json:"name" yaml:"name"`
+	Image   string   `json:"image" yaml:"image"`
+	Tag     string   `json:"tag" yaml:"tag"`
+	State   string   `json:"state" yaml:"state"`
+	Uptime  string   `json:"uptime" yaml:"uptime"`
+	Ports   []string `json:"ports" yaml:"ports"`
+}
+
+// serverStatus is the state of the SonarQube server
+type serverStatus struct {
+	Version string   `json:"version" yaml:"version"`
+	Status  string   `json:"status" yaml:"status"`
+	Health  string   `json:"health" yaml:"health"`
+	Causes  []string `json:"causes,omitempty" yaml:"causes,omitempty"`
+}
+
+// databaseStatus is the connection of SonarQube to the database
+type databaseStatus struct {
+	Connected bool   `json:"connected" yaml:"connected"`
+	Migration string `json:"migration" yaml:"migration"`
+	Message   string `json:"message,omitempty" yaml:"message,omitempty"`
+}
+
+// statusFormats renderers of every status format
+var statusFormats = map[string]func(io.Writer, sonarStatus) error{
+	"json":  renderStatusJSON,
+	"yaml":  renderStatusYAML,
+	"table": renderStatusTable,
+}
+
+// statusCmd shows the state of SonarQube
+var statusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show the state of the SonarQube containers and server",
+	Long: `Show the state of the SonarQube and postgres containers, the version and
+health of SonarQube, its database connection and the number of projects and local tokens.
+
+USAGE Examples:
+
+axectl sonar status
+axectl sonar status -o json | jq .server.health`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// load the SonarQube host and credentials
+		if err := loadSonarConfig(cmd); err != nil {
+			return err
+		}
+
+		format, _ := cmd.Flags().GetString("output")
+		render, ok := statusFormats[format]
+		if !ok {
+			return errors.New("unknown output " + format + ", use one of: json, yaml, table")
+		}
+
+		return render(os.Stdout, sonarStatusReport())
+	},
+}
+
+// init add the status command to the sonar command
+func init() {
+	sonarCmd.AddCommand(statusCmd)
+
+	statusCmd.Flags().StringP("output", "o", "table", "Output format: json, yaml or table")
+}
+
+// sonarStatusReport returns the status of the SonarQube in sonarHost
+func sonarStatusReport() sonarStatus {
+	ctx, cancel := context.WithTimeout(context.Background(), statusTimeout)
+	defer cancel()
+
+	// the containers of a remote SonarQube are not managed by axectl
+	var rt container.Runtime
+	var project container.Project
+	var errs []string
+	if isLocalHost(sonarHost) {
+		var err error
+		rt, project, err = sonarRuntime()
+		if err != nil {
+			errs = append(errs, "containers: "+err.Error())
+		}
+	}
+
+	st := collectStatus(ctx, rt, project, newSonarClient())
+	st.Errors = append(errs, st.Errors...)
+	return st
+}
+
+// collectStatus gets the state of the containers of the project, rt is nil
+// when they are not managed by axectl, and the state of the server
+func collectStatus(ctx context.Context, rt container.Runtime, project container.Project, client *sonarapi.Client) sonarStatus {
+	st := sonarStatus{Host: client.BaseURL(), Containers: []containerStatus{}}
+	fail := func(what string, err error) {
+		st.Errors = append(st.Errors, what+": "+err.Error())
+	}
+
+	if rt != nil {
+		st.Runtime = rt.Name()
+		containers, err := rt.Status(ctx, project)
+		if err != nil {
+			fail("containers", err)
+		}
+		for _, c := range containers {
+			cs := containerStatus{Service: c.Service, Name: c.Name, State: c.State, Ports: []string{}}
+			cs.Image, cs.Tag = container.ParseImage(c.Image)
+			if c.State == container.StateRunning {
+				cs.Uptime = strings.TrimPrefix(c.Status, "Up ")
+			}
+			for _, p := range c.Ports {
+				cs.Ports = append(cs.Ports, p.String())
+			}
+			st.Containers = append(st.Containers, cs)
+		}
+	}
+
+	version, err := client.ServerVersion(ctx)
+	if err != nil {
+		fail("version", err)
+	}
+	st.Server.Version = version
+
+	system, err := client.SystemStatus(ctx)
+	if err != nil {
+		fail("status", err)
+	} else {
+		st.Server.Status = system.Status
+	}
+
+	health, err := client.SystemHealth(ctx)
+	if err != nil {
+		fail("health", err)
+	} else {
+		st.Server.Health = health.Health
+		st.Server.Causes = healthCauses(health)
+	}
+
+	// SonarQube doesn't start when it can't connect to the database
+	migration, err := client.DBMigrationStatus(ctx)
+	if err != nil {
+		fail("database", err)
+	} else {
+		st.Database.Migration = migration.State
+		st.Database.Message = migration.Message
+		switch st.Server.Status {
+		case sonarapi.StatusUp, sonarapi.StatusDBMigrationNeeded, sonarapi.StatusDBMigrationRun:
+			st.Database.Connected = migration.State != sonarapi.MigrationFailed
+		}
+	}
+
+	projects, err := client.SearchProjects(ctx, "", 1, 1)
+	if err != nil {
+		fail("projects", err)
+	} else {
+		st.Projects = &projects.Paging.Total
+	}
+
+	tokens, err := localTokens()
+	if err != nil {
+		fail("tokens", err)
+	}
+	st.Tokens = len(tokens)
+
+	return st
+}
+
+// renderStatusJSON writes the status as JSON
+func renderStatusJSON(out io.Writer, st sonarStatus) error {
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(st)
+}
+
+// renderStatusYAML writes the status as YAML
+func renderStatusYAML(out io.Writer, st sonarStatus) error {
+	data, err := yaml.Marshal(st)
+	if err != nil {
+		return err
+	}
+	_, err = out.Write(data)
+	return err
+}
+
+// renderStatusTable writes the status to read it in the terminal
+func renderStatusTable(out io.Writer, st sonarStatus) error {
+	fmt.Fprintln(out, "🔭 SonarQube: "+st.Host)
+	if st.Runtime != "" {
+		fmt.Fprintln(out, "🐳 Runtime: "+st.Runtime)
+	}
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	if len(st.Containers) > 0 {
+		fmt.Fprintln(w, "\nSERVICE\tNAME\tIMAGE\tTAG\tSTATE\tUPTIME\tPORTS")
+		for _, c := range st.Containers {
+			fmt.Fprintln(w, strings.Join([]string{c.Service, c.Name, c.Image, c.Tag, c.State, c.Uptime, strings.Join(c.Ports, ", ")}, "\t"))
+		}
+		w.Flush()
+	} else if st.Runtime != "" {
+		fmt.Fprintln(out, "💤 The SonarQube containers don't exist")
+	}
+
+	// unknown values are shown as -
+	value := func(v string) string {
+		if v == "" {
+			return "-"
+		}
+		return v
+	}
+	database := "not connected"
+	if st.Database.Connected {
+		database = "connected"
+	}
+	if st.Database.Migration != "" {
+		database += ", " + st.Database.Migration
+	}
+	projects := "-"
+	if st.Projects != nil {
+		projects = strconv.Itoa(*st.Projects)
+	}
+	health := value(st.Server.Health)
+	if len(st.Server.Causes) > 0 {
+		health += " (" + strings.Join(st.Server.Causes, ", ") + ")"
+	}
+
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "📦 Version:\t"+value(st.Server.Version))
+	fmt.Fprintln(w, "🚦 Status:\t"+value(st.Server.Status))
+	fmt.Fprintln(w, "💚 Health:\t"+health)
+	fmt.Fprintln(w, "🐘 Database:\t"+database)
+	fmt.Fprintln(w, "📚 Projects:\t"+projects)
+	fmt.Fprintln(w, "🔑 Tokens:\t"+strconv.Itoa(st.Tokens)+" in the credential store")
+	w.Flush()
+
+	for _, e := range st.Errors {
+		fmt.Fprintln(out, "⚠️ "+e)
+	}
+	return nil
+}
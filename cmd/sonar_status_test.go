@@ -0,0 +1,172 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/jrmanes/axectl/pkg/container"
+	"github.com/jrmanes/axectl/pkg/sonarapi"
+	"gopkg.in/yaml.v2"
+)
+
+// fakeRuntime is a container runtime which returns the containers
+type fakeRuntime struct {
+	containers []container.Container
+	err        error
+}
+
+func (f fakeRuntime) Name() string { return "fake" }
+func (f fakeRuntime) Up(ctx context.Context, p container.Project, out io.Writer) error {
+	return nil
+}
+func (f fakeRuntime) Stop(ctx context.Context, p container.Project) error { return nil }
+func (f fakeRuntime) Down(ctx context.Context, p container.Project, volumes bool) error {
+	return nil
+}
+func (f fakeRuntime) Status(ctx context.Context, p container.Project) ([]container.Container, error) {
+	return f.containers, f.err
+}
+func (f fakeRuntime) Logs(ctx context.Context, p container.Project, service string, opts container.LogsOptions, out io.Writer) error {
+	return nil
+}
+func (f fakeRuntime) Run(ctx context.Context, spec container.RunSpec, out io.Writer) error {
+	return nil
+}
+
+// fakeSonarStatus returns a fake SonarQube which is up, the health needs the admin user
+func fakeSonarStatus() *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/server/version", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "9.2.4.50792")
+	})
+	mux.HandleFunc("/api/system/status", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"id":"1","version":"9.2.4.50792","status":"UP"}`)
+	})
+	mux.HandleFunc("/api/system/health", func(w http.ResponseWriter, r *http.Request) {
+		if _, _, ok := r.BasicAuth(); !ok {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprint(w, `{"health":"YELLOW","causes":[{"message":"Elasticsearch is slow"}]}`)
+	})
+	mux.HandleFunc("/api/system/db_migration_status", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"state":"NO_MIGRATION","message":"Database is up-to-date, no migration needed."}`)
+	})
+	mux.HandleFunc("/api/projects/search", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"paging":{"pageIndex":1,"pageSize":1,"total":3},"components":[{"key":"api","name":"api"}]}`)
+	})
+	return httptest.NewServer(mux)
+}
+
+// TestCollectStatus check the status of the containers and the server
+func TestCollectStatus(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	if err := writeToken("api", "token"); err != nil {
+		t.Fatal(err)
+	}
+	srv := fakeSonarStatus()
+	defer srv.Close()
+
+	rt := fakeRuntime{containers: []container.Container{
+		{Name: "tmp-sonarqube-1", Service: "sonarqube", Image: "docker.io/library/sonarqube:9.2-community", State: container.StateRunning, Status: "Up 2 minutes", Ports: []container.Port{{Host: 9000, Container: 9000}}},
+		{Name: "tmp-psql-1", Service: "psql", Image: "docker.io/library/postgres:9.5", State: container.StateExited, Status: "Exited (0) 1 minute ago"},
+	}}
+
+	st := collectStatus(context.Background(), rt, container.Project{}, sonarapi.NewClient(srv.URL, sonarapi.WithBasicAuth("admin", "admin")))
+	if len(st.Errors) != 0 {
+		t.Errorf("ERROR: errors: %v", st.Errors)
+	}
+	if st.Runtime != "fake" || len(st.Containers) != 2 {
+		t.Fatalf("ERROR: containers: %+v", st)
+	}
+	sonar, psql := st.Containers[0], st.Containers[1]
+	if sonar.Image != "docker.io/library/sonarqube" || sonar.Tag != "9.2-community" || sonar.Uptime != "2 minutes" || strings.Join(sonar.Ports, ",") != "9000->9000/tcp" {
+		t.Errorf("ERROR: sonarqube: %+v", sonar)
+	}
+	if psql.Uptime != "" || psql.Tag != "9.5" || psql.Ports == nil {
+		t.Errorf("ERROR: psql: %+v", psql)
+	}
+	if st.Server.Version != "9.2.4.50792" || st.Server.Status != sonarapi.StatusUp || st.Server.Health != "YELLOW" || len(st.Server.Causes) != 1 {
+		t.Errorf("ERROR: server: %+v", st.Server)
+	}
+	if !st.Database.Connected || st.Database.Migration != sonarapi.MigrationNotNeeded {
+		t.Errorf("ERROR: database: %+v", st.Database)
+	}
+	if st.Projects == nil || *st.Projects != 3 || st.Tokens != 1 {
+		t.Errorf("ERROR: projects: %v, tokens: %d", st.Projects, st.Tokens)
+	}
+
+	t.Run("cli", func(t *testing.T) {
+		project := sonarProject(defaultComposeOptions)
+		ps := "docker ps -a --no-trunc --filter label=" + container.LabelProject + "=" + project.Name + " --format {{json .}}"
+		r := &fakeRunner{outputs: map[string]string{ps: `{"ID":"c1","Names":"tmp-sonarqube-1","Image":"sonarqube:9.2-community","State":"running","Status":"Up 2 minutes","Labels":"com.docker.compose.service=sonarqube","Ports":"0.0.0.0:9000->9000/tcp"}` + "\n"}}
+		st := collectStatus(context.Background(), cliRuntime(r), project, sonarapi.NewClient(srv.URL, sonarapi.WithBasicAuth("admin", "admin")))
+		if strings.Join(r.calls, ",") != ps || len(st.Containers) != 1 || st.Containers[0].Tag != "9.2-community" {
+			t.Errorf("ERROR: calls: %q, containers: %+v", r.calls, st.Containers)
+		}
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		rt := fakeRuntime{err: errors.New("socket not found")}
+		// without credentials the health can't be read
+		st := collectStatus(context.Background(), rt, container.Project{}, sonarapi.NewClient(srv.URL))
+		if len(st.Errors) != 2 || !strings.HasPrefix(st.Errors[0], "containers:") || !strings.HasPrefix(st.Errors[1], "health:") {
+			t.Errorf("ERROR: errors: %v", st.Errors)
+		}
+		if st.Server.Version == "" || st.Projects == nil {
+			t.Errorf("ERROR: the rest of the status is expected: %+v", st)
+		}
+	})
+}
+
+// TestRenderStatus check the status in every format
+func TestRenderStatus(t *testing.T) {
+	projects := 3
+	st := sonarStatus{
+		Host:       "http://localhost:9000",
+		Runtime:    "docker",
+		Containers: []containerStatus{{Service: "sonarqube", Name: "tmp-sonarqube-1", Image: "docker.io/library/sonarqube", Tag: "9.2-community", State: "running", Uptime: "2 minutes", Ports: []string{"9000->9000/tcp"}}},
+		Server:     serverStatus{Version: "9.2.4", Status: "UP", Health: "GREEN"},
+		Database:   databaseStatus{Connected: true, Migration: "NO_MIGRATION"},
+		Projects:   &projects,
+		Tokens:     2,
+		Errors:     []string{"tokens: permission denied"},
+	}
+
+	for format, render := range statusFormats {
+		out := &bytes.Buffer{}
+		if err := render(out, st); err != nil {
+			t.Fatalf("ERROR: %s: %v", format, err)
+		}
+
+		got := sonarStatus{}
+		switch format {
+		case "json":
+			if err := json.Unmarshal(out.Bytes(), &got); err != nil {
+				t.Fatalf("ERROR: json: %v\n%s", err, out)
+			}
+		case "yaml":
+			if err := yaml.Unmarshal(out.Bytes(), &got); err != nil {
+				t.Fatalf("ERROR: yaml: %v\n%s", err, out)
+			}
+		case "table":
+			for _, want := range []string{"tmp-sonarqube-1", "9.2-community", "9000->9000/tcp", "GREEN", "connected, NO_MIGRATION", "permission denied"} {
+				if !strings.Contains(out.String(), want) {
+					t.Errorf("ERROR: table: %s not found in:\n%s", want, out)
+				}
+			}
+			continue
+		}
+		if fmt.Sprintf("%+v", got.Containers) != fmt.Sprintf("%+v", st.Containers) || got.Server.Health != "GREEN" || got.Projects == nil || *got.Projects != 3 {
+			t.Errorf("ERROR: %s: %+v", format, got)
+		}
+	}
+}
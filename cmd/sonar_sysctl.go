@@ -0,0 +1,278 @@
+/*
+Copyright © 2021 Jose Ramon Mañes jr.mb47@gmail.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/jrmanes/axectl/pkg/container"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// sysctlImage runs sysctl in the Linux VM of Docker Desktop
+const sysctlImage = "docker.io/library/busybox"
+
+// sysctlFile keeps the kernel settings of SonarQube across reboots
+var sysctlFile = "/etc/sysctl.d/99-axectl-sonarqube.conf"
+
+// isRoot returns true when axectl runs as root, it doesn't need sudo
+var isRoot = func() bool {
+	return os.Geteuid() == 0
+}
+
+// sysctlSetting is a kernel setting SonarQube needs, with its minimum value
+type sysctlSetting struct {
+	name string
+	min  int64
+}
+
+// String returns the setting as sysctl writes it
+func (s sysctlSetting) String() string {
+	return s.name + "=" + strconv.FormatInt(s.min, 10)
+}
+
+// sonarSysctl the kernel settings of the host, Elasticsearch doesn't start with lower values
+// https://docs.sonarqube.org/latest/requirements/requirements/
+var sonarSysctl = []sysctlSetting{
+	{name: "vm.max_map_count", min: minMaxMapCount},
+	{name: "fs.file-max", min: minFileMax},
+}
+
+// sonarUlimits the limits of the SonarQube processes, they are set in its
+// container, it must be kept in sync with composeTemplate
+var sonarUlimits = []container.Ulimit{
+	{Name: "nofile", Soft: 131072, Hard: 131072},
+	{Name: "nproc", Soft: 8192, Hard: 8192},
+}
+
+// init add the persist-sysctl flag to the sonar command, it can be set in the config file too
+func init() {
+	sonarCmd.PersistentFlags().BoolP("persist-sysctl", "", false, "Keep the kernel settings of SonarQube across reboots in "+sysctlFile)
+
+	cobra.CheckErr(viper.BindPFlag("sonar.persist-sysctl", sonarCmd.PersistentFlags().Lookup("persist-sysctl")))
+}
+
+// elevate returns the command run as root, with sudo when the user isn't root
+func elevate(message, command string, args ...string) Command {
+	if isRoot() {
+		return Command{message: message, command: command, args: args}
+	}
+	return Command{message: message, command: "sudo", args: append([]string{command}, args...), interactive: true}
+}
+
+// lowSettings returns the settings lower than their minimum, the ones which
+// can't be read are low too
+func lowSettings(read func(name string) (int64, error)) []sysctlSetting {
+	var low []sysctlSetting
+	for _, s := range sonarSysctl {
+		if v, err := read(s.name); err != nil || v < s.min {
+			low = append(low, s)
+		}
+	}
+	return low
+}
+
+// sysctlFileValues returns the values of the settings of SonarQube in
+// sysctlFile, the ones which can't be parsed are 0
+func sysctlFileValues() map[string]int64 {
+	values := map[string]int64{}
+	f, err := os.Open(sysctlFile)
+	if err != nil {
+		return values
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		kv := strings.SplitN(scanner.Text(), "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		v, _ := strconv.ParseInt(strings.TrimSpace(kv[1]), 10, 64)
+		values[strings.TrimSpace(kv[0])] = v
+	}
+	return values
+}
+
+// persistedSettings returns the settings of sysctlFile, written by axectl
+// before, with their value when it's higher than the minimum
+func persistedSettings() []sysctlSetting {
+	values := sysctlFileValues()
+	var settings []sysctlSetting
+	for _, s := range sonarSysctl {
+		v, ok := values[s.name]
+		if !ok {
+			continue
+		}
+		if v > s.min {
+			s.min = v
+		}
+		settings = append(settings, s)
+	}
+	return settings
+}
+
+// unpersistedSettings returns the settings lower than their minimum in
+// sysctlFile, and the ones missing there which need it: the low ones, and the
+// ones at their minimum, which axectl raised before without persisting them
+func unpersistedSettings(read func(name string) (int64, error)) []sysctlSetting {
+	values := sysctlFileValues()
+	var missing []sysctlSetting
+	for _, s := range sonarSysctl {
+		persisted, ok := values[s.name]
+		v, err := read(s.name)
+		if (ok && persisted < s.min) || (!ok && (err != nil || v <= s.min)) {
+			missing = append(missing, s)
+		}
+	}
+	return missing
+}
+
+// sysctlContent returns the content of sysctlFile, only the given settings are
+// written, a higher value of the system must not be lowered on reboot. The
+// highest value of a setting given twice is kept
+func sysctlContent(settings []sysctlSetting) string {
+	content := "# Kernel settings of SonarQube, written by axectl\n# https://docs.sonarqube.org/latest/requirements/requirements/\n"
+	for _, s := range sonarSysctl {
+		found := false
+		for _, p := range settings {
+			if p.name == s.name && (!found || p.min > s.min) {
+				s.min, found = p.min, true
+			}
+		}
+		if found {
+			content += s.String() + "\n"
+		}
+	}
+	return content
+}
+
+// settingNames returns the settings as sysctl writes them
+func settingNames(settings []sysctlSetting) []string {
+	var names []string
+	for _, s := range settings {
+		names = append(names, s.String())
+	}
+	return names
+}
+
+// ConfigureSystem set the kernel settings SonarQube needs, only the ones which
+// are too low, in macOS they are set in the Linux VM of the runtime
+// https://docs.sonarqube.org/latest/requirements/requirements/
+func ConfigureSystem(ctx context.Context, r Runner, rt container.Runtime, persist bool, out io.Writer) error {
+	// check the os and configure depending on which one is
+	switch o := detectOS(); o {
+	case "darwin":
+		return configureVM(ctx, r, rt, out)
+	case "linux":
+		return configureLinux(ctx, r, persist, out)
+	default:
+		fmt.Fprintln(out, "ℹ️  The kernel settings of SonarQube are only configured in Linux and macOS")
+	}
+	return nil
+}
+
+// configureLinux raises the low kernel settings with sysctl, and writes them
+// in sysctlFile when they are persisted
+func configureLinux(ctx context.Context, r Runner, persist bool, out io.Writer) error {
+	low := lowSettings(readSysctl)
+	var unpersisted []sysctlSetting
+	if persist {
+		unpersisted = unpersistedSettings(readSysctl)
+	}
+	if len(low) == 0 && len(unpersisted) == 0 {
+		fmt.Fprintln(out, "✅ The kernel settings of SonarQube are already configured")
+		return nil
+	}
+
+	if len(low) > 0 {
+		fmt.Fprintln(out, "🔧 We need going to configuring the system: \n\t https://docs.sonarqube.org/latest/requirements/requirements/ \n\t sysctl to -> "+strings.Join(settingNames(low), " "))
+	}
+	if !isRoot() {
+		fmt.Fprintln(out, "🔓 We need to run as ROOT...")
+	}
+
+	commands := Commands{elevate("", "sysctl", append([]string{"-w"}, settingNames(low)...)...)}
+	if persist {
+		// the settings persisted before are kept, the file is written by root
+		// from the input, it's never staged in a folder other users can write
+		settings := append(persistedSettings(), unpersisted...)
+		write := elevate("📝 Persisting the settings in "+sysctlFile, "tee", sysctlFile)
+		write.input = sysctlContent(settings)
+		commands = Commands{write, elevate("", "sysctl", "-p", sysctlFile)}
+	}
+	if err := runCommands(ctx, r, commands, out); err != nil {
+		return err
+	}
+
+	if !persist {
+		fmt.Fprintln(out, "ℹ️  The settings are lost on reboot, keep them in "+sysctlFile+" with: axectl sonar up --persist-sysctl")
+	}
+	return nil
+}
+
+// configureVM raises the low kernel settings of the Linux VM where the
+// containers run: the podman machine through ssh, the VM of Docker Desktop
+// with a privileged container
+func configureVM(ctx context.Context, r Runner, rt container.Runtime, out io.Writer) error {
+	if rt == nil {
+		return nil
+	}
+
+	podman := strings.HasPrefix(rt.Name(), runtimePodman)
+	read := func(name string) (int64, error) {
+		var output string
+		var err error
+		if podman {
+			output, err = r.Output(ctx, Command{command: "podman", args: []string{"machine", "ssh", "sysctl", "-n", name}})
+		} else {
+			var buf bytes.Buffer
+			err = rt.Run(ctx, container.RunSpec{Image: sysctlImage, Args: []string{"sysctl", "-n", name}}, &buf)
+			output = buf.String()
+		}
+		if err != nil {
+			return 0, err
+		}
+		return strconv.ParseInt(strings.TrimSpace(output), 10, 64)
+	}
+
+	low := lowSettings(read)
+	if len(low) == 0 {
+		fmt.Fprintln(out, "✅ The kernel settings of SonarQube are already configured in the VM")
+		return nil
+	}
+
+	fmt.Fprintln(out, "🔧 Configuring the Linux VM of "+rt.Name()+": sysctl to -> "+strings.Join(settingNames(low), " "))
+	args := append([]string{"sysctl", "-w"}, settingNames(low)...)
+	if podman {
+		if err := r.Run(ctx, Command{command: "podman", args: append([]string{"machine", "ssh", "sudo"}, args...)}); err != nil {
+			return err
+		}
+	} else if err := rt.Run(ctx, container.RunSpec{Image: sysctlImage, Privileged: true, Args: args}, io.Discard); err != nil {
+		return fmt.Errorf("the kernel settings of the VM can't be changed: %w", err)
+	}
+
+	fmt.Fprintln(out, "ℹ️  The VM loses the settings when it restarts, axectl sonar up sets them again")
+	return nil
+}
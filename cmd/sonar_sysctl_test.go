@@ -0,0 +1,135 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jrmanes/axectl/pkg/container"
+)
+
+// TestConfigureLinux check only the low settings are raised, and how they are persisted
+func TestConfigureLinux(t *testing.T) {
+	defer func(dir, file string, root func() bool) { procSys, sysctlFile, isRoot = dir, file, root }(procSys, sysctlFile, isRoot)
+	sysctlFile = filepath.Join(t.TempDir(), "99-axectl-sonarqube.conf")
+
+	var tests = []struct {
+		name        string
+		maxMapCount string
+		fileMax     string
+		root        bool
+		persist     bool
+		persisted   string
+		want        []string
+		content     string
+	}{
+		{"configured", "262144", "9223372036854775807", false, false, "", nil, ""},
+		{"low max_map_count", "65530", "9223372036854775807", false, false, "", []string{"sudo sysctl -w vm.max_map_count=262144"}, ""},
+		{"all low as root", "65530", "65536", true, false, "", []string{"sysctl -w vm.max_map_count=262144 fs.file-max=131072"}, ""},
+		{"unreadable", "", "", false, false, "", []string{"sudo sysctl -w vm.max_map_count=262144 fs.file-max=131072"}, ""},
+		{"persist", "65530", "9223372036854775807", false, true, "", []string{"sudo tee " + sysctlFile, "sudo sysctl -p " + sysctlFile},
+			"# Kernel settings of SonarQube, written by axectl\n# https://docs.sonarqube.org/latest/requirements/requirements/\nvm.max_map_count=262144\n"},
+		{"persist keeping the old settings", "262144", "65536", false, true, "fs.file-max=131072\nvm.max_map_count = 262144\n", []string{"sudo tee " + sysctlFile, "sudo sysctl -p " + sysctlFile},
+			"# Kernel settings of SonarQube, written by axectl\n# https://docs.sonarqube.org/latest/requirements/requirements/\nvm.max_map_count=262144\nfs.file-max=131072\n"},
+		{"persist keeping a higher value", "65530", "65536", false, true, "vm.max_map_count=1048576\nfs.file-max=100\n", []string{"sudo tee " + sysctlFile, "sudo sysctl -p " + sysctlFile},
+			"# Kernel settings of SonarQube, written by axectl\n# https://docs.sonarqube.org/latest/requirements/requirements/\nvm.max_map_count=1048576\nfs.file-max=131072\n"},
+		{"persisted and configured", "262144", "9223372036854775807", false, true, "vm.max_map_count=262144\n", nil, ""},
+		{"persist a setting raised before", "262144", "9223372036854775807", false, true, "", []string{"sudo tee " + sysctlFile, "sudo sysctl -p " + sysctlFile},
+			"# Kernel settings of SonarQube, written by axectl\n# https://docs.sonarqube.org/latest/requirements/requirements/\nvm.max_map_count=262144\n"},
+		{"persist over a stale file", "1048576", "9223372036854775807", false, true, "vm.max_map_count=65530\n", []string{"sudo tee " + sysctlFile, "sudo sysctl -p " + sysctlFile},
+			"# Kernel settings of SonarQube, written by axectl\n# https://docs.sonarqube.org/latest/requirements/requirements/\nvm.max_map_count=262144\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			os.Remove(sysctlFile)
+			if tt.persisted != "" {
+				if err := os.WriteFile(sysctlFile, []byte(tt.persisted), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			procSys = fakeProcSys(t, tt.maxMapCount, tt.fileMax)
+			if tt.maxMapCount == "" {
+				procSys = t.TempDir()
+			}
+			isRoot = func() bool { return tt.root }
+
+			r := &fakeRunner{}
+			if err := configureLinux(context.Background(), r, tt.persist, io.Discard); err != nil {
+				t.Fatalf("ERROR: %v", err)
+			}
+			if strings.Join(r.calls, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("ERROR: calls: %q\nwant: %q", r.calls, tt.want)
+			}
+			if content := r.inputs["sudo tee "+sysctlFile]; content != tt.content {
+				t.Errorf("ERROR: content:\n%s\nwant:\n%s", content, tt.content)
+			}
+		})
+	}
+
+	// the failed step is in the error
+	procSys = fakeProcSys(t, "65530", "65536")
+	r := &fakeRunner{errors: map[string]error{"sudo sysctl -p " + sysctlFile: errors.New("exit status 255")}}
+	if err := configureLinux(context.Background(), r, true, io.Discard); err == nil || !strings.Contains(err.Error(), "step 2 of 2 failed") {
+		t.Errorf("ERROR: failed sysctl: %v", err)
+	}
+}
+
+// sysctlRuntime is a container runtime whose sysctl containers print the values of the settings
+type sysctlRuntime struct {
+	recordRuntime
+	name   string
+	values map[string]string
+}
+
+func (r sysctlRuntime) Name() string { return r.name }
+func (r sysctlRuntime) Run(ctx context.Context, spec container.RunSpec, out io.Writer) error {
+	r.record(fmt.Sprintf("runtime run privileged=%t %s %s", spec.Privileged, spec.Image, strings.Join(spec.Args, " ")))
+	if len(spec.Args) == 3 && spec.Args[1] == "-n" {
+		fmt.Fprintln(out, r.values[spec.Args[2]])
+	}
+	return r.runErr
+}
+
+// TestConfigureVM check the settings of the Linux VM of Docker Desktop and the podman machine
+func TestConfigureVM(t *testing.T) {
+	read := func(name string) string {
+		return "runtime run privileged=false " + sysctlImage + " sysctl -n " + name
+	}
+
+	var tests = []struct {
+		name    string
+		runtime string
+		values  map[string]string
+		runErr  error
+		want    []string
+		err     bool
+	}{
+		{"docker configured", "docker", map[string]string{"vm.max_map_count": "262144", "fs.file-max": "524288"}, nil, []string{read("vm.max_map_count"), read("fs.file-max")}, false},
+		{"docker low", "docker (engine API: /var/run/docker.sock)", map[string]string{"vm.max_map_count": "65530", "fs.file-max": "524288"}, nil,
+			[]string{read("vm.max_map_count"), read("fs.file-max"), "runtime run privileged=true " + sysctlImage + " sysctl -w vm.max_map_count=262144"}, false},
+		{"docker failed", "docker", nil, errors.New("exit status 1"),
+			[]string{read("vm.max_map_count"), read("fs.file-max"), "runtime run privileged=true " + sysctlImage + " sysctl -w vm.max_map_count=262144 fs.file-max=131072"}, true},
+		{"podman low", "podman", map[string]string{"podman machine ssh sysctl -n vm.max_map_count": "262144\n", "podman machine ssh sysctl -n fs.file-max": "65536\n"}, nil,
+			[]string{"podman machine ssh sysctl -n vm.max_map_count", "podman machine ssh sysctl -n fs.file-max", "podman machine ssh sudo sysctl -w fs.file-max=131072"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &fakeRunner{outputs: tt.values}
+			rt := sysctlRuntime{recordRuntime: recordRuntime{runner: r, runErr: tt.runErr}, name: tt.runtime, values: tt.values}
+			err := configureVM(context.Background(), r, rt, io.Discard)
+			if (err != nil) != tt.err {
+				t.Errorf("ERROR: unexpected error: %v", err)
+			}
+			if strings.Join(r.calls, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("ERROR: calls: %q\nwant: %q", r.calls, tt.want)
+			}
+		})
+	}
+}
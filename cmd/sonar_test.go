@@ -5,7 +5,9 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/spf13/cobra"
@@ -126,3 +128,59 @@ func TestCommandExists(t *testing.T) {
 		}
 	})
 }
+
+// TestIsLocalHost check which SonarQube urls are managed by axectl
+func TestIsLocalHost(t *testing.T) {
+	var tests = []struct {
+		host string
+		want bool
+	}{
+		{"http://localhost:9000", true},
+		{"http://127.0.0.1:9001", true},
+		{"http://[::1]:9000", true},
+		{"https://sonar.example.com", false},
+		{"http://10.0.0.5:9000", false},
+		{"::not a url", false},
+	}
+
+	for _, tt := range tests {
+		if got := isLocalHost(tt.host); got != tt.want {
+			t.Errorf("ERROR: host: %s, got: %t, want: %t", tt.host, got, tt.want)
+		}
+	}
+}
+
+// TestScannerArgs check the network and host used by the scanner
+func TestScannerArgs(t *testing.T) {
+	defer func(h, s string) { sonarHost, selinuxEnforce = h, s }(sonarHost, selinuxEnforce)
+	selinuxEnforce = filepath.Join(t.TempDir(), "enforce")
+
+	var tests = []struct {
+		host    string
+		network bool
+		url     string
+	}{
+		{"http://localhost:9000", true, sonarInternalHost},
+		{"https://sonar.example.com", false, "https://sonar.example.com"},
+	}
+
+	for _, tt := range tests {
+		sonarHost = tt.host
+		spec := scannerSpec("/src", scanProject{key: "axectl", dir: "axectl", token: "squ_1"}, scanOptions{})
+		args := strings.Join(spec.Args, " ")
+
+		if got := spec.Network == sonarNetwork; got != tt.network {
+			t.Errorf("ERROR: host: %s, network: %t, spec: %+v", tt.host, got, spec)
+		}
+		if strings.Join(spec.Env, " ") != "SONAR_HOST_URL="+tt.url || !strings.Contains(args, "-Dsonar.host.url="+tt.url) {
+			t.Errorf("ERROR: host: %s, spec: %+v", tt.host, spec)
+		}
+		if spec.Image != scannerImage || spec.Binds[0] != "/src/:"+scannerMount {
+			t.Errorf("ERROR: host: %s, spec: %+v", tt.host, spec)
+		}
+		// the token is never an argument
+		if strings.Join(spec.Secrets, " ") != "SONAR_TOKEN=squ_1" || strings.Contains(args, "squ_1") {
+			t.Errorf("ERROR: host: %s, token: %+v", tt.host, spec)
+		}
+	}
+}
@@ -0,0 +1,360 @@
+/*
+Copyright © 2021 Jose Ramon Mañes jr.mb47@gmail.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/jrmanes/axectl/pkg/sonarapi"
+	"github.com/spf13/cobra"
+)
+
+// tokenCmd represents the sonar token command
+var tokenCmd = &cobra.Command{
+	Use:   "token",
+	Short: "Manage the project tokens stored in the credential store",
+	Long: `Manage the project tokens created by axectl.
+
+The tokens are stored in the credential store, ~/.axectl/sonar/tokens/<project> by default
+(see: axectl config migrate-credentials), and in SonarQube for the admin user, the commands
+keep both places in sync.
+
+USAGE Examples:
+
+axectl sonar token list
+axectl sonar token show someProject
+axectl sonar token show someProject --reveal
+axectl sonar token rotate someProject
+axectl sonar token revoke someProject1 someProject2
+axectl sonar token prune`,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		// it replaces the one of the root command, which checks the config file
+		if configErr != nil {
+			return configErr
+		}
+		// load the SonarQube host and credentials
+		return loadSonarConfig(cmd)
+	},
+}
+
+// tokenListCmd lists the local and the remote tokens
+var tokenListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the tokens, local files and tokens in SonarQube",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		tokens, err := reconcileTokens(context.Background(), newSonarClient())
+		if err != nil {
+			return err
+		}
+		printTokens(os.Stdout, tokens)
+		return nil
+	},
+}
+
+// tokenShowCmd shows the value of a token
+var tokenShowCmd = &cobra.Command{
+	Use:   "show <project>",
+	Short: "Show the token of a project, masked unless --reveal is used",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		token, err := readToken(args[0])
+		if err != nil {
+			return fmt.Errorf("token not found for project %s: %w", args[0], err)
+		}
+		if reveal, _ := cmd.Flags().GetBool("reveal"); reveal {
+			fmt.Println(token)
+			return nil
+		}
+		fmt.Println(maskSecret(token))
+		return nil
+	},
+}
+
+// tokenRevokeCmd revokes tokens in SonarQube and removes the local files
+var tokenRevokeCmd = &cobra.Command{
+	Use:     "revoke <project>...",
+	Aliases: []string{"delete"},
+	Short:   "Revoke the tokens of the projects and remove the local files",
+	Args:    cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client := newSonarClient()
+		for _, name := range args {
+			if err := revokeToken(context.Background(), client, name); err != nil {
+				return err
+			}
+			fmt.Fprintln(actionOutput(), "🗑️ Token revoked: ", name)
+		}
+		return nil
+	},
+}
+
+// tokenRotateCmd replaces tokens by new ones
+var tokenRotateCmd = &cobra.Command{
+	Use:   "rotate <project>...",
+	Short: "Generate new tokens for the projects and revoke the old ones",
+	Args:  cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client := newSonarClient()
+		for _, name := range args {
+			if err := rotateToken(context.Background(), client, name); err != nil {
+				return err
+			}
+			fmt.Fprintln(actionOutput(), "🔄 Token rotated: ", name)
+		}
+		return nil
+	},
+}
+
+// tokenPruneCmd removes the local files of tokens which don't exist in SonarQube
+var tokenPruneCmd = &cobra.Command{
+	Use:   "prune",
+	Short: "Remove the local tokens which don't exist anymore in SonarQube",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		tokens, err := reconcileTokens(context.Background(), newSonarClient())
+		if err != nil {
+			return err
+		}
+
+		pruned := 0
+		for _, t := range tokens {
+			if t.state() != tokenOrphaned {
+				continue
+			}
+			if err := removeToken(t.Name); err != nil {
+				return err
+			}
+			fmt.Fprintln(actionOutput(), "🗑️ Orphaned token removed: ", t.Name)
+			pruned++
+		}
+		if pruned == 0 {
+			fmt.Fprintln(actionOutput(), "✅ There are no orphaned tokens")
+		}
+		return nil
+	},
+}
+
+// init add the token commands to the sonar command
+func init() {
+	sonarCmd.AddCommand(tokenCmd)
+	tokenCmd.AddCommand(tokenListCmd, tokenShowCmd, tokenRevokeCmd, tokenRotateCmd, tokenPruneCmd)
+	tokenShowCmd.Flags().BoolP("reveal", "", false, "Print the whole token instead of a masked one")
+	for _, c := range []*cobra.Command{tokenRevokeCmd, tokenRotateCmd, tokenPruneCmd} {
+		planCommand(c)
+	}
+}
+
+// token states after comparing the local files with SonarQube
+const (
+	tokenSynced     = "ok"
+	tokenOrphaned   = "orphaned"
+	tokenRemoteOnly = "remote only"
+)
+
+// tokenRotated separates the project and the time of rotation in the name of
+// a rotated token, the names are unique in SonarQube and the keys of the
+// projects don't have spaces
+const tokenRotated = " rotated "
+
+// tokenProject returns the project of a token in SonarQube
+func tokenProject(name string) string {
+	return strings.SplitN(name, tokenRotated, 2)[0]
+}
+
+// tokenInfo is a token found locally, in SonarQube or in both
+type tokenInfo struct {
+	// Name of the token, it's the project name
+	Name string
+	// Local true if the token is in the credential store
+	Local bool
+	// Remote token in SonarQube, nil if it doesn't exist
+	Remote *sonarapi.UserToken
+}
+
+// state returns if the token is synced, orphaned or only in SonarQube
+func (t tokenInfo) state() string {
+	switch {
+	case t.Local && t.Remote != nil:
+		return tokenSynced
+	case t.Local:
+		return tokenOrphaned
+	default:
+		return tokenRemoteOnly
+	}
+}
+
+// reconcileTokens compares the local token files with the tokens of the user in SonarQube
+func reconcileTokens(ctx context.Context, client *sonarapi.Client) ([]tokenInfo, error) {
+	local, err := localTokens()
+	if err != nil {
+		return nil, err
+	}
+	remote, err := client.SearchTokens(ctx, sonarUser)
+	if err != nil {
+		return nil, err
+	}
+
+	byName := map[string]*tokenInfo{}
+	for _, name := range local {
+		byName[name] = &tokenInfo{Name: name, Local: true}
+	}
+	for i := range remote {
+		name := tokenProject(remote[i].Name)
+		t, ok := byName[name]
+		if !ok {
+			t = &tokenInfo{Name: name}
+			byName[name] = t
+		}
+		t.Remote = &remote[i]
+	}
+
+	tokens := make([]tokenInfo, 0, len(byName))
+	for _, t := range byName {
+		tokens = append(tokens, *t)
+	}
+	sort.Slice(tokens, func(i, j int) bool { return tokens[i].Name < tokens[j].Name })
+
+	return tokens, nil
+}
+
+// printTokens prints the tokens in a table
+func printTokens(out io.Writer, tokens []tokenInfo) {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tSTATE\tCREATED\tLAST USED")
+	for _, t := range tokens {
+		created, used := "-", "-"
+		if t.Remote != nil {
+			created = t.Remote.CreatedAt
+			if t.Remote.LastConnectionDate != "" {
+				used = t.Remote.LastConnectionDate
+			}
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", t.Name, t.state(), created, used)
+	}
+	w.Flush()
+
+	for _, t := range tokens {
+		if t.state() == tokenOrphaned {
+			fmt.Fprintln(out, "⚠️ Some local tokens don't exist in SonarQube, remove them with: axectl sonar token prune")
+			break
+		}
+	}
+}
+
+// remoteTokens returns the names of the tokens of the project in SonarQube
+func remoteTokens(ctx context.Context, client *sonarapi.Client, name string) ([]string, error) {
+	remote, err := client.SearchTokens(ctx, sonarUser)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, t := range remote {
+		if tokenProject(t.Name) == name {
+			names = append(names, t.Name)
+		}
+	}
+	return names, nil
+}
+
+// revokeToken revokes the tokens of the project in SonarQube and removes the local file
+func revokeToken(ctx context.Context, client *sonarapi.Client, name string) error {
+	names, err := remoteTokens(ctx, client, name)
+	if err != nil {
+		return err
+	}
+	for _, n := range names {
+		if err := client.RevokeToken(ctx, n, sonarUser); err != nil {
+			return err
+		}
+	}
+	return removeToken(name)
+}
+
+// rotateToken generates a new token and stores it before the old ones are
+// revoked, the project is never left without a valid token. The local file
+// is replaced in one step, so it's never half written
+func rotateToken(ctx context.Context, client *sonarapi.Client, name string) error {
+	old, err := remoteTokens(ctx, client, name)
+	if err != nil {
+		return err
+	}
+	token, err := client.GenerateToken(ctx, name+tokenRotated+time.Now().UTC().Format(time.RFC3339Nano), sonarUser)
+	if err != nil {
+		return err
+	}
+	if err := writeToken(name, token.Token); err != nil {
+		return err
+	}
+	for _, n := range old {
+		if err := client.RevokeToken(ctx, n, sonarUser); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// localTokens returns the names of the tokens stored in the credential store
+func localTokens() ([]string, error) {
+	store, err := secretStore()
+	if err != nil {
+		return nil, err
+	}
+	keys, err := store.List(tokensPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, k := range keys {
+		names = append(names, strings.TrimPrefix(k, tokensPrefix))
+	}
+	return names, nil
+}
+
+// readToken returns the token of the project from the credential store
+func readToken(name string) (string, error) {
+	store, err := secretStore()
+	if err != nil {
+		return "", err
+	}
+	return store.Get(tokensPrefix + name)
+}
+
+// writeToken stores the token of the project in the credential store
+func writeToken(name, token string) error {
+	store, err := secretStore()
+	if err != nil {
+		return err
+	}
+	return store.Set(tokensPrefix+name, token)
+}
+
+// removeToken removes the token of the project from the credential store, it's fine if it doesn't exist
+func removeToken(name string) error {
+	store, err := secretStore()
+	if err != nil {
+		return err
+	}
+	return store.Delete(tokensPrefix + name)
+}
@@ -0,0 +1,127 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/jrmanes/axectl/pkg/sonarapi"
+)
+
+// fakeSonarTokens returns a fake SonarQube with the tokens in remote
+func fakeSonarTokens(remote map[string]bool) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/user_tokens/search", func(w http.ResponseWriter, r *http.Request) {
+		var tokens []string
+		for name := range remote {
+			tokens = append(tokens, fmt.Sprintf(`{"name":%q,"createdAt":"2021-12-01"}`, name))
+		}
+		fmt.Fprintf(w, `{"login":"admin","userTokens":[%s]}`, strings.Join(tokens, ","))
+	})
+	mux.HandleFunc("/api/user_tokens/revoke", func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+		delete(remote, r.Form.Get("name"))
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("/api/user_tokens/generate", func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+		name := r.Form.Get("name")
+		remote[name] = true
+		fmt.Fprintf(w, `{"login":"admin","name":%q,"token":"new-%s"}`, name, name)
+	})
+	return httptest.NewServer(mux)
+}
+
+// TestTokens check the reconciliation, rotation and revocation of tokens
+func TestTokens(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	remote := map[string]bool{"synced": true, "remote": true}
+	srv := fakeSonarTokens(remote)
+	defer srv.Close()
+	client := sonarapi.NewClient(srv.URL)
+	ctx := context.Background()
+
+	for _, name := range []string{"synced", "orphaned"} {
+		if err := writeToken(name, "old-"+name); err != nil {
+			t.Fatalf("ERROR: %v", err)
+		}
+	}
+
+	tokens, err := reconcileTokens(ctx, client)
+	if err != nil {
+		t.Fatalf("ERROR: %v", err)
+	}
+	want := map[string]string{"orphaned": tokenOrphaned, "remote": tokenRemoteOnly, "synced": tokenSynced}
+	if len(tokens) != len(want) {
+		t.Errorf("ERROR: tokens: %v", tokens)
+	}
+	for _, tk := range tokens {
+		if tk.state() != want[tk.Name] {
+			t.Errorf("ERROR: token: %s, state: %s, want: %s", tk.Name, tk.state(), want[tk.Name])
+		}
+	}
+
+	out := &bytes.Buffer{}
+	printTokens(out, tokens)
+	if !strings.Contains(out.String(), "token prune") {
+		t.Errorf("ERROR: orphaned tokens not reported: %s", out)
+	}
+
+	t.Run("rotate", func(t *testing.T) {
+		if err := rotateToken(ctx, client, "synced"); err != nil {
+			t.Fatalf("ERROR: %v", err)
+		}
+		if token, _ := readToken("synced"); !strings.HasPrefix(token, "new-synced"+tokenRotated) {
+			t.Errorf("ERROR: token not replaced: %s", token)
+		}
+		// the old token is revoked, the new one belongs to the project
+		tokens, err := reconcileTokens(ctx, client)
+		if err != nil || remote["synced"] || len(remote) != 2 {
+			t.Errorf("ERROR: remote tokens: %v, %v", remote, err)
+		}
+		for _, tk := range tokens {
+			if tk.Name == "synced" && tk.state() != tokenSynced {
+				t.Errorf("ERROR: rotated token: %s", tk.state())
+			}
+		}
+		// no temporary files are left behind
+		if names, _ := localTokens(); len(names) != 2 {
+			t.Errorf("ERROR: local tokens: %v", names)
+		}
+	})
+
+	t.Run("revoke", func(t *testing.T) {
+		if err := revokeToken(ctx, client, "synced"); err != nil {
+			t.Fatalf("ERROR: %v", err)
+		}
+		if len(remote) != 1 {
+			t.Errorf("ERROR: token not revoked in SonarQube: %v", remote)
+		}
+		if _, err := readToken("synced"); err == nil {
+			t.Errorf("ERROR: token file not removed")
+		}
+	})
+}
+
+// TestMaskSecret check the secrets are not shown
+func TestMaskSecret(t *testing.T) {
+	var tests = []struct {
+		secret string
+		want   string
+	}{
+		{"", ""},
+		{"short", "*****"},
+		{"squ_0123456789abcdef", "squ_************cdef"},
+	}
+
+	for _, tt := range tests {
+		if got := maskSecret(tt.secret); got != tt.want {
+			t.Errorf("ERROR: %s: %s, want: %s", tt.secret, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,173 @@
+/*
+Copyright © 2021 Jose Ramon Mañes jr.mb47@gmail.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/jrmanes/axectl/pkg/sonarapi"
+)
+
+// waitOptions configures how long and how often we ask SonarQube if it's ready
+type waitOptions struct {
+	// timeout maximum time to wait for SonarQube
+	timeout time.Duration
+	// interval first wait between two checks, it's doubled after every check
+	interval time.Duration
+	// maxInterval maximum wait between two checks
+	maxInterval time.Duration
+}
+
+// defaultWaitOptions are used when no flag is provided
+var defaultWaitOptions = waitOptions{
+	timeout:     5 * time.Minute,
+	interval:    2 * time.Second,
+	maxInterval: 10 * time.Second,
+}
+
+// clocks emojis used to show the progress
+var clocks = []string{"🕐", "🕑", "🕒", "🕓", "🕔", "🕕", "🕖", "🕗", "🕘", "🕙", "🕚", "🕛"}
+
+// waitForSonar polls /api/system/status until SonarQube is UP and then
+// /api/system/health until it's not RED, printing the progress to out
+func waitForSonar(ctx context.Context, client *sonarapi.Client, opts waitOptions, out io.Writer) error {
+	ctx, cancel := context.WithTimeout(ctx, opts.timeout)
+	defer cancel()
+
+	if err := waitForStatus(ctx, client, opts, out); err != nil {
+		return err
+	}
+	return waitForHealth(ctx, client, opts, out)
+}
+
+// waitForStatus polls /api/system/status until SonarQube is UP, ctx must have a deadline
+func waitForStatus(ctx context.Context, client *sonarapi.Client, opts waitOptions, out io.Writer) error {
+	started := time.Now()
+	poll := newPoller(opts)
+
+	for {
+		status, err := client.SystemStatus(ctx)
+		switch {
+		case err != nil:
+			fmt.Fprintf(out, "%s SonarQube is not reachable yet (%s)\n", poll.clock(), elapsed(started))
+		case status.Status == sonarapi.StatusUp:
+			fmt.Fprintf(out, "✅ SonarQube %s is UP (%s)\n", status.Version, elapsed(started))
+		case status.Status == sonarapi.StatusDown:
+			return errors.New("SonarQube is DOWN, check its logs with: axectl sonar logs")
+		case status.Status == sonarapi.StatusDBMigrationNeeded:
+			return fmt.Errorf("SonarQube needs a database migration, open %s/setup to run it", client.BaseURL())
+		default:
+			fmt.Fprintf(out, "%s SonarQube is %s (%s)\n", poll.clock(), status.Status, elapsed(started))
+		}
+		if err == nil && status.Status == sonarapi.StatusUp {
+			break
+		}
+
+		if err := poll.wait(ctx); err != nil {
+			return fmt.Errorf("SonarQube was not UP after %s", opts.timeout)
+		}
+	}
+
+	return nil
+}
+
+// waitForHealth polls /api/system/health until it's not RED, ctx must have a deadline
+func waitForHealth(ctx context.Context, client *sonarapi.Client, opts waitOptions, out io.Writer) error {
+	started := time.Now()
+	poll := newPoller(opts)
+
+	var causes []string
+	for {
+		health, err := client.SystemHealth(ctx)
+		switch {
+		case sonarapi.IsUnauthorized(err) || sonarapi.IsForbidden(err):
+			// the health needs an admin user, we can't check it without one
+			fmt.Fprintln(out, "⚠️ The health of SonarQube can't be checked with the user: "+sonarUser)
+			return nil
+		case err != nil:
+			fmt.Fprintf(out, "%s SonarQube health is not available yet (%s)\n", poll.clock(), elapsed(started))
+		case health.Health == sonarapi.HealthGreen:
+			fmt.Fprintf(out, "💚 SonarQube health is GREEN (%s)\n", elapsed(started))
+			return nil
+		case health.Health == sonarapi.HealthYellow:
+			fmt.Fprintf(out, "💛 SonarQube health is YELLOW: %s\n", strings.Join(healthCauses(health), ", "))
+			return nil
+		default:
+			causes = healthCauses(health)
+			fmt.Fprintf(out, "%s SonarQube health is %s (%s)\n", poll.clock(), health.Health, elapsed(started))
+		}
+
+		if err := poll.wait(ctx); err != nil {
+			return fmt.Errorf("SonarQube health was not GREEN after %s: %s", opts.timeout, strings.Join(causes, ", "))
+		}
+	}
+}
+
+// poller waits between checks with an exponential backoff
+type poller struct {
+	// opts limits of the backoff
+	opts waitOptions
+	// next wait
+	next time.Duration
+	// tick number of checks done, used for the clocks
+	tick int
+}
+
+// newPoller returns a poller starting with the first interval
+func newPoller(opts waitOptions) *poller {
+	return &poller{opts: opts, next: opts.interval}
+}
+
+// wait sleeps until the next check or the context is done
+func (p *poller) wait(ctx context.Context) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(p.next):
+	}
+
+	p.next *= 2
+	if p.next > p.opts.maxInterval {
+		p.next = p.opts.maxInterval
+	}
+	return nil
+}
+
+// clock returns the next clock emoji
+func (p *poller) clock() string {
+	c := clocks[p.tick%len(clocks)]
+	p.tick++
+	return c
+}
+
+// healthCauses returns the messages of the health causes
+func healthCauses(health *sonarapi.Health) []string {
+	var causes []string
+	for _, c := range health.Causes {
+		causes = append(causes, c.Message)
+	}
+	return causes
+}
+
+// elapsed returns the time since started rounded to seconds
+func elapsed(started time.Time) time.Duration {
+	return time.Since(started).Round(time.Second)
+}
@@ -0,0 +1,84 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jrmanes/axectl/pkg/sonarapi"
+)
+
+// TestWaitForSonar check the different states SonarQube goes through while it's starting
+func TestWaitForSonar(t *testing.T) {
+	var tests = []struct {
+		name     string
+		statuses []string
+		health   string
+		err      string
+	}{
+		{"starting then up", []string{"STARTING", "STARTING", "UP"}, `{"health":"GREEN"}`, ""},
+		{"migration running then up", []string{"DB_MIGRATION_RUNNING", "UP"}, `{"health":"YELLOW","causes":[{"message":"slow"}]}`, ""},
+		{"down", []string{"STARTING", "DOWN"}, "", "DOWN"},
+		{"migration needed", []string{"DB_MIGRATION_NEEDED"}, "", "database migration"},
+		{"never up", []string{"STARTING"}, "", "was not UP"},
+		{"red health", []string{"UP"}, `{"health":"RED","causes":[{"message":"es is down"}]}`, "es is down"},
+		{"health without admin", []string{"UP"}, "401", ""},
+	}
+
+	opts := waitOptions{timeout: 200 * time.Millisecond, interval: time.Millisecond, maxInterval: 5 * time.Millisecond}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			mux := http.NewServeMux()
+			mux.HandleFunc("/api/system/status", func(w http.ResponseWriter, r *http.Request) {
+				// the last status is repeated until the end
+				s := tt.statuses[len(tt.statuses)-1]
+				if calls < len(tt.statuses) {
+					s = tt.statuses[calls]
+				}
+				calls++
+				fmt.Fprintf(w, `{"id":"1","version":"9.2","status":%q}`, s)
+			})
+			mux.HandleFunc("/api/system/health", func(w http.ResponseWriter, r *http.Request) {
+				if tt.health == "401" {
+					w.WriteHeader(http.StatusUnauthorized)
+					return
+				}
+				fmt.Fprint(w, tt.health)
+			})
+			srv := httptest.NewServer(mux)
+			defer srv.Close()
+
+			out := &bytes.Buffer{}
+			err := waitForSonar(context.Background(), sonarapi.NewClient(srv.URL), opts, out)
+
+			if tt.err == "" && err != nil {
+				t.Errorf("ERROR: unexpected error: %v, output: %s", err, out)
+			}
+			if tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+				t.Errorf("ERROR: got: %v, want: %s", err, tt.err)
+			}
+		})
+	}
+}
+
+// TestWaitForSonarUnreachable check that connection errors are retried until the timeout
+func TestWaitForSonarUnreachable(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	url := srv.URL
+	srv.Close()
+
+	opts := waitOptions{timeout: 50 * time.Millisecond, interval: time.Millisecond, maxInterval: 5 * time.Millisecond}
+	out := &bytes.Buffer{}
+
+	err := waitForSonar(context.Background(), sonarapi.NewClient(url), opts, out)
+	if err == nil || !strings.Contains(out.String(), "not reachable") {
+		t.Errorf("ERROR: err: %v, output: %s", err, out)
+	}
+}
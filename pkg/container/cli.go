@@ -0,0 +1,282 @@
+/*
+Copyright © 2021 Jose Ramon Mañes jr.mb47@gmail.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package container
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Runner executes the commands of the CLI, axectl runs them with its own
+// runner, which adds them to the plan in a dry run, the tests record them
+type Runner interface {
+	// Run executes the command writing its output to out, the error has the
+	// output when out is nil
+	Run(ctx context.Context, c Cmd, out io.Writer) error
+	// Output executes the command and returns its standard output, the error
+	// has the standard error
+	Output(ctx context.Context, c Cmd) (string, error)
+}
+
+// Cmd is a command executed by the CLI
+type Cmd struct {
+	// Name of the command: docker, podman, docker-compose...
+	Name string
+	// Args arguments of the command
+	Args []string
+	// Env variables added to the environment, the secrets of the containers
+	Env []string
+}
+
+// String returns the command line, without the environment
+func (c Cmd) String() string {
+	return strings.TrimSpace(c.Name + " " + strings.Join(c.Args, " "))
+}
+
+// CLI is a Runtime which executes the docker and compose commands, or the
+// podman ones which have the same arguments
+type CLI struct {
+	// runner executes the commands
+	runner Runner
+	// docker command, or podman
+	docker string
+	// compose command and its first arguments: docker compose or docker-compose
+	compose []string
+}
+
+// NewCLI returns a CLI which uses the docker and compose commands
+func NewCLI(r Runner, docker string, compose []string) *CLI {
+	return &CLI{runner: r, docker: docker, compose: compose}
+}
+
+// WithRunner returns a copy of the CLI which executes the commands with r
+func (c *CLI) WithRunner(r Runner) *CLI {
+	return &CLI{runner: r, docker: c.docker, compose: c.compose}
+}
+
+// DetectCompose returns the compose command available: the compose plugin of
+// the cli (docker compose, podman compose) or the standalone binary
+// (docker-compose, podman-compose), nil when there is none
+func DetectCompose(ctx context.Context, r Runner, cli, standalone string) []string {
+	if err := r.Run(ctx, Cmd{Name: cli, Args: []string{"compose", "version"}}, nil); err == nil {
+		return []string{cli, "compose"}
+	}
+	if path, err := exec.LookPath(standalone); err == nil {
+		return []string{path}
+	}
+	return nil
+}
+
+// Name returns the name of the runtime
+func (c *CLI) Name() string {
+	return c.docker + " (CLI: " + strings.Join(c.compose, " ") + ")"
+}
+
+// composeRun executes a compose command of the project
+func (c *CLI) composeRun(ctx context.Context, p Project, out io.Writer, args ...string) error {
+	if len(c.compose) == 0 {
+		return errors.New(c.docker + " compose or " + c.docker + "-compose is needed")
+	}
+	if p.ComposeFile == "" {
+		return errors.New("the compose file of the project " + p.Name + " is needed")
+	}
+
+	args = append([]string{"-p", p.Name, "-f", p.ComposeFile}, args...)
+	return c.runner.Run(ctx, Cmd{Name: c.compose[0], Args: append(c.compose[1:], args...)}, out)
+}
+
+// Up creates the network, volumes and containers of the project and starts them
+func (c *CLI) Up(ctx context.Context, p Project, out io.Writer) error {
+	return c.composeRun(ctx, p, out, "up", "-d")
+}
+
+// Stop stops the containers of the project
+func (c *CLI) Stop(ctx context.Context, p Project) error {
+	return c.composeRun(ctx, p, nil, "stop")
+}
+
+// Down removes the containers and the network of the project, and the volumes when volumes is true
+func (c *CLI) Down(ctx context.Context, p Project, volumes bool) error {
+	args := []string{"down", "--remove-orphans"}
+	if volumes {
+		args = append(args, "-v")
+	}
+	return c.composeRun(ctx, p, nil, args...)
+}
+
+// cliContainer is a line of docker ps --format '{{json .}}', podman writes the
+// names, labels and ports as JSON values instead of strings
+type cliContainer struct {
+	ID     string          `json:"ID"`
+	Names  json.RawMessage `json:"Names"`
+	Image  string          `json:"Image"`
+	State  string          `json:"State"`
+	Status string          `json:"Status"`
+	Labels json.RawMessage `json:"Labels"`
+	Ports  json.RawMessage `json:"Ports"`
+}
+
+// cliPort is a published port in the Ports column: 0.0.0.0:9000->9000/tcp
+var cliPort = regexp.MustCompile(`:(\d+)->(\d+)/`)
+
+// Status returns the containers of the project
+func (c *CLI) Status(ctx context.Context, p Project) ([]Container, error) {
+	// the warnings in stderr can't be mixed with the JSON lines
+	out, err := c.runner.Output(ctx, Cmd{Name: c.docker, Args: []string{"ps", "-a", "--no-trunc", "--filter", "label=" + LabelProject + "=" + p.Name, "--format", "{{json .}}"}})
+	if err != nil {
+		return nil, err
+	}
+
+	var status []Container
+	s := bufio.NewScanner(strings.NewReader(out))
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line == "" {
+			continue
+		}
+		ct, err := parseContainer([]byte(line))
+		if err != nil {
+			return nil, fmt.Errorf("unexpected output of %s ps: %s", c.docker, line)
+		}
+		status = append(status, ct)
+	}
+	return status, s.Err()
+}
+
+// parseContainer parses a line of docker ps or podman ps
+func parseContainer(line []byte) (Container, error) {
+	cc := cliContainer{}
+	if err := json.Unmarshal(line, &cc); err != nil {
+		return Container{}, err
+	}
+	ct := Container{ID: cc.ID, Image: cc.Image, State: cc.State, Status: cc.Status}
+
+	// docker: "tmp-sonarqube-1", podman: ["tmp_sonarqube_1"]
+	var names []string
+	if err := json.Unmarshal(cc.Names, &ct.Name); err != nil {
+		if err := json.Unmarshal(cc.Names, &names); err != nil {
+			return Container{}, err
+		}
+		ct.Name = strings.Join(names, ",")
+	}
+
+	// docker: "k=v,k=v", podman: {"k":"v"}
+	labels := map[string]string{}
+	var text string
+	if err := json.Unmarshal(cc.Labels, &text); err == nil {
+		for _, l := range strings.Split(text, ",") {
+			kv := strings.SplitN(l, "=", 2)
+			if len(kv) == 2 {
+				labels[kv[0]] = kv[1]
+			}
+		}
+	} else if len(cc.Labels) > 0 && string(cc.Labels) != "null" {
+		if err := json.Unmarshal(cc.Labels, &labels); err != nil {
+			return Container{}, err
+		}
+	}
+	ct.Service = labels[LabelService]
+
+	// docker: "0.0.0.0:9000->9000/tcp", podman: [{"host_port":9000,"container_port":9000}]
+	var ports []Port
+	if err := json.Unmarshal(cc.Ports, &text); err == nil {
+		for _, m := range cliPort.FindAllStringSubmatch(text, -1) {
+			host, _ := strconv.Atoi(m[1])
+			ctr, _ := strconv.Atoi(m[2])
+			ports = append(ports, Port{Host: host, Container: ctr})
+		}
+	} else if len(cc.Ports) > 0 && string(cc.Ports) != "null" {
+		var mappings []struct {
+			HostPort      int `json:"host_port"`
+			ContainerPort int `json:"container_port"`
+		}
+		if err := json.Unmarshal(cc.Ports, &mappings); err != nil {
+			return Container{}, err
+		}
+		for _, m := range mappings {
+			ports = append(ports, Port{Host: m.HostPort, Container: m.ContainerPort})
+		}
+	}
+	// the same port is listed for IPv4 and IPv6
+	seen := map[Port]bool{}
+	for _, pp := range ports {
+		if !seen[pp] {
+			seen[pp] = true
+			ct.Ports = append(ct.Ports, pp)
+		}
+	}
+
+	return ct, nil
+}
+
+// Logs writes the logs of a service of the project to out
+func (c *CLI) Logs(ctx context.Context, p Project, service string, opts LogsOptions, out io.Writer) error {
+	args := []string{"logs", "--no-color"}
+	if opts.Follow {
+		args = append(args, "--follow")
+	}
+	if opts.Tail > 0 {
+		args = append(args, "--tail", strconv.Itoa(opts.Tail))
+	}
+
+	err := c.composeRun(ctx, p, out, append(args, service)...)
+	// following the logs ends when the context is canceled
+	if ctx.Err() != nil {
+		return nil
+	}
+	return err
+}
+
+// RunArgs returns the docker arguments to run the container of the spec
+func RunArgs(spec RunSpec) []string {
+	args := []string{"run", "--rm"}
+	if spec.Privileged {
+		args = append(args, "--privileged")
+	}
+	if spec.Network != "" {
+		args = append(args, "--network="+spec.Network)
+	}
+	for _, e := range spec.Env {
+		args = append(args, "-e", e)
+	}
+	// only the names, docker reads the values from its environment
+	for _, e := range spec.Secrets {
+		args = append(args, "-e", strings.SplitN(e, "=", 2)[0])
+	}
+	for _, b := range spec.Binds {
+		args = append(args, "-v", b)
+	}
+	args = append(args, spec.Image)
+	return append(args, spec.Args...)
+}
+
+// Run runs a container until it exits, writing its output to out, and removes it
+func (c *CLI) Run(ctx context.Context, spec RunSpec, out io.Writer) error {
+	err := c.runner.Run(ctx, Cmd{Name: c.docker, Args: RunArgs(spec), Env: spec.Secrets}, out)
+	exit := &exec.ExitError{}
+	if errors.As(err, &exit) {
+		return &ExitError{Code: exit.ExitCode()}
+	}
+	return err
+}
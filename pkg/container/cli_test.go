@@ -0,0 +1,175 @@
+package container
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+)
+
+// psOutput is the output of docker ps with the containers of the project tmp
+const psOutput = `{"ID":"c1","Names":"tmp-sonarqube-1","Image":"sonarqube:9.2-community","State":"running","Status":"Up 2 minutes","Labels":"com.docker.compose.project=tmp,com.docker.compose.service=sonarqube","Ports":"0.0.0.0:9000->9000/tcp, :::9000->9000/tcp"}
+{"ID":"c2","Names":"tmp-psql-1","Image":"postgres:9.5","State":"exited","Status":"Exited (0)","Labels":"com.docker.compose.service=psql,com.docker.compose.project=tmp","Ports":""}
+`
+
+// fakeRunner is a Runner which records the commands and their environment,
+// it returns the scripted outputs and errors of the command lines
+type fakeRunner struct {
+	calls   []string
+	env     map[string][]string
+	outputs map[string]string
+	errors  map[string]error
+}
+
+func (f *fakeRunner) Run(ctx context.Context, c Cmd, out io.Writer) error {
+	output, err := f.Output(ctx, c)
+	if out != nil {
+		fmt.Fprint(out, output)
+	}
+	return err
+}
+
+func (f *fakeRunner) Output(ctx context.Context, c Cmd) (string, error) {
+	f.calls = append(f.calls, c.String())
+	if len(c.Env) > 0 {
+		if f.env == nil {
+			f.env = map[string][]string{}
+		}
+		f.env[c.String()] = c.Env
+	}
+	return f.outputs[c.String()], f.errors[c.String()]
+}
+
+// TestCLI check the commands executed by the CLI runtime
+func TestCLI(t *testing.T) {
+	ps := "docker ps -a --no-trunc --filter label=com.docker.compose.project=tmp --format {{json .}}"
+	scan := "docker run --rm --network=tmp_sonar -e SONAR_HOST_URL=http://sonarqube:9000 -v /src/:/usr/src sonarsource/sonar-scanner-cli"
+	r := &fakeRunner{
+		outputs: map[string]string{ps: psOutput, scan: "scanning\n"},
+		errors:  map[string]error{scan + " fail": &ExitError{Code: 3}},
+	}
+	c := NewCLI(r, "docker", []string{"docker", "compose"})
+	ctx := context.Background()
+	p := testProject()
+	p.ComposeFile = "/tmp/docker-compose.yml"
+
+	if err := c.Up(ctx, p, &bytes.Buffer{}); err != nil {
+		t.Fatalf("ERROR: up: %v", err)
+	}
+	if err := c.Stop(ctx, p); err != nil {
+		t.Fatalf("ERROR: stop: %v", err)
+	}
+	if err := c.Down(ctx, p, true); err != nil {
+		t.Fatalf("ERROR: down: %v", err)
+	}
+	if err := c.Logs(ctx, p, "sonarqube", LogsOptions{Follow: true, Tail: 5}, &bytes.Buffer{}); err != nil {
+		t.Fatalf("ERROR: logs: %v", err)
+	}
+
+	status, err := c.Status(ctx, p)
+	if err != nil || len(status) != 2 {
+		t.Fatalf("ERROR: status: %v, %+v", err, status)
+	}
+	if status[0].Service != "sonarqube" || status[0].State != StateRunning || len(status[0].Ports) != 1 || status[0].Ports[0].Host != 9000 {
+		t.Errorf("ERROR: unexpected status: %+v", status[0])
+	}
+	if status[1].Service != "psql" || len(status[1].Ports) != 0 {
+		t.Errorf("ERROR: unexpected status: %+v", status[1])
+	}
+
+	out := &bytes.Buffer{}
+	spec := RunSpec{Image: "sonarsource/sonar-scanner-cli", Network: "tmp_sonar", Env: []string{"SONAR_HOST_URL=http://sonarqube:9000"}, Binds: []string{"/src/:/usr/src"}}
+	if err := c.Run(ctx, spec, out); err != nil || out.String() != "scanning\n" {
+		t.Errorf("ERROR: run: %v, %q", err, out)
+	}
+	spec.Args = []string{"fail"}
+	if err, ok := c.Run(ctx, spec, out).(*ExitError); !ok || err.Code != 3 {
+		t.Errorf("ERROR: exit code 3 expected: %v", err)
+	}
+	// the secrets are passed through the environment, not in the arguments
+	spec.Args, spec.Secrets = nil, []string{"SONAR_TOKEN=squ_1"}
+	if err := c.Run(ctx, spec, out); err != nil {
+		t.Errorf("ERROR: run with secrets: %v", err)
+	}
+	if env := r.env["docker run --rm --network=tmp_sonar -e SONAR_HOST_URL=http://sonarqube:9000 -e SONAR_TOKEN -v /src/:/usr/src sonarsource/sonar-scanner-cli"]; len(env) != 1 || env[0] != "SONAR_TOKEN=squ_1" {
+		t.Errorf("ERROR: environment of the secrets: %v", r.env)
+	}
+	if err := c.Run(ctx, RunSpec{Image: "busybox", Privileged: true, Args: []string{"sysctl", "-w", "vm.max_map_count=262144"}}, out); err != nil {
+		t.Errorf("ERROR: privileged run: %v", err)
+	}
+
+	want := []string{
+		"docker compose -p tmp -f /tmp/docker-compose.yml up -d",
+		"docker compose -p tmp -f /tmp/docker-compose.yml stop",
+		"docker compose -p tmp -f /tmp/docker-compose.yml down --remove-orphans -v",
+		"docker compose -p tmp -f /tmp/docker-compose.yml logs --no-color --follow --tail 5 sonarqube",
+		ps,
+		scan,
+		scan + " fail",
+		"docker run --rm --network=tmp_sonar -e SONAR_HOST_URL=http://sonarqube:9000 -e SONAR_TOKEN -v /src/:/usr/src sonarsource/sonar-scanner-cli",
+		"docker run --rm --privileged busybox sysctl -w vm.max_map_count=262144",
+	}
+	if strings.Join(r.calls, "\n") != strings.Join(want, "\n") {
+		t.Errorf("ERROR: commands: \n%s\nexpected: \n%s", strings.Join(r.calls, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+// TestCLIWithoutCompose check the error when there is no compose command
+func TestCLIWithoutCompose(t *testing.T) {
+	p := testProject()
+	p.ComposeFile = "/tmp/docker-compose.yml"
+
+	r := &fakeRunner{}
+	if err := NewCLI(r, "docker", nil).Up(context.Background(), p, &bytes.Buffer{}); err == nil || len(r.calls) != 0 {
+		t.Errorf("ERROR: error expected without compose: %v, %q", err, r.calls)
+	}
+}
+
+// TestDetectCompose check the compose plugin is probed before the standalone binary
+func TestDetectCompose(t *testing.T) {
+	ctx := context.Background()
+	if compose := DetectCompose(ctx, &fakeRunner{}, "podman", "podman-compose"); strings.Join(compose, " ") != "podman compose" {
+		t.Errorf("ERROR: compose plugin: %q", compose)
+	}
+
+	t.Setenv("PATH", t.TempDir())
+	r := &fakeRunner{errors: map[string]error{"podman compose version": errors.New("exit status 125")}}
+	if compose := DetectCompose(ctx, r, "podman", "podman-compose"); compose != nil || strings.Join(r.calls, ",") != "podman compose version" {
+		t.Errorf("ERROR: no compose: %q, %q", compose, r.calls)
+	}
+}
+
+// TestParseContainer check the lines of docker ps and podman ps
+func TestParseContainer(t *testing.T) {
+	var tests = []struct {
+		name string
+		line string
+		want Container
+	}{
+		{
+			"docker",
+			`{"ID":"c1","Names":"tmp-sonarqube-1","Image":"sonarqube","State":"running","Status":"Up","Labels":"com.docker.compose.service=sonarqube","Ports":"0.0.0.0:9000->9000/tcp"}`,
+			Container{ID: "c1", Name: "tmp-sonarqube-1", Service: "sonarqube", Image: "sonarqube", State: "running", Status: "Up", Ports: []Port{{9000, 9000}}},
+		},
+		{
+			"podman",
+			`{"Id":"c1","Names":["tmp_sonarqube_1"],"Image":"docker.io/library/sonarqube","State":"running","Status":"Up","Labels":{"com.docker.compose.service":"sonarqube","io.podman.compose.project":"tmp"},"Ports":[{"host_ip":"","container_port":9000,"host_port":9000,"range":1,"protocol":"tcp"}]}`,
+			Container{ID: "c1", Name: "tmp_sonarqube_1", Service: "sonarqube", Image: "docker.io/library/sonarqube", State: "running", Status: "Up", Ports: []Port{{9000, 9000}}},
+		},
+		{
+			"podman without ports",
+			`{"Id":"c2","Names":["tmp_psql_1"],"Image":"postgres","State":"exited","Status":"Exited","Labels":null,"Ports":null}`,
+			Container{ID: "c2", Name: "tmp_psql_1", Image: "postgres", State: "exited", Status: "Exited"},
+		},
+	}
+
+	for _, tt := range tests {
+		got, err := parseContainer([]byte(tt.line))
+		if err != nil || fmt.Sprintf("%+v", got) != fmt.Sprintf("%+v", tt.want) {
+			t.Errorf("ERROR: %s: %+v, %v, expected: %+v", tt.name, got, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,228 @@
+/*
+Copyright © 2021 Jose Ramon Mañes jr.mb47@gmail.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package container runs the containers axectl needs.
+//
+// There are two runtimes: Engine talks to the Docker Engine API over the unix
+// socket, CLI executes the docker and compose commands. Both create the same
+// resources, labelled as docker compose does, so a project started by one of
+// them can be stopped or removed by the other.
+package container
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// labels added to the resources, the same ones docker compose uses
+const (
+	LabelProject = "com.docker.compose.project"
+	LabelService = "com.docker.compose.service"
+	LabelNetwork = "com.docker.compose.network"
+	LabelVolume  = "com.docker.compose.volume"
+	// LabelConfigHash is the hash of the config of the container, it's
+	// recreated when the config of its service changes
+	LabelConfigHash = "com.docker.compose.config-hash"
+)
+
+// Container states
+const (
+	StateRunning = "running"
+	StateExited  = "exited"
+	StateCreated = "created"
+)
+
+// Runtime manages the containers of a Project and runs one-off containers
+type Runtime interface {
+	// Name of the runtime, shown to the user
+	Name() string
+	// Up creates the network, volumes and containers of the project and starts them
+	Up(ctx context.Context, p Project, out io.Writer) error
+	// Stop stops the containers of the project
+	Stop(ctx context.Context, p Project) error
+	// Down removes the containers and the network of the project, and the volumes when volumes is true
+	Down(ctx context.Context, p Project, volumes bool) error
+	// Status returns the containers of the project
+	Status(ctx context.Context, p Project) ([]Container, error)
+	// Logs writes the logs of a service of the project to out
+	Logs(ctx context.Context, p Project, service string, opts LogsOptions, out io.Writer) error
+	// Run runs a container until it exits, writing its output to out, and removes it
+	Run(ctx context.Context, spec RunSpec, out io.Writer) error
+}
+
+// Project are the services, network and volumes of a compose file
+type Project struct {
+	// Name of the project, prefix of the network and volumes
+	Name string
+	// ComposeFile path of the compose file, used by the CLI runtime
+	ComposeFile string
+	// Network name in the compose file, all the services are attached to it
+	Network string
+	// Volumes names in the compose file
+	Volumes []string
+	// Services in the order they are started
+	Services []Service
+}
+
+// Service is a container of a Project
+type Service struct {
+	// Name of the service, the other services reach it with this name
+	Name string
+	// Image of the container
+	Image string
+	// Platform of the image, empty for the one of the host
+	Platform string
+	// Env variables, KEY=value
+	Env []string
+	// Secrets env variables with secrets, KEY=value, they are never passed as
+	// arguments of a command, so they are not shown in the process list
+	Secrets []string
+	// Ports published in the host
+	Ports []Port
+	// Mounts of the project volumes
+	Mounts []Mount
+	// Ulimits of the processes of the container
+	Ulimits []Ulimit
+}
+
+// Ulimit is a resource limit of the processes of a container, the Engine API
+// and compose use the same names: nofile, nproc...
+type Ulimit struct {
+	// Name of the limit, example: nofile
+	Name string
+	// Soft limit, the processes can raise it up to the Hard one
+	Soft int64
+	Hard int64
+}
+
+// Port is a container port published in the host
+type Port struct {
+	// Host port
+	Host int
+	// Container port
+	Container int
+}
+
+// String returns the port as docker shows it
+func (p Port) String() string {
+	if p.Host == 0 {
+		return strconv.Itoa(p.Container) + "/tcp"
+	}
+	return strconv.Itoa(p.Host) + "->" + strconv.Itoa(p.Container) + "/tcp"
+}
+
+// Mount is a project volume mounted in a container
+type Mount struct {
+	// Volume name in the compose file
+	Volume string
+	// Target path inside the container
+	Target string
+}
+
+// Container is the state of a container of a project
+type Container struct {
+	// ID of the container
+	ID string
+	// Name of the container
+	Name string
+	// Service of the project
+	Service string
+	// Image of the container
+	Image string
+	// State running, exited, created...
+	State string
+	// Status human readable status, example: Up 2 minutes
+	Status string
+	// Ports published in the host
+	Ports []Port
+}
+
+// RunSpec is a one-off container
+type RunSpec struct {
+	// Image of the container
+	Image string
+	// Network to attach the container to, empty for the default one
+	Network string
+	// Env variables, KEY=value
+	Env []string
+	// Secrets env variables with secrets, KEY=value, they are never passed as
+	// arguments of a command, so they are not shown in the process list
+	Secrets []string
+	// Binds host paths mounted in the container, host:container
+	Binds []string
+	// Args of the container command
+	Args []string
+	// Privileged gives the container access to the host, example: to change
+	// the kernel settings of the Linux VM of Docker Desktop
+	Privileged bool
+}
+
+// LogsOptions what logs to show
+type LogsOptions struct {
+	// Follow keeps writing the new logs until the context is canceled or the container stops
+	Follow bool
+	// Tail number of lines from the end, 0 for all of them
+	Tail int
+}
+
+// ExitError is returned when a container exits with a non zero code
+type ExitError struct {
+	// Code exit code of the container
+	Code int
+}
+
+// Error returns the error message
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("the container exited with code %d", e.Code)
+}
+
+// NetworkName returns the name of the network created for the project
+func (p Project) NetworkName() string {
+	return p.Name + "_" + p.Network
+}
+
+// VolumeName returns the name of a volume created for the project
+func (p Project) VolumeName(volume string) string {
+	return p.Name + "_" + volume
+}
+
+// ContainerName returns the name of the container of a service
+func (p Project) ContainerName(service string) string {
+	return p.Name + "-" + service + "-1"
+}
+
+// Service returns the service with the name
+func (p Project) Service(name string) (Service, bool) {
+	for _, s := range p.Services {
+		if s.Name == name {
+			return s, true
+		}
+	}
+	return Service{}, false
+}
+
+// ParseImage splits an image in name and tag
+func ParseImage(image string) (string, string) {
+	// the registry can have a port: localhost:5000/sonarqube
+	i := strings.LastIndex(image, ":")
+	if i < 0 || strings.Contains(image[i:], "/") {
+		return image, "latest"
+	}
+	return image[:i], image[i+1:]
+}
@@ -0,0 +1,572 @@
+/*
+Copyright © 2021 Jose Ramon Mañes jr.mb47@gmail.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package container
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// DefaultSocket is the unix socket of the Docker Engine
+const DefaultSocket = "/var/run/docker.sock"
+
+// Engine is a Runtime which uses the Docker Engine API, or the compatible API of podman
+// https://docs.docker.com/engine/api/
+type Engine struct {
+	// name of the runtime
+	name string
+	// socket path of the unix socket
+	socket string
+	// httpClient used to execute the requests through the socket
+	httpClient *http.Client
+}
+
+// EngineOption configures an Engine
+type EngineOption func(*Engine)
+
+// WithName sets the name of the runtime, podman serves the same API
+func WithName(name string) EngineOption {
+	return func(e *Engine) {
+		e.name = name
+	}
+}
+
+// NewEngine returns an Engine which talks to the API in the unix socket
+func NewEngine(socket string, opts ...EngineOption) *Engine {
+	dialer := &net.Dialer{}
+	e := &Engine{
+		name:   "docker",
+		socket: socket,
+		httpClient: &http.Client{
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					return dialer.DialContext(ctx, "unix", socket)
+				},
+			},
+		},
+	}
+	for _, opt := range opts {
+		opt(e)
+	}
+	return e
+}
+
+// Name returns the name of the runtime
+func (e *Engine) Name() string {
+	return e.name + " (engine API: " + e.socket + ")"
+}
+
+// Ping check if the Engine API is reachable
+func (e *Engine) Ping(ctx context.Context) error {
+	return e.do(ctx, http.MethodGet, "/_ping", nil, nil, nil)
+}
+
+// Error is returned when the Engine API answers with a non 2xx status code
+type Error struct {
+	// StatusCode HTTP status code of the response
+	StatusCode int
+	// Method HTTP method of the request
+	Method string
+	// Path of the API endpoint
+	Path string
+	// Message returned by the Engine
+	Message string
+}
+
+// Error returns the error message
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s %s: %d %s", e.Method, e.Path, e.StatusCode, e.Message)
+}
+
+// IsNotFound check if the error is a 404, the resource doesn't exist
+func IsNotFound(err error) bool {
+	e := &Error{}
+	return errors.As(err, &e) && e.StatusCode == http.StatusNotFound
+}
+
+// IsConflict check if the error is a 409, the resource already exists or is in use
+func IsConflict(err error) bool {
+	e := &Error{}
+	return errors.As(err, &e) && e.StatusCode == http.StatusConflict
+}
+
+// request executes a request and returns the response when it's successful,
+// the caller must close its body
+func (e *Engine) request(ctx context.Context, method, path string, params url.Values, body interface{}) (*http.Response, error) {
+	u := "http://docker" + path
+	if len(params) > 0 {
+		u += "?" + params.Encode()
+	}
+
+	var r io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		r = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, u, r)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := e.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// 304: the container is already started or stopped
+	if resp.StatusCode >= 300 && resp.StatusCode != http.StatusNotModified {
+		defer resp.Body.Close()
+		data, _ := io.ReadAll(resp.Body)
+		msg := struct {
+			Message string `json:"message"`
+		}{}
+		if err := json.Unmarshal(data, &msg); err != nil || msg.Message == "" {
+			msg.Message = strings.TrimSpace(string(data))
+		}
+		return nil, &Error{StatusCode: resp.StatusCode, Method: method, Path: path, Message: msg.Message}
+	}
+
+	return resp, nil
+}
+
+// do executes a request and decodes the JSON response into out
+func (e *Engine) do(ctx context.Context, method, path string, params url.Values, body, out interface{}) error {
+	resp, err := e.request(ctx, method, path, params, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if out == nil {
+		_, err = io.Copy(io.Discard, resp.Body)
+		return err
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// engineContainer is a container in the list of containers
+type engineContainer struct {
+	ID     string            `json:"Id"`
+	Names  []string          `json:"Names"`
+	Image  string            `json:"Image"`
+	State  string            `json:"State"`
+	Status string            `json:"Status"`
+	Labels map[string]string `json:"Labels"`
+	Ports  []struct {
+		PrivatePort int    `json:"PrivatePort"`
+		PublicPort  int    `json:"PublicPort"`
+		Type        string `json:"Type"`
+	} `json:"Ports"`
+}
+
+// containers returns the containers of the project, the ones of a service when it's set
+func (e *Engine) containers(ctx context.Context, p Project, service string) ([]engineContainer, error) {
+	labels := []string{LabelProject + "=" + p.Name}
+	if service != "" {
+		labels = append(labels, LabelService+"="+service)
+	}
+	filters, err := json.Marshal(map[string][]string{"label": labels})
+	if err != nil {
+		return nil, err
+	}
+
+	params := url.Values{}
+	params.Set("all", "1")
+	params.Set("filters", string(filters))
+
+	var list []engineContainer
+	if err := e.do(ctx, http.MethodGet, "/containers/json", params, nil, &list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// Up creates the network, volumes and containers of the project and starts them
+func (e *Engine) Up(ctx context.Context, p Project, out io.Writer) error {
+	if err := e.createNetwork(ctx, p); err != nil {
+		return err
+	}
+
+	for _, v := range p.Volumes {
+		// the volumes are created only when they don't exist
+		body := map[string]interface{}{
+			"Name":   p.VolumeName(v),
+			"Labels": map[string]string{LabelProject: p.Name, LabelVolume: v},
+		}
+		if err := e.do(ctx, http.MethodPost, "/volumes/create", nil, body, nil); err != nil {
+			return err
+		}
+	}
+
+	for _, s := range p.Services {
+		list, err := e.containers(ctx, p, s.Name)
+		if err != nil {
+			return err
+		}
+
+		// the container is reused while the config of its service doesn't
+		// change, as docker compose does
+		config := serviceConfig(p, s)
+		hash := config["Labels"].(map[string]string)[LabelConfigHash]
+		var id string
+		if len(list) > 0 && list[0].Labels[LabelConfigHash] == hash {
+			id = list[0].ID
+		} else {
+			if len(list) > 0 {
+				fmt.Fprintln(out, "♻️  Recreating "+p.ContainerName(s.Name)+", its config changed")
+				params := url.Values{}
+				params.Set("force", "1")
+				if err := e.do(ctx, http.MethodDelete, "/containers/"+list[0].ID, params, nil, nil); err != nil && !IsNotFound(err) {
+					return err
+				}
+			} else {
+				fmt.Fprintln(out, "📦 Creating "+p.ContainerName(s.Name))
+			}
+			id, err = e.create(ctx, p.ContainerName(s.Name), s.Platform, config, out)
+			if err != nil {
+				return err
+			}
+		}
+
+		fmt.Fprintln(out, "🚢 Starting "+p.ContainerName(s.Name))
+		if err := e.do(ctx, http.MethodPost, "/containers/"+id+"/start", nil, nil, nil); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// createNetwork creates the network of the project when it doesn't exist
+func (e *Engine) createNetwork(ctx context.Context, p Project) error {
+	err := e.do(ctx, http.MethodGet, "/networks/"+p.NetworkName(), nil, nil, nil)
+	if !IsNotFound(err) {
+		return err
+	}
+
+	body := map[string]interface{}{
+		"Name":           p.NetworkName(),
+		"CheckDuplicate": true,
+		"Labels":         map[string]string{LabelProject: p.Name, LabelNetwork: p.Network},
+	}
+	return e.do(ctx, http.MethodPost, "/networks/create", nil, body, nil)
+}
+
+// serviceConfig returns the body to create the container of a service, its
+// labels have the hash of the config
+func serviceConfig(p Project, s Service) map[string]interface{} {
+	exposed := map[string]struct{}{}
+	bindings := map[string][]map[string]string{}
+	for _, port := range s.Ports {
+		key := strconv.Itoa(port.Container) + "/tcp"
+		exposed[key] = struct{}{}
+		bindings[key] = append(bindings[key], map[string]string{"HostPort": strconv.Itoa(port.Host)})
+	}
+
+	var binds []string
+	for _, m := range s.Mounts {
+		binds = append(binds, p.VolumeName(m.Volume)+":"+m.Target)
+	}
+
+	labels := map[string]string{LabelProject: p.Name, LabelService: s.Name}
+	config := map[string]interface{}{
+		"Image":        s.Image,
+		"Env":          s.Env,
+		"ExposedPorts": exposed,
+		"Labels":       labels,
+		"HostConfig": map[string]interface{}{
+			"Binds":         binds,
+			"PortBindings":  bindings,
+			"NetworkMode":   p.NetworkName(),
+			"RestartPolicy": map[string]string{"Name": "no"},
+			"Ulimits":       s.Ulimits,
+		},
+		"NetworkingConfig": map[string]interface{}{
+			"EndpointsConfig": map[string]interface{}{
+				p.NetworkName(): map[string]interface{}{"Aliases": []string{s.Name}},
+			},
+		},
+	}
+
+	// the keys of the maps are sorted in JSON, the same config has the same hash
+	data, _ := json.Marshal(struct {
+		Config   map[string]interface{}
+		Platform string
+	}{config, s.Platform})
+	labels[LabelConfigHash] = fmt.Sprintf("%x", sha256.Sum256(data))
+	return config
+}
+
+// create creates a container, pulling its image when it's not in the host
+func (e *Engine) create(ctx context.Context, name, platform string, config map[string]interface{}, out io.Writer) (string, error) {
+	params := url.Values{}
+	if name != "" {
+		params.Set("name", name)
+	}
+	if platform != "" {
+		params.Set("platform", platform)
+	}
+
+	created := struct {
+		ID string `json:"Id"`
+	}{}
+	err := e.do(ctx, http.MethodPost, "/containers/create", params, config, &created)
+	if IsNotFound(err) {
+		image := config["Image"].(string)
+		if err := e.pull(ctx, image, platform, out); err != nil {
+			return "", err
+		}
+		err = e.do(ctx, http.MethodPost, "/containers/create", params, config, &created)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return created.ID, nil
+}
+
+// pull downloads an image
+func (e *Engine) pull(ctx context.Context, image, platform string, out io.Writer) error {
+	fmt.Fprintln(out, "📦 Pulling the image "+image+"...")
+
+	name, tag := ParseImage(image)
+	params := url.Values{}
+	params.Set("fromImage", name)
+	params.Set("tag", tag)
+	if platform != "" {
+		params.Set("platform", platform)
+	}
+
+	resp, err := e.request(ctx, http.MethodPost, "/images/create", params, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// the progress is streamed, the errors are messages of the stream
+	dec := json.NewDecoder(resp.Body)
+	for {
+		msg := struct {
+			Error string `json:"error"`
+		}{}
+		err := dec.Decode(&msg)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if msg.Error != "" {
+			return errors.New("pull " + image + ": " + msg.Error)
+		}
+	}
+}
+
+// Stop stops the containers of the project
+func (e *Engine) Stop(ctx context.Context, p Project) error {
+	list, err := e.containers(ctx, p, "")
+	if err != nil {
+		return err
+	}
+
+	for _, c := range list {
+		if err := e.do(ctx, http.MethodPost, "/containers/"+c.ID+"/stop", nil, nil, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Down removes the containers and the network of the project, and the volumes when volumes is true
+func (e *Engine) Down(ctx context.Context, p Project, volumes bool) error {
+	list, err := e.containers(ctx, p, "")
+	if err != nil {
+		return err
+	}
+
+	params := url.Values{}
+	params.Set("force", "1")
+	for _, c := range list {
+		if err := e.do(ctx, http.MethodDelete, "/containers/"+c.ID, params, nil, nil); err != nil && !IsNotFound(err) {
+			return err
+		}
+	}
+
+	if err := e.do(ctx, http.MethodDelete, "/networks/"+p.NetworkName(), nil, nil, nil); err != nil && !IsNotFound(err) {
+		return err
+	}
+
+	if !volumes {
+		return nil
+	}
+	for _, v := range p.Volumes {
+		if err := e.do(ctx, http.MethodDelete, "/volumes/"+p.VolumeName(v), nil, nil, nil); err != nil && !IsNotFound(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// Status returns the containers of the project
+func (e *Engine) Status(ctx context.Context, p Project) ([]Container, error) {
+	list, err := e.containers(ctx, p, "")
+	if err != nil {
+		return nil, err
+	}
+
+	var status []Container
+	for _, c := range list {
+		s := Container{
+			ID:      c.ID,
+			Service: c.Labels[LabelService],
+			Image:   c.Image,
+			State:   c.State,
+			Status:  c.Status,
+		}
+		if len(c.Names) > 0 {
+			s.Name = strings.TrimPrefix(c.Names[0], "/")
+		}
+		seen := map[Port]bool{}
+		for _, port := range c.Ports {
+			// the same port is listed for IPv4 and IPv6
+			pp := Port{Host: port.PublicPort, Container: port.PrivatePort}
+			if !seen[pp] {
+				seen[pp] = true
+				s.Ports = append(s.Ports, pp)
+			}
+		}
+		status = append(status, s)
+	}
+	return status, nil
+}
+
+// Logs writes the logs of a service of the project to out
+func (e *Engine) Logs(ctx context.Context, p Project, service string, opts LogsOptions, out io.Writer) error {
+	list, err := e.containers(ctx, p, service)
+	if err != nil {
+		return err
+	}
+	if len(list) == 0 {
+		return errors.New("the container of " + service + " doesn't exist")
+	}
+
+	return e.logs(ctx, list[0].ID, opts, out)
+}
+
+// logs writes the logs of a container to out
+func (e *Engine) logs(ctx context.Context, id string, opts LogsOptions, out io.Writer) error {
+	params := url.Values{}
+	params.Set("stdout", "1")
+	params.Set("stderr", "1")
+	if opts.Follow {
+		params.Set("follow", "1")
+	}
+	if opts.Tail > 0 {
+		params.Set("tail", strconv.Itoa(opts.Tail))
+	}
+
+	resp, err := e.request(ctx, http.MethodGet, "/containers/"+id+"/logs", params, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	err = demux(resp.Body, out)
+	// following the logs ends when the context is canceled
+	if ctx.Err() != nil {
+		return nil
+	}
+	return err
+}
+
+// demux copies the multiplexed stdout and stderr streams of a container without TTY:
+// every frame has a header of 8 bytes, the stream and the size of the frame
+func demux(r io.Reader, out io.Writer) error {
+	header := make([]byte, 8)
+	for {
+		if _, err := io.ReadFull(r, header); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		size := int64(binary.BigEndian.Uint32(header[4:]))
+		if _, err := io.CopyN(out, r, size); err != nil {
+			return err
+		}
+	}
+}
+
+// Run runs a container until it exits, writing its output to out, and removes it
+func (e *Engine) Run(ctx context.Context, spec RunSpec, out io.Writer) error {
+	config := map[string]interface{}{
+		"Image": spec.Image,
+		"Env":   append(append([]string{}, spec.Env...), spec.Secrets...),
+		"Cmd":   spec.Args,
+		"HostConfig": map[string]interface{}{
+			"Binds":       spec.Binds,
+			"NetworkMode": spec.Network,
+			"Privileged":  spec.Privileged,
+		},
+	}
+
+	id, err := e.create(ctx, "", "", config, out)
+	if err != nil {
+		return err
+	}
+	// the container is removed even when the context is canceled
+	defer func() {
+		params := url.Values{}
+		params.Set("force", "1")
+		_ = e.do(context.Background(), http.MethodDelete, "/containers/"+id, params, nil, nil)
+	}()
+
+	if err := e.do(ctx, http.MethodPost, "/containers/"+id+"/start", nil, nil, nil); err != nil {
+		return err
+	}
+	if err := e.logs(ctx, id, LogsOptions{Follow: true}, out); err != nil {
+		return err
+	}
+
+	result := struct {
+		StatusCode int `json:"StatusCode"`
+	}{}
+	if err := e.do(ctx, http.MethodPost, "/containers/"+id+"/wait", nil, nil, &result); err != nil {
+		return err
+	}
+	if result.StatusCode != 0 {
+		return &ExitError{Code: result.StatusCode}
+	}
+	return nil
+}
@@ -0,0 +1,371 @@
+package container
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeEngine is an in memory Docker Engine API
+type fakeEngine struct {
+	mu         sync.Mutex
+	images     map[string]bool
+	networks   map[string]bool
+	volumes    map[string]bool
+	containers map[string]*fakeContainer
+	requests   []string
+	// created configs of all the containers, the removed ones too
+	created []map[string]interface{}
+}
+
+// fakeContainer is a container of the fakeEngine
+type fakeContainer struct {
+	id, name string
+	config   map[string]interface{}
+	state    string
+}
+
+// newFakeEngine starts a fakeEngine in a unix socket and returns the socket path
+func newFakeEngine(t *testing.T) (*fakeEngine, string) {
+	// the path of a unix socket can't be long, t.TempDir() can be too long in macOS
+	dir, err := os.MkdirTemp("", "engine")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	socket := filepath.Join(dir, "docker.sock")
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Skip("unix sockets not supported: ", err)
+	}
+
+	f := &fakeEngine{
+		images:     map[string]bool{"sonarsource/sonar-scanner-cli:latest": true},
+		networks:   map[string]bool{},
+		volumes:    map[string]bool{},
+		containers: map[string]*fakeContainer{},
+	}
+	srv := httptest.NewUnstartedServer(f)
+	srv.Listener = l
+	srv.Start()
+	t.Cleanup(srv.Close)
+
+	return f, socket
+}
+
+// ServeHTTP answers the requests of the Engine API
+func (f *fakeEngine) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.requests = append(f.requests, r.Method+" "+r.URL.Path)
+
+	notFound := func(what string) {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprintf(w, `{"message":"No such %s"}`, what)
+	}
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+
+	switch {
+	case r.URL.Path == "/_ping":
+		fmt.Fprint(w, "OK")
+	case r.Method == http.MethodGet && parts[0] == "networks":
+		if !f.networks[parts[1]] {
+			notFound("network")
+			return
+		}
+		fmt.Fprint(w, `{}`)
+	case r.URL.Path == "/networks/create":
+		body := map[string]interface{}{}
+		json.NewDecoder(r.Body).Decode(&body)
+		f.networks[body["Name"].(string)] = true
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprint(w, `{}`)
+	case r.URL.Path == "/volumes/create":
+		body := map[string]interface{}{}
+		json.NewDecoder(r.Body).Decode(&body)
+		f.volumes[body["Name"].(string)] = true
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprint(w, `{}`)
+	case r.URL.Path == "/images/create":
+		image := r.URL.Query().Get("fromImage") + ":" + r.URL.Query().Get("tag")
+		if strings.HasPrefix(image, "missing") {
+			fmt.Fprint(w, `{"status":"Pulling"}`+"\n"+`{"error":"manifest unknown"}`)
+			return
+		}
+		f.images[image] = true
+		fmt.Fprint(w, `{"status":"Pulling"}`+"\n"+`{"status":"Downloaded"}`)
+	case r.URL.Path == "/containers/create":
+		config := map[string]interface{}{}
+		json.NewDecoder(r.Body).Decode(&config)
+		name, tag := ParseImage(config["Image"].(string))
+		if !f.images[name+":"+tag] {
+			notFound("image")
+			return
+		}
+		id := fmt.Sprintf("c%d", len(f.created)+1)
+		f.containers[id] = &fakeContainer{id: id, name: r.URL.Query().Get("name"), config: config, state: StateCreated}
+		f.created = append(f.created, config)
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprintf(w, `{"Id":"%s"}`, id)
+	case r.URL.Path == "/containers/json":
+		f.list(w, r)
+	case parts[0] == "containers" && len(parts) >= 2:
+		c, ok := f.containers[parts[1]]
+		if !ok {
+			notFound("container")
+			return
+		}
+		action := r.Method
+		if len(parts) == 3 {
+			action = parts[2]
+		}
+		switch action {
+		case "start":
+			if c.state == StateRunning {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			c.state = StateRunning
+			w.WriteHeader(http.StatusNoContent)
+		case "stop":
+			c.state = StateExited
+			w.WriteHeader(http.StatusNoContent)
+		case "logs":
+			// a frame of stdout and another one of stderr
+			for i, line := range []string{"stdout line\n", "stderr line\n"} {
+				header := make([]byte, 8)
+				header[0] = byte(i + 1)
+				binary.BigEndian.PutUint32(header[4:], uint32(len(line)))
+				w.Write(header)
+				w.Write([]byte(line))
+			}
+		case "wait":
+			code := 0
+			if strings.Join(toStrings(c.config["Cmd"]), " ") == "fail" {
+				code = 2
+			}
+			fmt.Fprintf(w, `{"StatusCode":%d}`, code)
+		case http.MethodDelete:
+			delete(f.containers, c.id)
+			w.WriteHeader(http.StatusNoContent)
+		}
+	case r.Method == http.MethodDelete && parts[0] == "networks":
+		if !f.networks[parts[1]] {
+			notFound("network")
+			return
+		}
+		delete(f.networks, parts[1])
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodDelete && parts[0] == "volumes":
+		if !f.volumes[parts[1]] {
+			notFound("volume")
+			return
+		}
+		delete(f.volumes, parts[1])
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		notFound("endpoint")
+	}
+}
+
+// list answers /containers/json filtering by the labels
+func (f *fakeEngine) list(w http.ResponseWriter, r *http.Request) {
+	filters := map[string][]string{}
+	json.Unmarshal([]byte(r.URL.Query().Get("filters")), &filters)
+
+	list := []map[string]interface{}{}
+	for _, c := range f.containers {
+		labels := map[string]string{}
+		for k, v := range c.config["Labels"].(map[string]interface{}) {
+			labels[k] = v.(string)
+		}
+		match := true
+		for _, l := range filters["label"] {
+			kv := strings.SplitN(l, "=", 2)
+			match = match && labels[kv[0]] == kv[1]
+		}
+		if match {
+			list = append(list, map[string]interface{}{
+				"Id": c.id, "Names": []string{"/" + c.name}, "Image": c.config["Image"], "State": c.state, "Status": c.state, "Labels": labels,
+				"Ports": []map[string]interface{}{{"PrivatePort": 9000, "PublicPort": 9000, "Type": "tcp"}, {"PrivatePort": 9000, "PublicPort": 9000, "Type": "tcp"}},
+			})
+		}
+	}
+	json.NewEncoder(w).Encode(list)
+}
+
+// toStrings converts a decoded JSON array
+func toStrings(v interface{}) []string {
+	var s []string
+	list, _ := v.([]interface{})
+	for _, i := range list {
+		s = append(s, i.(string))
+	}
+	return s
+}
+
+// testProject returns a project like the one of SonarQube
+func testProject() Project {
+	return Project{
+		Name:    "tmp",
+		Network: "sonar",
+		Volumes: []string{"postgresql_data"},
+		Services: []Service{
+			{Name: "psql", Image: "postgres:9.5", Mounts: []Mount{{Volume: "postgresql_data", Target: "/var/lib/postgresql/data"}}},
+			{Name: "sonarqube", Image: "sonarqube:9.2-community", Env: []string{"a=b"}, Ports: []Port{{Host: 9001, Container: 9000}}, Ulimits: []Ulimit{{Name: "nofile", Soft: 131072, Hard: 131072}}},
+		},
+	}
+}
+
+// TestEngineUpDown check the resources created and removed by the Engine
+func TestEngineUpDown(t *testing.T) {
+	f, socket := newFakeEngine(t)
+	e := NewEngine(socket)
+	ctx := context.Background()
+	p := testProject()
+
+	if err := e.Ping(ctx); err != nil {
+		t.Fatalf("ERROR: ping: %v", err)
+	}
+
+	out := &bytes.Buffer{}
+	if err := e.Up(ctx, p, out); err != nil {
+		t.Fatalf("ERROR: up: %v", err)
+	}
+	if !f.networks["tmp_sonar"] || !f.volumes["tmp_postgresql_data"] || len(f.containers) != 2 {
+		t.Fatalf("ERROR: networks: %v, volumes: %v, containers: %d", f.networks, f.volumes, len(f.containers))
+	}
+	if !strings.Contains(out.String(), "Pulling the image sonarqube:9.2-community") {
+		t.Errorf("ERROR: the image is not pulled: %s", out)
+	}
+
+	// the config of the sonarqube container
+	var sonar *fakeContainer
+	for _, c := range f.containers {
+		if c.name == "tmp-sonarqube-1" {
+			sonar = c
+		}
+	}
+	if sonar == nil || sonar.state != StateRunning {
+		t.Fatalf("ERROR: sonarqube not running: %+v", f.containers)
+	}
+	config, _ := json.Marshal(sonar.config)
+	for _, w := range []string{`"HostPort":"9001"`, `"9000/tcp"`, `"Aliases":["sonarqube"]`, `"NetworkMode":"tmp_sonar"`, `"com.docker.compose.service":"sonarqube"`, `"Ulimits":[{"Hard":131072,"Name":"nofile","Soft":131072}]`} {
+		if !strings.Contains(string(config), w) {
+			t.Errorf("ERROR: %s not found in: %s", w, config)
+		}
+	}
+
+	// up again reuses the containers
+	if err := e.Up(ctx, p, out); err != nil || len(f.containers) != 2 || len(f.created) != 2 {
+		t.Errorf("ERROR: up again: %v, containers: %d, created: %d", err, len(f.containers), len(f.created))
+	}
+
+	// the container of a changed service is recreated
+	p.Services[1].Env = []string{"a=c"}
+	out.Reset()
+	if err := e.Up(ctx, p, out); err != nil || len(f.containers) != 2 || len(f.created) != 3 || f.containers[sonar.id] != nil {
+		t.Errorf("ERROR: up with a new config: %v, containers: %d, created: %d", err, len(f.containers), len(f.created))
+	}
+	if !strings.Contains(out.String(), "Recreating tmp-sonarqube-1") {
+		t.Errorf("ERROR: the container is not recreated: %s", out)
+	}
+
+	status, err := e.Status(ctx, p)
+	if err != nil || len(status) != 2 {
+		t.Fatalf("ERROR: status: %v, %+v", err, status)
+	}
+	for _, s := range status {
+		if s.State != StateRunning || len(s.Ports) != 1 || s.Ports[0].String() != "9000->9000/tcp" || s.Service == "" {
+			t.Errorf("ERROR: unexpected status: %+v", s)
+		}
+	}
+
+	if err := e.Stop(ctx, p); err != nil {
+		t.Errorf("ERROR: stop: %v", err)
+	}
+	if err := e.Down(ctx, p, false); err != nil {
+		t.Fatalf("ERROR: down: %v", err)
+	}
+	if f.networks["tmp_sonar"] || !f.volumes["tmp_postgresql_data"] || len(f.containers) != 0 {
+		t.Errorf("ERROR: down keeping the volumes, networks: %v, volumes: %v, containers: %d", f.networks, f.volumes, len(f.containers))
+	}
+	if err := e.Down(ctx, p, true); err != nil || f.volumes["tmp_postgresql_data"] {
+		t.Errorf("ERROR: down removing the volumes: %v, volumes: %v", err, f.volumes)
+	}
+}
+
+// TestEngineRun check the output, the exit code and the removal of one-off containers
+func TestEngineRun(t *testing.T) {
+	var tests = []struct {
+		image string
+		args  []string
+		code  int
+		err   bool
+	}{
+		{"sonarsource/sonar-scanner-cli", []string{"-Dsonar.projectKey=api"}, 0, false},
+		{"sonarsource/sonar-scanner-cli", []string{"fail"}, 2, true},
+		{"missing/image", nil, 0, true},
+	}
+
+	for _, tt := range tests {
+		f, socket := newFakeEngine(t)
+		out := &bytes.Buffer{}
+		err := NewEngine(socket).Run(context.Background(), RunSpec{Image: tt.image, Network: "tmp_sonar", Args: tt.args}, out)
+
+		if (err != nil) != tt.err {
+			t.Errorf("ERROR: image: %s, args: %v, error: %v", tt.image, tt.args, err)
+		}
+		if exit, ok := err.(*ExitError); tt.code != 0 && (!ok || exit.Code != tt.code) {
+			t.Errorf("ERROR: exit code expected: %d, error: %v", tt.code, err)
+		}
+		if !tt.err && out.String() != "stdout line\nstderr line\n" {
+			t.Errorf("ERROR: unexpected output: %q", out)
+		}
+		if len(f.containers) != 0 {
+			t.Errorf("ERROR: the container was not removed: %v", f.requests)
+		}
+	}
+
+	// the privileged containers change the kernel settings of the VM
+	f, socket := newFakeEngine(t)
+	f.images["busybox:latest"] = true
+	if err := NewEngine(socket).Run(context.Background(), RunSpec{Image: "busybox", Privileged: true, Args: []string{"sysctl", "-w", "vm.max_map_count=262144"}}, &bytes.Buffer{}); err != nil {
+		t.Fatalf("ERROR: privileged run: %v", err)
+	}
+	config, _ := json.Marshal(f.created[0]["HostConfig"])
+	if !strings.Contains(string(config), `"Privileged":true`) {
+		t.Errorf("ERROR: the container is not privileged: %s", config)
+	}
+}
+
+// TestEngineLogs check the logs of a service
+func TestEngineLogs(t *testing.T) {
+	_, socket := newFakeEngine(t)
+	e := NewEngine(socket)
+	ctx := context.Background()
+	p := testProject()
+
+	out := &bytes.Buffer{}
+	if err := e.Logs(ctx, p, "sonarqube", LogsOptions{Tail: 10}, out); err == nil {
+		t.Errorf("ERROR: error expected when the container doesn't exist")
+	}
+
+	if err := e.Up(ctx, p, &bytes.Buffer{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Logs(ctx, p, "sonarqube", LogsOptions{Tail: 10}, out); err != nil || out.String() != "stdout line\nstderr line\n" {
+		t.Errorf("ERROR: logs: %v, %q", err, out)
+	}
+}
@@ -0,0 +1,333 @@
+/*
+Copyright © 2021 Jose Ramon Mañes jr.mb47@gmail.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package credstore
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/nacl/secretbox"
+	"golang.org/x/crypto/pbkdf2"
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	// encryptedVersion version of the format of the encrypted file
+	encryptedVersion = 2
+	// kdfScrypt derives the key from the passphrase
+	kdfScrypt = "scrypt"
+	// defaultScryptN cost of scrypt, with scryptR and scryptP, the derivation
+	// takes around 100ms
+	defaultScryptN = 1 << 15
+	scryptR        = 8
+	scryptP        = 1
+	// keySize size of the key of secretbox
+	keySize = 32
+	// nonceSize size of the nonce of secretbox
+	nonceSize = 24
+	// saltSize size of the random salt of the key
+	saltSize = 16
+
+	// legacyVersion the version 1 of the format, AES-256-GCM and PBKDF2-SHA256,
+	// it's only read, the file is written again in the current version
+	legacyVersion = 1
+	// legacyKDF derives the key of the version 1
+	legacyKDF = "pbkdf2-sha256"
+)
+
+// ErrWrongPassphrase is returned when the file can't be decrypted with the passphrase
+var ErrWrongPassphrase = errors.New("the secrets can't be decrypted, the passphrase is wrong or the file is corrupted")
+
+// encryptedFile is the content of the encrypted file, the secrets are a JSON
+// object encrypted with NaCl secretbox (XSalsa20-Poly1305) and a key derived
+// with scrypt
+type encryptedFile struct {
+	Version int    `json:"version"`
+	KDF     string `json:"kdf"`
+	// N, R and P the cost of scrypt
+	N int `json:"n,omitempty"`
+	R int `json:"r,omitempty"`
+	P int `json:"p,omitempty"`
+	// Iterations of PBKDF2 in the version 1
+	Iterations int    `json:"iterations,omitempty"`
+	Salt       []byte `json:"salt"`
+	Nonce      []byte `json:"nonce"`
+	Data       []byte `json:"data"`
+}
+
+// Encrypted is a Store which keeps all the secrets in one file encrypted with
+// a passphrase, the file is only readable by the user
+type Encrypted struct {
+	// path of the encrypted file
+	path string
+	// passphrase the key is derived from
+	passphrase string
+	// scryptN cost of scrypt for a new file
+	scryptN int
+
+	mu sync.Mutex
+	// keys derived keys by salt and cost, the derivation is slow on purpose
+	keys map[string]*[keySize]byte
+}
+
+// NewEncrypted returns an Encrypted store which uses the file path
+func NewEncrypted(path, passphrase string) (*Encrypted, error) {
+	if passphrase == "" {
+		return nil, errors.New("the passphrase of the encrypted secrets is empty")
+	}
+	return &Encrypted{path: path, passphrase: passphrase, scryptN: defaultScryptN, keys: map[string]*[keySize]byte{}}, nil
+}
+
+// Name of the store
+func (e *Encrypted) Name() string {
+	return "encrypted file " + e.path
+}
+
+// Get returns the secret of the key
+func (e *Encrypted) Get(key string) (string, error) {
+	if err := validKey(key); err != nil {
+		return "", err
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	secrets, _, err := e.read()
+	if err != nil {
+		return "", err
+	}
+	secret, ok := secrets[key]
+	if !ok {
+		return "", ErrNotFound
+	}
+	return secret, nil
+}
+
+// Set creates or replaces the secret of the key
+func (e *Encrypted) Set(key, secret string) error {
+	if err := validKey(key); err != nil {
+		return err
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	secrets, f, err := e.read()
+	if err != nil {
+		return err
+	}
+	secrets[key] = secret
+	return e.write(secrets, f)
+}
+
+// Delete removes the secret of the key
+func (e *Encrypted) Delete(key string) error {
+	if err := validKey(key); err != nil {
+		return err
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	secrets, f, err := e.read()
+	if err != nil {
+		return err
+	}
+	if _, ok := secrets[key]; !ok {
+		return nil
+	}
+	delete(secrets, key)
+	return e.write(secrets, f)
+}
+
+// List returns the keys which start with prefix
+func (e *Encrypted) List(prefix string) ([]string, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	secrets, _, err := e.read()
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []string
+	for k := range secrets {
+		if strings.HasPrefix(k, prefix) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// header returns the header of a new file, with a new salt
+func (e *Encrypted) header() (encryptedFile, error) {
+	f := encryptedFile{Version: encryptedVersion, KDF: kdfScrypt, N: e.scryptN, R: scryptR, P: scryptP, Salt: make([]byte, saltSize)}
+	_, err := rand.Read(f.Salt)
+	return f, err
+}
+
+// read decrypts the file, it returns no secrets when it doesn't exist, and
+// the header to write it again
+func (e *Encrypted) read() (map[string]string, encryptedFile, error) {
+	secrets := map[string]string{}
+
+	data, err := os.ReadFile(e.path)
+	if os.IsNotExist(err) {
+		f, err := e.header()
+		return secrets, f, err
+	}
+	if err != nil {
+		return nil, encryptedFile{}, err
+	}
+
+	var f encryptedFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, f, fmt.Errorf("invalid encrypted file %s: %w", e.path, err)
+	}
+
+	var plain []byte
+	switch {
+	case f.Version == encryptedVersion && f.KDF == kdfScrypt && f.N > 1 && f.R > 0 && f.P > 0:
+		key, err := e.key(f)
+		if err != nil {
+			return nil, f, err
+		}
+		var nonce [nonceSize]byte
+		if len(f.Nonce) != nonceSize {
+			return nil, f, ErrWrongPassphrase
+		}
+		copy(nonce[:], f.Nonce)
+		var ok bool
+		if plain, ok = secretbox.Open(nil, f.Data, &nonce, key); !ok {
+			return nil, f, ErrWrongPassphrase
+		}
+	case f.Version == legacyVersion && f.KDF == legacyKDF && f.Iterations > 0:
+		if plain, err = e.openLegacy(f); err != nil {
+			return nil, f, err
+		}
+		// the next write uses the current version
+		if f, err = e.header(); err != nil {
+			return nil, f, err
+		}
+	default:
+		return nil, f, fmt.Errorf("unsupported encrypted file %s: version %d, %s", e.path, f.Version, f.KDF)
+	}
+
+	if err := json.Unmarshal(plain, &secrets); err != nil {
+		return nil, f, fmt.Errorf("invalid encrypted file %s: %w", e.path, err)
+	}
+	return secrets, f, nil
+}
+
+// write encrypts the secrets with a new nonce and replaces the file atomically
+func (e *Encrypted) write(secrets map[string]string, f encryptedFile) error {
+	plain, err := json.Marshal(secrets)
+	if err != nil {
+		return err
+	}
+	key, err := e.key(f)
+	if err != nil {
+		return err
+	}
+	var nonce [nonceSize]byte
+	if _, err := rand.Read(nonce[:]); err != nil {
+		return err
+	}
+	f.Nonce = nonce[:]
+	f.Data = secretbox.Seal(nil, plain, &nonce, key)
+
+	data, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Dir(e.path)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(e.path)+"-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), e.path)
+}
+
+// key returns the key derived from the passphrase with the kdf and the salt of the file
+func (e *Encrypted) key(f encryptedFile) (*[keySize]byte, error) {
+	id := fmt.Sprintf("%s/%x/%d/%d/%d/%d", f.KDF, f.Salt, f.N, f.R, f.P, f.Iterations)
+	if key, ok := e.keys[id]; ok {
+		return key, nil
+	}
+
+	var derived []byte
+	switch f.KDF {
+	case kdfScrypt:
+		var err error
+		if derived, err = scrypt.Key([]byte(e.passphrase), f.Salt, f.N, f.R, f.P, keySize); err != nil {
+			return nil, err
+		}
+	case legacyKDF:
+		derived = pbkdf2.Key([]byte(e.passphrase), f.Salt, f.Iterations, keySize, sha256.New)
+	default:
+		return nil, errors.New("unknown key derivation " + f.KDF)
+	}
+
+	key := &[keySize]byte{}
+	copy(key[:], derived)
+	e.keys[id] = key
+	return key, nil
+}
+
+// openLegacy decrypts the secrets of a file of the version 1, encrypted with AES-256-GCM
+func (e *Encrypted) openLegacy(f encryptedFile) ([]byte, error) {
+	key, err := e.key(f)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	if len(f.Nonce) != gcm.NonceSize() {
+		return nil, ErrWrongPassphrase
+	}
+	plain, err := gcm.Open(nil, f.Nonce, f.Data, nil)
+	if err != nil {
+		return nil, ErrWrongPassphrase
+	}
+	return plain, nil
+}
@@ -0,0 +1,158 @@
+/*
+Copyright © 2021 Jose Ramon Mañes jr.mb47@gmail.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package credstore
+
+import (
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+// File is a Store which writes every secret in its own file inside a folder,
+// the key is the path of the file. The files are only readable by the user.
+type File struct {
+	// dir folder of the files
+	dir string
+}
+
+// NewFile returns a File store which uses the folder dir
+func NewFile(dir string) *File {
+	return &File{dir: dir}
+}
+
+// Name of the store
+func (f *File) Name() string {
+	return "file " + f.dir
+}
+
+// path returns the file of the key
+func (f *File) path(key string) (string, error) {
+	if err := validKey(key); err != nil {
+		return "", err
+	}
+	return filepath.Join(f.dir, filepath.FromSlash(key)), nil
+}
+
+// Get returns the secret of the key
+func (f *File) Get(key string) (string, error) {
+	p, err := f.path(key)
+	if err != nil {
+		return "", err
+	}
+
+	data, err := os.ReadFile(p)
+	if os.IsNotExist(err) {
+		return "", ErrNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+
+	// the files written by older versions could be readable by others
+	if info, err := os.Stat(p); err == nil && runtime.GOOS != "windows" && info.Mode().Perm()&0077 != 0 {
+		if err := os.Chmod(p, 0600); err != nil {
+			return "", err
+		}
+	}
+
+	return strings.TrimSpace(string(data)), nil
+}
+
+// Set writes the secret to a temporary file and renames it, so the file is
+// replaced atomically
+func (f *File) Set(key, secret string) error {
+	p, err := f.path(key)
+	if err != nil {
+		return err
+	}
+	dir := filepath.Dir(p)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+
+	// the temporary files are created with 0600
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(p)+"-*")
+	if err != nil {
+		return err
+	}
+	// remove the temporary file if something fails before the rename
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.WriteString(secret); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), p)
+}
+
+// Delete removes the file of the key
+func (f *File) Delete(key string) error {
+	p, err := f.path(key)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(p)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// List returns the keys of the files which start with prefix, only the folder
+// of the prefix is read, example: tokens/ reads the folder tokens
+func (f *File) List(prefix string) ([]string, error) {
+	root := filepath.Join(f.dir, filepath.FromSlash(path.Dir(prefix+"x")))
+
+	var keys []string
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if os.IsNotExist(err) && p == root {
+			return filepath.SkipDir
+		}
+		if err != nil {
+			return err
+		}
+		// skip the temporary files of an unfinished write
+		if strings.HasPrefix(d.Name(), ".") && p != root {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(f.dir, p)
+		if err != nil {
+			return err
+		}
+		if key := filepath.ToSlash(rel); strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+		return nil
+	})
+
+	sort.Strings(keys)
+	return keys, err
+}
@@ -0,0 +1,160 @@
+/*
+Copyright © 2021 Jose Ramon Mañes jr.mb47@gmail.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package credstore
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+)
+
+// secretTool command of libsecret which talks to the Secret Service over D-Bus
+const secretTool = "secret-tool"
+
+// ErrKeyringUnavailable is returned when there is no Secret Service to talk to
+var ErrKeyringUnavailable = errors.New("the desktop keyring is not available, it needs " + secretTool + " and a D-Bus session")
+
+// Keyring is a Store which keeps the secrets in the desktop keyring (GNOME
+// Keyring, KWallet...) through the Secret Service D-Bus API. It runs
+// secret-tool instead of talking to D-Bus, so it needs libsecret installed.
+// The secrets are labelled with the attributes service and key.
+type Keyring struct {
+	// service attribute of the secrets, the name of the application
+	service string
+	// tool path of secret-tool
+	tool string
+}
+
+// NewKeyring returns a Keyring store for the service, ErrKeyringUnavailable
+// when secret-tool is not installed or there is no D-Bus session
+func NewKeyring(service string) (*Keyring, error) {
+	tool, err := exec.LookPath(secretTool)
+	if err != nil || os.Getenv("DBUS_SESSION_BUS_ADDRESS") == "" {
+		return nil, ErrKeyringUnavailable
+	}
+	return &Keyring{service: service, tool: tool}, nil
+}
+
+// Name of the store
+func (k *Keyring) Name() string {
+	return "keyring (Secret Service)"
+}
+
+// run executes secret-tool with the secret as input, the secrets in its
+// output are never part of the errors
+func (k *Keyring) run(input string, args ...string) ([]byte, error) {
+	cmd := exec.Command(k.tool, args...)
+	cmd.Stdin = strings.NewReader(input)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return out, fmt.Errorf("%s %s: %w: %s", secretTool, args[0], err, msg)
+		}
+		return out, fmt.Errorf("%s %s: %w", secretTool, args[0], err)
+	}
+	return out, nil
+}
+
+// Get returns the secret of the key
+func (k *Keyring) Get(key string) (string, error) {
+	if err := validKey(key); err != nil {
+		return "", err
+	}
+	out, err := k.run("", "lookup", "service", k.service, "key", key)
+	// secret-tool exits with 1 and no output when the secret doesn't exist
+	if err != nil && len(out) == 0 {
+		exit := &exec.ExitError{}
+		if errors.As(err, &exit) && exit.ExitCode() == 1 {
+			return "", ErrNotFound
+		}
+	}
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(out), "\r\n"), nil
+}
+
+// Set creates or replaces the secret of the key
+func (k *Keyring) Set(key, secret string) error {
+	if err := validKey(key); err != nil {
+		return err
+	}
+	_, err := k.run(secret, "store", "--label="+k.service+" "+key, "service", k.service, "key", key)
+	return err
+}
+
+// Delete removes the secret of the key
+func (k *Keyring) Delete(key string) error {
+	if err := validKey(key); err != nil {
+		return err
+	}
+	out, err := k.run("", "clear", "service", k.service, "key", key)
+	// nothing to remove
+	if err != nil && len(out) == 0 {
+		exit := &exec.ExitError{}
+		if errors.As(err, &exit) && exit.ExitCode() == 1 {
+			return nil
+		}
+	}
+	return err
+}
+
+// List returns the keys which start with prefix
+func (k *Keyring) List(prefix string) ([]string, error) {
+	out, err := k.run("", "search", "--all", "service", k.service)
+	// secret-tool exits with 1 when nothing is found
+	if err != nil && len(out) == 0 {
+		exit := &exec.ExitError{}
+		if errors.As(err, &exit) && exit.ExitCode() == 1 {
+			return nil, nil
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return parseSearch(out, prefix), nil
+}
+
+// parseSearch returns the keys of the output of secret-tool search which start
+// with prefix, the other lines, the secrets too, are ignored
+func parseSearch(out []byte, prefix string) []string {
+	var keys []string
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		name, value, ok := cut(scanner.Text(), " = ")
+		if ok && name == "attribute.key" && strings.HasPrefix(value, prefix) {
+			keys = append(keys, value)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// cut slices s around the first separator, strings.Cut needs go 1.18
+func cut(s, sep string) (string, string, bool) {
+	if i := strings.Index(s, sep); i >= 0 {
+		return s[:i], s[i+len(sep):], true
+	}
+	return s, "", false
+}
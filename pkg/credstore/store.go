@@ -0,0 +1,61 @@
+/*
+Copyright © 2021 Jose Ramon Mañes jr.mb47@gmail.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package credstore keeps the secrets of axectl: the admin password and the
+// tokens of the projects.
+//
+// There are three stores: File writes every secret in its own file, only
+// readable by the user, Encrypted keeps all of them in one file encrypted
+// with a passphrase, and Keyring uses the desktop keyring through the
+// secret-tool command of libsecret, which talks to the Secret Service over
+// D-Bus. None of them prints the secrets.
+package credstore
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrNotFound is returned by Get when the secret doesn't exist
+var ErrNotFound = errors.New("secret not found")
+
+// Store keeps secrets by key, the keys are paths separated by /, example: tokens/api
+type Store interface {
+	// Name of the store, shown to the user
+	Name() string
+	// Get returns the secret of the key, ErrNotFound when it doesn't exist
+	Get(key string) (string, error)
+	// Set creates or replaces the secret of the key
+	Set(key, secret string) error
+	// Delete removes the secret of the key, it's fine if it doesn't exist
+	Delete(key string) error
+	// List returns the keys which start with prefix, sorted
+	List(prefix string) ([]string, error)
+}
+
+// validKey check the key can be used as a path: no empty, hidden or parent folders
+func validKey(key string) error {
+	if key == "" {
+		return errors.New("the key of the secret is empty")
+	}
+	for _, part := range strings.Split(key, "/") {
+		if part == "" || strings.HasPrefix(part, ".") || strings.ContainsAny(part, `\`+"\x00") {
+			return fmt.Errorf("invalid key of the secret: %q", key)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,224 @@
+package credstore
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// testStore check the behaviour every store must have
+func testStore(t *testing.T, s Store) {
+	if _, err := s.Get("tokens/api"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("ERROR: %s: the secret doesn't exist: %v", s.Name(), err)
+	}
+	if keys, err := s.List("tokens/"); err != nil || len(keys) != 0 {
+		t.Errorf("ERROR: %s: empty list: %v, %v", s.Name(), keys, err)
+	}
+
+	secrets := map[string]string{"admin-password": "p4ss w0rd", "tokens/api": "squ_1", "tokens/web": "squ_2"}
+	for k, v := range secrets {
+		if err := s.Set(k, v); err != nil {
+			t.Fatalf("ERROR: %s: set %s: %v", s.Name(), k, err)
+		}
+	}
+	if err := s.Set("tokens/api", "squ_3"); err != nil {
+		t.Fatalf("ERROR: %s: replace: %v", s.Name(), err)
+	}
+
+	if got, err := s.Get("tokens/api"); err != nil || got != "squ_3" {
+		t.Errorf("ERROR: %s: get: %q, %v", s.Name(), got, err)
+	}
+	if got, err := s.Get("admin-password"); err != nil || got != "p4ss w0rd" {
+		t.Errorf("ERROR: %s: get: %q, %v", s.Name(), got, err)
+	}
+	if keys, err := s.List("tokens/"); err != nil || strings.Join(keys, ",") != "tokens/api,tokens/web" {
+		t.Errorf("ERROR: %s: list: %v, %v", s.Name(), keys, err)
+	}
+
+	if err := s.Delete("tokens/api"); err != nil {
+		t.Errorf("ERROR: %s: delete: %v", s.Name(), err)
+	}
+	if err := s.Delete("tokens/api"); err != nil {
+		t.Errorf("ERROR: %s: delete a missing secret: %v", s.Name(), err)
+	}
+	if _, err := s.Get("tokens/api"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("ERROR: %s: the secret was deleted: %v", s.Name(), err)
+	}
+
+	for _, k := range []string{"", "../admin-password", "tokens/.api", "tokens//api"} {
+		if err := s.Set(k, "x"); err == nil {
+			t.Errorf("ERROR: %s: invalid key %q accepted", s.Name(), k)
+		}
+	}
+}
+
+// TestFile check the secrets are files only readable by the user
+func TestFile(t *testing.T) {
+	dir := t.TempDir()
+	s := NewFile(dir)
+	testStore(t, s)
+
+	if runtime.GOOS == "windows" {
+		return
+	}
+	info, err := os.Stat(filepath.Join(dir, "tokens", "web"))
+	if err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("ERROR: token file: %v, %v", info.Mode(), err)
+	}
+
+	// the files of older versions are fixed when they are read
+	old := filepath.Join(dir, "tokens", "old")
+	if err := os.WriteFile(old, []byte("squ_4\n"), 0764); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := s.Get("tokens/old"); err != nil || got != "squ_4" {
+		t.Errorf("ERROR: old token: %q, %v", got, err)
+	}
+	if info, _ := os.Stat(old); info.Mode().Perm() != 0600 {
+		t.Errorf("ERROR: old token file: %v", info.Mode())
+	}
+}
+
+// TestEncrypted check the secrets are encrypted and the passphrase is needed
+func TestEncrypted(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "secrets.json")
+	s, err := NewEncrypted(path, "correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the default derivation is too slow for the tests
+	s.scryptN = 1 << 10
+	testStore(t, s)
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "squ_2") || strings.Contains(string(data), "tokens/web") {
+		t.Errorf("ERROR: the secrets are not encrypted: %s", data)
+	}
+	if info, _ := os.Stat(path); runtime.GOOS != "windows" && info.Mode().Perm() != 0600 {
+		t.Errorf("ERROR: encrypted file: %v", info.Mode())
+	}
+
+	wrong, _ := NewEncrypted(path, "wrong")
+	if _, err := wrong.Get("tokens/web"); !errors.Is(err, ErrWrongPassphrase) {
+		t.Errorf("ERROR: wrong passphrase: %v", err)
+	}
+	if _, err := NewEncrypted(path, ""); err == nil {
+		t.Errorf("ERROR: empty passphrase accepted")
+	}
+}
+
+// TestEncryptedLegacy check a file of the version 1 is read and written again in the current version
+func TestEncryptedLegacy(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "secrets.json")
+	f := encryptedFile{Version: legacyVersion, KDF: legacyKDF, Iterations: 1000, Salt: []byte("0123456789abcdef"), Nonce: []byte("0123456789ab")}
+	block, err := aes.NewCipher(pbkdf2.Key([]byte("correct horse"), f.Salt, f.Iterations, keySize, sha256.New))
+	if err != nil {
+		t.Fatal(err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Data = gcm.Seal(nil, f.Nonce, []byte(`{"tokens/api":"squ_1"}`), nil)
+	data, err := json.Marshal(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := NewEncrypted(path, "correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.scryptN = 1 << 10
+	if secret, err := s.Get("tokens/api"); err != nil || secret != "squ_1" {
+		t.Fatalf("ERROR: legacy secret: %s, %v", secret, err)
+	}
+	if err := s.Set("tokens/web", "squ_2"); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err = os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var current encryptedFile
+	if err := json.Unmarshal(data, &current); err != nil || current.Version != encryptedVersion || current.KDF != kdfScrypt || current.Iterations != 0 {
+		t.Errorf("ERROR: the file is not in the current version: %s, %v", data, err)
+	}
+	if keys, err := s.List("tokens/"); err != nil || strings.Join(keys, ",") != "tokens/api,tokens/web" {
+		t.Errorf("ERROR: keys: %v, %v", keys, err)
+	}
+}
+
+// fakeSecretTool writes a secret-tool script which keeps the secrets in files of dir
+func fakeSecretTool(t *testing.T) string {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake secret-tool is a shell script")
+	}
+
+	dir := t.TempDir()
+	script := filepath.Join(dir, "secret-tool")
+	content := `#!/bin/sh
+cmd=$1
+shift
+key=""
+while [ $# -gt 0 ]; do
+  [ "$1" = "key" ] && key=$2
+  shift
+done
+file=` + dir + `/secret-$(echo "$key" | tr / %)
+case "$cmd" in
+store) cat > "$file" ;;
+lookup) cat "$file" 2>/dev/null || exit 1 ;;
+clear) rm -f "$file" ;;
+search)
+  for f in ` + dir + `/secret-*; do
+    [ -e "$f" ] || exit 1
+    echo "[/org/freedesktop/secrets/collection/login/1]"
+    echo "label = axectl"
+    echo "secret = $(cat "$f")"
+    echo "attribute.key = $(basename "$f" | sed 's/^secret-//' | tr % /)"
+    echo "attribute.service = axectl"
+  done
+  ;;
+esac
+`
+	if err := os.WriteFile(script, []byte(content), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return script
+}
+
+// TestKeyring check the commands of secret-tool
+func TestKeyring(t *testing.T) {
+	testStore(t, &Keyring{service: "axectl", tool: fakeSecretTool(t)})
+
+	t.Setenv("DBUS_SESSION_BUS_ADDRESS", "")
+	if _, err := NewKeyring("axectl"); !errors.Is(err, ErrKeyringUnavailable) {
+		t.Errorf("ERROR: keyring without D-Bus: %v", err)
+	}
+}
+
+// TestParseSearch check only the keys are read from the output of secret-tool search
+func TestParseSearch(t *testing.T) {
+	out := "[/org/freedesktop/secrets/collection/login/1]\nlabel = axectl tokens/api\nsecret = attribute.key = leaked\n" +
+		"attribute.key = tokens/api\nattribute.service = axectl\n[/org/freedesktop/secrets/collection/login/2]\nattribute.key = admin-password\n"
+	if got := parseSearch([]byte(out), "tokens/"); strings.Join(got, ",") != "tokens/api" {
+		t.Errorf("ERROR: keys: %v", got)
+	}
+}
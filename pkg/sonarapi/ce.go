@@ -0,0 +1,66 @@
+/*
+Copyright © 2021 Jose Ramon Mañes jr.mb47@gmail.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package sonarapi
+
+import (
+	"context"
+	"net/url"
+)
+
+// Compute engine task statuses
+const (
+	TaskPending    = "PENDING"
+	TaskInProgress = "IN_PROGRESS"
+	TaskSuccess    = "SUCCESS"
+	TaskFailed     = "FAILED"
+	TaskCanceled   = "CANCELED"
+)
+
+// Task is a compute engine task, the server side processing of an analysis report
+type Task struct {
+	// ID of the task
+	ID string `json:"id"`
+	// Type of the task, REPORT for analyses
+	Type string `json:"type"`
+	// ComponentKey key of the project
+	ComponentKey string `json:"componentKey"`
+	// Status PENDING, IN_PROGRESS, SUCCESS, FAILED or CANCELED
+	Status string `json:"status"`
+	// AnalysisID id of the analysis, only when the task succeeded
+	AnalysisID string `json:"analysisId,omitempty"`
+	// ErrorMessage reason of the failure
+	ErrorMessage string `json:"errorMessage,omitempty"`
+}
+
+// Done check if the task has finished, successfully or not
+func (t *Task) Done() bool {
+	return t.Status != TaskPending && t.Status != TaskInProgress
+}
+
+// CeTask returns a compute engine task
+func (c *Client) CeTask(ctx context.Context, id string) (*Task, error) {
+	params := url.Values{}
+	params.Set("id", id)
+
+	resp := struct {
+		Task Task `json:"task"`
+	}{}
+	if err := c.get(ctx, "/api/ce/task", params, &resp); err != nil {
+		return nil, err
+	}
+
+	return &resp.Task, nil
+}
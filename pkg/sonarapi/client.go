@@ -0,0 +1,316 @@
+/*
+Copyright © 2021 Jose Ramon Mañes jr.mb47@gmail.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package sonarapi is a small typed client for the SonarQube Web API.
+//
+// It only covers the endpoints axectl needs: projects, user tokens, quality
+// gates, issues, measures and the system status/health probes.
+package sonarapi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultTimeout is the timeout used for every HTTP request when none is set
+	DefaultTimeout = 30 * time.Second
+	// DefaultRetryWait is the time to wait between two attempts of the same request
+	DefaultRetryWait = 1 * time.Second
+)
+
+// Client talks to a SonarQube server
+type Client struct {
+	// baseURL of the SonarQube server, example: http://localhost:9000
+	baseURL string
+	// username used for basic auth, when token is set it takes precedence
+	username string
+	// password used for basic auth
+	password string
+	// token user token used instead of username/password
+	token string
+	// retries number of extra attempts for idempotent requests
+	retries int
+	// retryWait time to wait between attempts
+	retryWait time.Duration
+	// httpClient used to execute the requests
+	httpClient *http.Client
+}
+
+// Option configures a Client
+type Option func(*Client)
+
+// WithBasicAuth authenticates the requests with a user and a password
+func WithBasicAuth(username, password string) Option {
+	return func(c *Client) {
+		c.username = username
+		c.password = password
+	}
+}
+
+// WithToken authenticates the requests with a user token
+func WithToken(token string) Option {
+	return func(c *Client) {
+		c.token = token
+	}
+}
+
+// WithTimeout sets the timeout of every request
+func WithTimeout(timeout time.Duration) Option {
+	return func(c *Client) {
+		c.httpClient.Timeout = timeout
+	}
+}
+
+// WithRetry retries idempotent requests (GET) which fail because of a network
+// error or a 5xx response, waiting between each attempt
+func WithRetry(retries int, wait time.Duration) Option {
+	return func(c *Client) {
+		c.retries = retries
+		c.retryWait = wait
+	}
+}
+
+// WithHTTPClient replaces the http.Client used by the Client
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+// NewClient returns a Client for the SonarQube server in baseURL
+func NewClient(baseURL string, opts ...Option) *Client {
+	c := &Client{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		retryWait:  DefaultRetryWait,
+		httpClient: &http.Client{Timeout: DefaultTimeout},
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// BaseURL returns the url of the SonarQube server
+func (c *Client) BaseURL() string {
+	return c.baseURL
+}
+
+// get executes a GET request and decodes the JSON response into out
+func (c *Client) get(ctx context.Context, path string, params url.Values, out interface{}) error {
+	return c.do(ctx, http.MethodGet, path, params, out)
+}
+
+// post executes a POST request with a form body and decodes the JSON response into out
+func (c *Client) post(ctx context.Context, path string, params url.Values, out interface{}) error {
+	return c.do(ctx, http.MethodPost, path, params, out)
+}
+
+// do executes the request, retrying it when it's allowed, and decodes the response
+func (c *Client) do(ctx context.Context, method, path string, params url.Values, out interface{}) error {
+	attempts := 1
+	// only GET requests are safe to repeat, a POST could create things twice
+	if method == http.MethodGet {
+		attempts += c.retries
+	}
+
+	var err error
+	for i := 0; i < attempts; i++ {
+		if i > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(c.retryWait):
+			}
+		}
+
+		var body []byte
+		body, err = c.send(ctx, method, path, params)
+		if err == nil {
+			return decode(body, out)
+		}
+		if !retryable(err) || ctx.Err() != nil {
+			return err
+		}
+	}
+
+	return err
+}
+
+// send executes a single request and returns the body of a successful response
+func (c *Client) send(ctx context.Context, method, path string, params url.Values) ([]byte, error) {
+	u := c.baseURL + path
+
+	var body io.Reader
+	if method == http.MethodGet {
+		if len(params) > 0 {
+			u += "?" + params.Encode()
+		}
+	} else {
+		body = strings.NewReader(params.Encode())
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, u, body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	// SonarQube accepts the token as the user with an empty password
+	if c.token != "" {
+		req.SetBasicAuth(c.token, "")
+	} else if c.username != "" {
+		req.SetBasicAuth(c.username, c.password)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, newError(method, path, resp.StatusCode, data)
+	}
+
+	return data, nil
+}
+
+// decode unmarshal the body into out, strings receive the raw body
+func decode(body []byte, out interface{}) error {
+	switch v := out.(type) {
+	case nil:
+		return nil
+	case *string:
+		*v = strings.TrimSpace(string(body))
+		return nil
+	}
+
+	if len(body) == 0 {
+		return nil
+	}
+
+	return json.Unmarshal(body, out)
+}
+
+// retryable check if the error is worth another attempt
+func retryable(err error) bool {
+	if e, ok := err.(*Error); ok {
+		return e.StatusCode >= 500
+	}
+	// network errors, the server could be still starting
+	return true
+}
+
+// Error is returned when SonarQube answers with a non 2xx status code
+type Error struct {
+	// StatusCode HTTP status code of the response
+	StatusCode int
+	// Method HTTP method of the request
+	Method string
+	// Path of the API endpoint
+	Path string
+	// Messages returned by SonarQube in the errors field
+	Messages []string
+}
+
+// errorResponse is the body SonarQube returns for failed requests
+type errorResponse struct {
+	Errors []struct {
+		Msg string `json:"msg"`
+	} `json:"errors"`
+}
+
+// newError build an Error from the response body
+func newError(method, path string, statusCode int, body []byte) *Error {
+	e := &Error{
+		StatusCode: statusCode,
+		Method:     method,
+		Path:       path,
+	}
+
+	resp := errorResponse{}
+	if err := json.Unmarshal(body, &resp); err == nil {
+		for _, m := range resp.Errors {
+			e.Messages = append(e.Messages, m.Msg)
+		}
+	}
+
+	return e
+}
+
+// Error returns the messages from SonarQube, or the status when there is none
+func (e *Error) Error() string {
+	msg := http.StatusText(e.StatusCode)
+	if len(e.Messages) > 0 {
+		msg = strings.Join(e.Messages, "; ")
+	}
+	return fmt.Sprintf("sonarqube: %s %s: %d: %s", e.Method, e.Path, e.StatusCode, msg)
+}
+
+// hasStatus check if err is an *Error with the status code
+func hasStatus(err error, statusCode int) bool {
+	e, ok := err.(*Error)
+	return ok && e.StatusCode == statusCode
+}
+
+// IsNotFound check if the resource requested doesn't exist
+func IsNotFound(err error) bool {
+	return hasStatus(err, http.StatusNotFound)
+}
+
+// IsUnauthorized check if the credentials were rejected
+func IsUnauthorized(err error) bool {
+	return hasStatus(err, http.StatusUnauthorized)
+}
+
+// IsForbidden check if the user has not enough permissions
+func IsForbidden(err error) bool {
+	return hasStatus(err, http.StatusForbidden)
+}
+
+// IsAlreadyExists check if SonarQube refused to create something that already exists
+func IsAlreadyExists(err error) bool {
+	e, ok := err.(*Error)
+	if !ok || e.StatusCode != http.StatusBadRequest {
+		return false
+	}
+	for _, m := range e.Messages {
+		if strings.Contains(m, "already exist") {
+			return true
+		}
+	}
+	return false
+}
+
+// Paging is the pagination block returned by the search endpoints
+type Paging struct {
+	PageIndex int `json:"pageIndex"`
+	PageSize  int `json:"pageSize"`
+	Total     int `json:"total"`
+}
@@ -0,0 +1,220 @@
+package sonarapi
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// newTestServer returns a fake SonarQube which answers path with status and body
+func newTestServer(t *testing.T, routes map[string]func(w http.ResponseWriter, r *http.Request)) *httptest.Server {
+	t.Helper()
+	mux := http.NewServeMux()
+	for path, handler := range routes {
+		mux.HandleFunc(path, handler)
+	}
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// reply writes a JSON body with the status code
+func reply(status int, body string) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		fmt.Fprint(w, body)
+	}
+}
+
+// TestError check that the SonarQube errors are decoded
+func TestError(t *testing.T) {
+	srv := newTestServer(t, map[string]func(w http.ResponseWriter, r *http.Request){
+		"/api/projects/create": reply(http.StatusBadRequest, `{"errors":[{"msg":"Could not create Project, key already exists: axectl"}]}`),
+		"/api/projects/search": reply(http.StatusUnauthorized, ``),
+		"/api/server/version":  reply(http.StatusNotFound, `{"errors":[{"msg":"a"},{"msg":"b"}]}`),
+	})
+	c := NewClient(srv.URL)
+	ctx := context.Background()
+
+	_, err := c.CreateProject(ctx, CreateProjectOptions{Key: "axectl"})
+	if !IsAlreadyExists(err) {
+		t.Errorf("ERROR: expected already exists, got: %v", err)
+	}
+	e, ok := err.(*Error)
+	if !ok || len(e.Messages) != 1 || e.StatusCode != http.StatusBadRequest {
+		t.Errorf("ERROR: unexpected error: %#v", err)
+	}
+
+	_, err = c.SearchProjects(ctx, "", 0, 0)
+	if !IsUnauthorized(err) {
+		t.Errorf("ERROR: expected unauthorized, got: %v", err)
+	}
+
+	_, err = c.ServerVersion(ctx)
+	if !IsNotFound(err) {
+		t.Errorf("ERROR: expected not found, got: %v", err)
+	}
+	if got, want := err.Error(), "sonarqube: GET /api/server/version: 404: a; b"; got != want {
+		t.Errorf("ERROR: got: %s, want: %s", got, want)
+	}
+}
+
+// TestAuth check that the credentials are sent
+func TestAuth(t *testing.T) {
+	var tests = []struct {
+		name     string
+		opt      Option
+		user     string
+		password string
+	}{
+		{"basic auth", WithBasicAuth("admin", "secret"), "admin", "secret"},
+		{"token", WithToken("squ_123"), "squ_123", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var user, password string
+			srv := newTestServer(t, map[string]func(w http.ResponseWriter, r *http.Request){
+				"/api/server/version": func(w http.ResponseWriter, r *http.Request) {
+					user, password, _ = r.BasicAuth()
+					fmt.Fprint(w, "9.2.4.50792\n")
+				},
+			})
+
+			version, err := NewClient(srv.URL+"/", tt.opt).ServerVersion(context.Background())
+			if err != nil {
+				t.Fatalf("ERROR: %v", err)
+			}
+			if version != "9.2.4.50792" {
+				t.Errorf("ERROR: version: %q", version)
+			}
+			if user != tt.user || password != tt.password {
+				t.Errorf("ERROR: got: %s:%s, want: %s:%s", user, password, tt.user, tt.password)
+			}
+		})
+	}
+}
+
+// TestRetry check that only GET requests are retried
+func TestRetry(t *testing.T) {
+	calls := map[string]int{}
+	srv := newTestServer(t, map[string]func(w http.ResponseWriter, r *http.Request){
+		"/api/system/status": func(w http.ResponseWriter, r *http.Request) {
+			calls[r.URL.Path]++
+			if calls[r.URL.Path] < 3 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			fmt.Fprint(w, `{"id":"1","version":"9.2","status":"UP"}`)
+		},
+		"/api/user_tokens/generate": func(w http.ResponseWriter, r *http.Request) {
+			calls[r.URL.Path]++
+			w.WriteHeader(http.StatusServiceUnavailable)
+		},
+	})
+	c := NewClient(srv.URL, WithRetry(3, time.Millisecond))
+	ctx := context.Background()
+
+	status, err := c.SystemStatus(ctx)
+	if err != nil {
+		t.Fatalf("ERROR: %v", err)
+	}
+	if status.Status != StatusUp || calls["/api/system/status"] != 3 {
+		t.Errorf("ERROR: status: %s, calls: %d", status.Status, calls["/api/system/status"])
+	}
+
+	_, err = c.GenerateToken(ctx, "axectl", "")
+	if err == nil || calls["/api/user_tokens/generate"] != 1 {
+		t.Errorf("ERROR: err: %v, calls: %d", err, calls["/api/user_tokens/generate"])
+	}
+}
+
+// TestEndpoints check the requests and the decoding of the responses
+func TestEndpoints(t *testing.T) {
+	var form map[string]string
+	record := func(body string) func(w http.ResponseWriter, r *http.Request) {
+		return func(w http.ResponseWriter, r *http.Request) {
+			_ = r.ParseForm()
+			form = map[string]string{"method": r.Method}
+			for k := range r.Form {
+				form[k] = r.Form.Get(k)
+			}
+			fmt.Fprint(w, body)
+		}
+	}
+	srv := newTestServer(t, map[string]func(w http.ResponseWriter, r *http.Request){
+		"/api/projects/create":             record(`{"project":{"key":"axectl","name":"axectl","qualifier":"TRK","visibility":"public"}}`),
+		"/api/user_tokens/generate":        record(`{"login":"admin","name":"axectl","token":"squ_1","createdAt":"2021-12-01T10:00:00+0000"}`),
+		"/api/user_tokens/search":          record(`{"login":"admin","userTokens":[{"name":"a","createdAt":"x"},{"name":"b","createdAt":"y"}]}`),
+		"/api/qualitygates/project_status": record(`{"projectStatus":{"status":"ERROR","conditions":[{"status":"ERROR","metricKey":"new_coverage","comparator":"LT","errorThreshold":"80","actualValue":"10.0"}]}}`),
+		"/api/issues/search":               record(`{"total":1,"paging":{"pageIndex":1,"pageSize":100,"total":1},"issues":[{"key":"k","rule":"go:S1192","severity":"MINOR","component":"axectl:main.go","line":3,"message":"m","type":"CODE_SMELL"}]}`),
+		"/api/measures/component":          record(`{"component":{"key":"axectl","measures":[{"metric":"coverage","value":"81.5"}]}}`),
+		"/api/system/health":               record(`{"health":"YELLOW","causes":[{"message":"slow"}]}`),
+		"/api/system/db_migration_status":  record(`{"state":"NO_MIGRATION","message":"Database is up-to-date, no migration needed."}`),
+	})
+	c := NewClient(srv.URL, WithBasicAuth("admin", "admin"))
+	ctx := context.Background()
+
+	project, err := c.CreateProject(ctx, CreateProjectOptions{Key: "axectl", Organization: "org"})
+	if err != nil || project.Key != "axectl" {
+		t.Errorf("ERROR: project: %v, %v", project, err)
+	}
+	if form["method"] != http.MethodPost || form["project"] != "axectl" || form["name"] != "axectl" || form["organization"] != "org" {
+		t.Errorf("ERROR: create project form: %v", form)
+	}
+
+	token, err := c.GenerateToken(ctx, "axectl", "")
+	if err != nil || token.Token != "squ_1" {
+		t.Errorf("ERROR: token: %v, %v", token, err)
+	}
+
+	tokens, err := c.SearchTokens(ctx, "admin")
+	if err != nil || len(tokens) != 2 || tokens[1].Login != "admin" {
+		t.Errorf("ERROR: tokens: %v, %v", tokens, err)
+	}
+	if form["method"] != http.MethodGet || form["login"] != "admin" {
+		t.Errorf("ERROR: search tokens form: %v", form)
+	}
+
+	gate, err := c.QualityGateStatus(ctx, ProjectStatusOptions{ProjectKey: "axectl"})
+	if err != nil || gate.Passed() || len(gate.Conditions) != 1 {
+		t.Errorf("ERROR: gate: %v, %v", gate, err)
+	}
+	if form["projectKey"] != "axectl" {
+		t.Errorf("ERROR: gate form: %v", form)
+	}
+
+	resolved := false
+	issues, err := c.SearchIssues(ctx, IssueSearchOptions{ComponentKeys: []string{"axectl"}, Resolved: &resolved, Page: 1, PageSize: 100})
+	if err != nil || issues.Total != 1 || issues.Issues[0].Line != 3 {
+		t.Errorf("ERROR: issues: %v, %v", issues, err)
+	}
+	if form["resolved"] != "false" || form["ps"] != "100" {
+		t.Errorf("ERROR: issues form: %v", form)
+	}
+
+	component, err := c.ComponentMeasures(ctx, "axectl", []string{"coverage", "bugs"})
+	if err != nil {
+		t.Fatalf("ERROR: %v", err)
+	}
+	if v, ok := component.Measure("coverage"); !ok || v != "81.5" {
+		t.Errorf("ERROR: coverage: %s", v)
+	}
+	if form["metricKeys"] != "coverage,bugs" {
+		t.Errorf("ERROR: measures form: %v", form)
+	}
+
+	health, err := c.SystemHealth(ctx)
+	if err != nil || health.Health != HealthYellow || len(health.Causes) != 1 {
+		t.Errorf("ERROR: health: %v, %v", health, err)
+	}
+
+	migration, err := c.DBMigrationStatus(ctx)
+	if err != nil || migration.State != MigrationNotNeeded {
+		t.Errorf("ERROR: migration: %v, %v", migration, err)
+	}
+}
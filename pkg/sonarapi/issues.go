@@ -0,0 +1,105 @@
+/*
+Copyright © 2021 Jose Ramon Mañes jr.mb47@gmail.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package sonarapi
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// TextRange location of an issue inside a file
+type TextRange struct {
+	StartLine   int `json:"startLine"`
+	EndLine     int `json:"endLine"`
+	StartOffset int `json:"startOffset"`
+	EndOffset   int `json:"endOffset"`
+}
+
+// Issue is an issue found by an analysis
+type Issue struct {
+	// Key unique key of the issue
+	Key string `json:"key"`
+	// Rule which raised the issue, example: go:S1192
+	Rule string `json:"rule"`
+	// Severity BLOCKER, CRITICAL, MAJOR, MINOR or INFO
+	Severity string `json:"severity"`
+	// Component key of the file, example: project:path/to/file.go
+	Component string `json:"component"`
+	// Project key of the project
+	Project string `json:"project"`
+	// Line where the issue starts
+	Line int `json:"line,omitempty"`
+	// TextRange exact location of the issue
+	TextRange *TextRange `json:"textRange,omitempty"`
+	// Message describing the issue
+	Message string `json:"message"`
+	// Type BUG, VULNERABILITY or CODE_SMELL
+	Type string `json:"type"`
+	// Status OPEN, CONFIRMED, REOPENED, RESOLVED or CLOSED
+	Status string `json:"status"`
+	// Effort estimated to fix the issue, example: 5min
+	Effort string `json:"effort,omitempty"`
+	// Tags of the issue
+	Tags []string `json:"tags,omitempty"`
+}
+
+// IssueSearchOptions are the filters to search issues
+type IssueSearchOptions struct {
+	// ComponentKeys keys of the projects or files
+	ComponentKeys []string
+	// Resolved filter resolved or unresolved issues, nil for both
+	Resolved *bool
+	// Page number starting at 1
+	Page int
+	// PageSize number of issues per page, 500 maximum
+	PageSize int
+}
+
+// IssueSearchResult is a page of issues
+type IssueSearchResult struct {
+	// Total number of issues
+	Total int `json:"total"`
+	// Paging of the result
+	Paging Paging `json:"paging"`
+	// Issues of the page
+	Issues []Issue `json:"issues"`
+}
+
+// SearchIssues returns a page of issues
+func (c *Client) SearchIssues(ctx context.Context, opts IssueSearchOptions) (*IssueSearchResult, error) {
+	params := url.Values{}
+	if len(opts.ComponentKeys) > 0 {
+		params.Set("componentKeys", strings.Join(opts.ComponentKeys, ","))
+	}
+	if opts.Resolved != nil {
+		params.Set("resolved", strconv.FormatBool(*opts.Resolved))
+	}
+	if opts.Page > 0 {
+		params.Set("p", strconv.Itoa(opts.Page))
+	}
+	if opts.PageSize > 0 {
+		params.Set("ps", strconv.Itoa(opts.PageSize))
+	}
+
+	resp := &IssueSearchResult{}
+	if err := c.get(ctx, "/api/issues/search", params, resp); err != nil {
+		return nil, err
+	}
+
+	return resp, nil
+}
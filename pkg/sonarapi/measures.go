@@ -0,0 +1,70 @@
+/*
+Copyright © 2021 Jose Ramon Mañes jr.mb47@gmail.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package sonarapi
+
+import (
+	"context"
+	"net/url"
+	"strings"
+)
+
+// Measure is the value of a metric
+type Measure struct {
+	// Metric key, example: coverage
+	Metric string `json:"metric"`
+	// Value of the metric
+	Value string `json:"value"`
+	// BestValue true when the value is the best possible one
+	BestValue bool `json:"bestValue,omitempty"`
+}
+
+// Component is a project, directory or file with its measures
+type Component struct {
+	// Key of the component
+	Key string `json:"key"`
+	// Name of the component
+	Name string `json:"name"`
+	// Qualifier TRK for projects, DIR for directories and FIL for files
+	Qualifier string `json:"qualifier"`
+	// Measures requested
+	Measures []Measure `json:"measures"`
+}
+
+// Measure returns the value of a metric and if it was found
+func (c *Component) Measure(metric string) (string, bool) {
+	for _, m := range c.Measures {
+		if m.Metric == metric {
+			return m.Value, true
+		}
+	}
+	return "", false
+}
+
+// ComponentMeasures returns the measures of a component
+func (c *Client) ComponentMeasures(ctx context.Context, component string, metricKeys []string) (*Component, error) {
+	params := url.Values{}
+	params.Set("component", component)
+	params.Set("metricKeys", strings.Join(metricKeys, ","))
+
+	resp := struct {
+		Component Component `json:"component"`
+	}{}
+	if err := c.get(ctx, "/api/measures/component", params, &resp); err != nil {
+		return nil, err
+	}
+
+	return &resp.Component, nil
+}
@@ -0,0 +1,110 @@
+/*
+Copyright © 2021 Jose Ramon Mañes jr.mb47@gmail.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package sonarapi
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+)
+
+// Project is a SonarQube project
+type Project struct {
+	// Key unique key of the project
+	Key string `json:"key"`
+	// Name displayed in SonarQube
+	Name string `json:"name"`
+	// Qualifier TRK for projects
+	Qualifier string `json:"qualifier"`
+	// Visibility public or private
+	Visibility string `json:"visibility"`
+	// LastAnalysisDate date of the last analysis, empty if it was never analysed
+	LastAnalysisDate string `json:"lastAnalysisDate,omitempty"`
+}
+
+// CreateProjectOptions are the parameters to create a project
+type CreateProjectOptions struct {
+	// Key of the project
+	Key string
+	// Name of the project, the key is used when empty
+	Name string
+	// Organization the project belongs to
+	Organization string
+	// Visibility public or private, the server default is used when empty
+	Visibility string
+}
+
+// ProjectSearchResult is a page of projects
+type ProjectSearchResult struct {
+	Paging     Paging    `json:"paging"`
+	Components []Project `json:"components"`
+}
+
+// CreateProject creates a project
+func (c *Client) CreateProject(ctx context.Context, opts CreateProjectOptions) (*Project, error) {
+	name := opts.Name
+	if name == "" {
+		name = opts.Key
+	}
+
+	params := url.Values{}
+	params.Set("project", opts.Key)
+	params.Set("name", name)
+	if opts.Organization != "" {
+		params.Set("organization", opts.Organization)
+	}
+	if opts.Visibility != "" {
+		params.Set("visibility", opts.Visibility)
+	}
+
+	resp := struct {
+		Project Project `json:"project"`
+	}{}
+	if err := c.post(ctx, "/api/projects/create", params, &resp); err != nil {
+		return nil, err
+	}
+
+	return &resp.Project, nil
+}
+
+// SearchProjects returns a page of projects, query filters by key or name
+func (c *Client) SearchProjects(ctx context.Context, query string, page, pageSize int) (*ProjectSearchResult, error) {
+	params := url.Values{}
+	if query != "" {
+		params.Set("q", query)
+	}
+	if page > 0 {
+		params.Set("p", strconv.Itoa(page))
+	}
+	if pageSize > 0 {
+		params.Set("ps", strconv.Itoa(pageSize))
+	}
+
+	resp := &ProjectSearchResult{}
+	if err := c.get(ctx, "/api/projects/search", params, resp); err != nil {
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+// DeleteProject deletes a project and all its analyses
+func (c *Client) DeleteProject(ctx context.Context, key string) error {
+	params := url.Values{}
+	params.Set("project", key)
+
+	return c.post(ctx, "/api/projects/delete", params, nil)
+}
@@ -0,0 +1,83 @@
+/*
+Copyright © 2021 Jose Ramon Mañes jr.mb47@gmail.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package sonarapi
+
+import (
+	"context"
+	"net/url"
+)
+
+// Quality gate statuses
+const (
+	GateOK    = "OK"
+	GateWarn  = "WARN"
+	GateError = "ERROR"
+	GateNone  = "NONE"
+)
+
+// Condition is one condition of a quality gate
+type Condition struct {
+	// Status OK or ERROR
+	Status string `json:"status"`
+	// MetricKey metric evaluated by the condition
+	MetricKey string `json:"metricKey"`
+	// Comparator GT or LT
+	Comparator string `json:"comparator"`
+	// ErrorThreshold value which makes the condition fail
+	ErrorThreshold string `json:"errorThreshold"`
+	// ActualValue value of the metric in the analysis
+	ActualValue string `json:"actualValue"`
+}
+
+// ProjectStatus is the quality gate result of a project
+type ProjectStatus struct {
+	// Status OK, WARN, ERROR or NONE
+	Status string `json:"status"`
+	// Conditions evaluated
+	Conditions []Condition `json:"conditions"`
+}
+
+// Passed check if the quality gate didn't fail
+func (s *ProjectStatus) Passed() bool {
+	return s.Status != GateError
+}
+
+// ProjectStatusOptions selects the analysis to check, only one field is needed
+type ProjectStatusOptions struct {
+	// ProjectKey uses the last analysis of the project
+	ProjectKey string
+	// AnalysisID uses a specific analysis
+	AnalysisID string
+}
+
+// QualityGateStatus returns the quality gate status of a project or analysis
+func (c *Client) QualityGateStatus(ctx context.Context, opts ProjectStatusOptions) (*ProjectStatus, error) {
+	params := url.Values{}
+	if opts.AnalysisID != "" {
+		params.Set("analysisId", opts.AnalysisID)
+	} else {
+		params.Set("projectKey", opts.ProjectKey)
+	}
+
+	resp := struct {
+		ProjectStatus ProjectStatus `json:"projectStatus"`
+	}{}
+	if err := c.get(ctx, "/api/qualitygates/project_status", params, &resp); err != nil {
+		return nil, err
+	}
+
+	return &resp.ProjectStatus, nil
+}
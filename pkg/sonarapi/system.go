@@ -0,0 +1,119 @@
+/*
+Copyright © 2021 Jose Ramon Mañes jr.mb47@gmail.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package sonarapi
+
+import (
+	"context"
+)
+
+// Server statuses returned by /api/system/status
+const (
+	StatusStarting          = "STARTING"
+	StatusUp                = "UP"
+	StatusDown              = "DOWN"
+	StatusRestarting        = "RESTARTING"
+	StatusDBMigrationNeeded = "DB_MIGRATION_NEEDED"
+	StatusDBMigrationRun    = "DB_MIGRATION_RUNNING"
+)
+
+// Health values returned by /api/system/health
+const (
+	HealthGreen  = "GREEN"
+	HealthYellow = "YELLOW"
+	HealthRed    = "RED"
+)
+
+// Database migration states returned by /api/system/db_migration_status
+const (
+	MigrationNotNeeded    = "NO_MIGRATION"
+	MigrationNeeded       = "MIGRATION_REQUIRED"
+	MigrationRunning      = "MIGRATION_RUNNING"
+	MigrationSucceeded    = "MIGRATION_SUCCEEDED"
+	MigrationFailed       = "MIGRATION_FAILED"
+	MigrationNotSupported = "NOT_SUPPORTED"
+)
+
+// SystemStatus is the state of the server
+type SystemStatus struct {
+	// ID of the server
+	ID string `json:"id"`
+	// Version of SonarQube
+	Version string `json:"version"`
+	// Status STARTING, UP, DOWN, RESTARTING, DB_MIGRATION_NEEDED or DB_MIGRATION_RUNNING
+	Status string `json:"status"`
+}
+
+// Cause explains why the health is not GREEN
+type Cause struct {
+	Message string `json:"message"`
+}
+
+// Health is the health of the server
+type Health struct {
+	// Health GREEN, YELLOW or RED
+	Health string `json:"health"`
+	// Causes of a non GREEN health
+	Causes []Cause `json:"causes"`
+}
+
+// DBMigration is the state of the database schema
+type DBMigration struct {
+	// State NO_MIGRATION, MIGRATION_REQUIRED, MIGRATION_RUNNING, MIGRATION_SUCCEEDED, MIGRATION_FAILED or NOT_SUPPORTED
+	State string `json:"state"`
+	// Message explains the state
+	Message string `json:"message"`
+}
+
+// SystemStatus returns the state of the server, it doesn't need authentication
+func (c *Client) SystemStatus(ctx context.Context) (*SystemStatus, error) {
+	resp := &SystemStatus{}
+	if err := c.get(ctx, "/api/system/status", nil, resp); err != nil {
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+// SystemHealth returns the health of the server, it needs an admin user
+func (c *Client) SystemHealth(ctx context.Context) (*Health, error) {
+	resp := &Health{}
+	if err := c.get(ctx, "/api/system/health", nil, resp); err != nil {
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+// ServerVersion returns the version of SonarQube
+func (c *Client) ServerVersion(ctx context.Context) (string, error) {
+	var version string
+	if err := c.get(ctx, "/api/server/version", nil, &version); err != nil {
+		return "", err
+	}
+
+	return version, nil
+}
+
+// DBMigrationStatus returns the state of the database, it doesn't need
+// authentication, it fails when SonarQube can't connect to the database
+func (c *Client) DBMigrationStatus(ctx context.Context) (*DBMigration, error) {
+	resp := &DBMigration{}
+	if err := c.get(ctx, "/api/system/db_migration_status", nil, resp); err != nil {
+		return nil, err
+	}
+
+	return resp, nil
+}
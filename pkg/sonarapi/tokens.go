@@ -0,0 +1,85 @@
+/*
+Copyright © 2021 Jose Ramon Mañes jr.mb47@gmail.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package sonarapi
+
+import (
+	"context"
+	"net/url"
+)
+
+// UserToken is a user token, Token is only filled when it has just been generated
+type UserToken struct {
+	// Login of the user who owns the token
+	Login string `json:"login"`
+	// Name of the token
+	Name string `json:"name"`
+	// Token value of the token
+	Token string `json:"token,omitempty"`
+	// CreatedAt timestamp about the creation
+	CreatedAt string `json:"createdAt"`
+	// LastConnectionDate last time the token was used
+	LastConnectionDate string `json:"lastConnectionDate,omitempty"`
+}
+
+// GenerateToken generates a token, login is the user who owns it, empty for
+// the authenticated user
+func (c *Client) GenerateToken(ctx context.Context, name, login string) (*UserToken, error) {
+	params := url.Values{}
+	params.Set("name", name)
+	if login != "" {
+		params.Set("login", login)
+	}
+
+	token := &UserToken{}
+	if err := c.post(ctx, "/api/user_tokens/generate", params, token); err != nil {
+		return nil, err
+	}
+
+	return token, nil
+}
+
+// SearchTokens lists the tokens of a user, empty login for the authenticated user
+func (c *Client) SearchTokens(ctx context.Context, login string) ([]UserToken, error) {
+	params := url.Values{}
+	if login != "" {
+		params.Set("login", login)
+	}
+
+	resp := struct {
+		Login      string      `json:"login"`
+		UserTokens []UserToken `json:"userTokens"`
+	}{}
+	if err := c.get(ctx, "/api/user_tokens/search", params, &resp); err != nil {
+		return nil, err
+	}
+
+	for i := range resp.UserTokens {
+		resp.UserTokens[i].Login = resp.Login
+	}
+
+	return resp.UserTokens, nil
+}
+
+// RevokeToken revokes a token, empty login for the authenticated user
+func (c *Client) RevokeToken(ctx context.Context, name, login string) error {
+	params := url.Values{}
+	params.Set("name", name)
+	if login != "" {
+		params.Set("login", login)
+	}
+
+	return c.post(ctx, "/api/user_tokens/revoke", params, nil)
+}
@@ -0,0 +1,51 @@
+/*
+Copyright © 2021 Jose Ramon Mañes jr.mb47@gmail.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package sonarapi
+
+import (
+	"context"
+	"net/url"
+)
+
+// ValidateCredentials check if the credentials of the client are valid
+func (c *Client) ValidateCredentials(ctx context.Context) (bool, error) {
+	resp := struct {
+		Valid bool `json:"valid"`
+	}{}
+	err := c.get(ctx, "/api/authentication/validate", nil, &resp)
+	// some versions reject wrong credentials instead of answering valid=false
+	if IsUnauthorized(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return resp.Valid, nil
+}
+
+// ChangePassword changes the password of a user, previousPassword is needed
+// when the user changes its own password
+func (c *Client) ChangePassword(ctx context.Context, login, previousPassword, password string) error {
+	params := url.Values{}
+	params.Set("login", login)
+	params.Set("password", password)
+	if previousPassword != "" {
+		params.Set("previousPassword", previousPassword)
+	}
+
+	return c.post(ctx, "/api/users/change_password", params, nil)
+}